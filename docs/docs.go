@@ -124,6 +124,112 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/api/v1/users/{userID}/uploads": {
+            "get": {
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get upload history request",
+                "operationId": "getUserUploads",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID to get upload history for",
+                        "name": "userID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/modeldto.ResponseUploads"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "417": {
+                        "description": "Expectation Failed",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/validation/{userID}": {
+            "get": {
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get validation result request",
+                "operationId": "getValidationResult",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID to get validation result for",
+                        "name": "userID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/modeldto.ResponseValidation"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "417": {
+                        "description": "Expectation Failed",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
         }
     },
     "definitions": {
@@ -144,6 +250,79 @@ const docTemplate = `{
                     "example": "upload_23andme_v5_b2c_array_txt"
                 }
             }
+        },
+        "modeldto.ResponseUpload": {
+            "type": "object",
+            "properties": {
+                "barcode": {
+                    "type": "string",
+                    "example": "0000-0000"
+                },
+                "created_at": {
+                    "type": "string",
+                    "example": "2023-07-20T12:00:00Z"
+                },
+                "file_name": {
+                    "type": "string",
+                    "example": "some_file.txt"
+                },
+                "is_current": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "processing_status": {
+                    "type": "string",
+                    "example": "done"
+                },
+                "validation_status": {
+                    "type": "string",
+                    "example": "valid"
+                }
+            }
+        },
+        "modeldto.ResponseUploads": {
+            "type": "object",
+            "properties": {
+                "uploads": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/modeldto.ResponseUpload"
+                    }
+                }
+            }
+        },
+        "modeldto.ResponseValidation": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": ""
+                },
+                "file_name": {
+                    "type": "string",
+                    "example": "some_file.txt"
+                },
+                "mode": {
+                    "type": "string",
+                    "example": "tsv"
+                },
+                "passed": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "sex": {
+                    "type": "string",
+                    "example": "male"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "valid"
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2023-07-20T12:00:00Z"
+                }
+            }
         }
     }
 }`
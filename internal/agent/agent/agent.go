@@ -4,15 +4,24 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	goErrors "errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 	"upload-service-auto/internal/agent/errors"
+	"upload-service-auto/internal/bus/modelbus"
 	"upload-service-auto/internal/config"
 	"upload-service-auto/internal/constants"
 	"upload-service-auto/internal/processor/v1/models"
 	"upload-service-auto/internal/processor/v1/processor"
 	"upload-service-auto/internal/productmanager"
-	"upload-service-auto/internal/storage/v1/psql"
+	"upload-service-auto/internal/s3/artifacts"
+	"upload-service-auto/internal/s3/s3"
+	"upload-service-auto/internal/storage"
+	storageErrors "upload-service-auto/internal/storage/errors"
+	storageModels "upload-service-auto/internal/storage/v1/models"
 
 	"github.com/rs/zerolog"
 )
@@ -24,27 +33,33 @@ const (
 
 // Agent defines and Agent object ans sets its attributes.
 type Agent struct {
-	log     *zerolog.Logger
-	cfg     *config.Config
-	storage *psql.Storage
-	proc    *processor.Processor
-	manager *productmanager.ProductManager
+	log      *zerolog.Logger
+	cfg      *config.Config
+	storage  storage.Storage
+	proc     *processor.Processor
+	s3       *s3.Service
+	manager  *productmanager.ProductManager
+	manifest *artifacts.Manifest
 }
 
 // NewAgent initializes an Agent object.
 func NewAgent(
 	logger *zerolog.Logger,
 	cfg *config.Config,
-	storage *psql.Storage,
+	storage storage.Storage,
 	proc *processor.Processor,
-	manager *productmanager.ProductManager) *Agent {
+	s3 *s3.Service,
+	manager *productmanager.ProductManager,
+	manifest *artifacts.Manifest) *Agent {
 	logger.Debug().Msg("calling initializer of agent service")
 	return &Agent{
-		log:     logger,
-		cfg:     cfg,
-		storage: storage,
-		proc:    proc,
-		manager: manager,
+		log:      logger,
+		cfg:      cfg,
+		storage:  storage,
+		proc:     proc,
+		s3:       s3,
+		manager:  manager,
+		manifest: manifest,
 	}
 }
 
@@ -108,9 +123,52 @@ func (a *Agent) GetProductCode(ctx context.Context, userID, handler string) (str
 	return productCode, http.StatusOK, ""
 }
 
-// Validate runs data validation.
-func (a *Agent) Validate(ctx context.Context, userID, fileName, handler string, dryRun, fromQueue bool) (*models.ValidationData, error) {
+// GetValidationResult queries validation result of the current upload of a user.
+func (a *Agent) GetValidationResult(ctx context.Context, userID, handler string) (*storageModels.Validation, int, string) {
+	a.log.Debug().Msg("calling `GetValidationResult` method")
+	err := a.storage.CheckUserID(ctx, userID)
+	if err != nil {
+		a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.UserNotFoundError)
+		return nil, http.StatusNotFound, errors.UserNotFoundError
+	}
+
+	fileName, err := a.storage.GetFileNameForUser(ctx, userID)
+	if err != nil {
+		a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.FileNotFoundError)
+		return nil, http.StatusNotFound, errors.FileNotFoundError
+	}
+
+	validation, err := a.storage.GetValidationResult(ctx, fileName)
+	if err != nil {
+		a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.GettingValidationResultError)
+		return nil, http.StatusExpectationFailed, errors.GettingValidationResultError
+	}
+
+	return validation, http.StatusOK, ""
+}
+
+// GetUserUploads queries upload history of a user.
+func (a *Agent) GetUserUploads(ctx context.Context, userID, handler string) ([]storageModels.Upload, int, string) {
+	a.log.Debug().Msg("calling `GetUserUploads` method")
+	err := a.storage.CheckUserID(ctx, userID)
+	if err != nil {
+		a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.UserNotFoundError)
+		return nil, http.StatusNotFound, errors.UserNotFoundError
+	}
+
+	uploads, err := a.storage.GetUserUploads(ctx, userID)
+	if err != nil {
+		a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.GettingUploadsError)
+		return nil, http.StatusExpectationFailed, errors.GettingUploadsError
+	}
+
+	return uploads, http.StatusOK, ""
+}
+
+// Validate runs data validation, the result is recorded for the message it is run for unless messageID is empty.
+func (a *Agent) Validate(ctx context.Context, userID, fileName, messageID, handler string, dryRun, fromQueue bool) (*models.ValidationData, error) {
 	a.log.Debug().Msg("calling `Validate` method")
+	startedAt := time.Now()
 	var userIsNew bool
 	err := a.storage.CheckUserID(ctx, userID)
 	if err != nil {
@@ -120,37 +178,40 @@ func (a *Agent) Validate(ctx context.Context, userID, fileName, handler string,
 	}
 
 	if !dryRun {
-		if userIsNew {
-			err = a.storage.AddNewUserID(ctx, userID)
-			if err != nil {
-				a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.AddingUserError)
-				return nil, err
+		err = a.storage.WithinTx(ctx, func(ctx context.Context) error {
+			if userIsNew {
+				err := a.storage.AddNewUserID(ctx, userID)
+				if err != nil {
+					a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.AddingUserError)
+					return err
+				}
 			}
 
-			err = a.storage.AddNewUserFilePair(ctx, userID, fileName)
+			// every upload is kept in history and becomes the current one for the user
+			err := a.storage.AddNewUserFilePair(ctx, userID, fileName)
 			if err != nil {
 				a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.AddingFileError)
-				return nil, err
+				return err
 			}
 
 			err = a.storage.AddNewValidationEntry(ctx, fileName)
 			if err != nil {
 				a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.AddingValidationEntryError)
-				return nil, err
+				return err
 			}
-		} else {
-			err := a.storage.UpdateUserFilePair(ctx, userID, fileName)
-			if err != nil {
-				a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.AddingFileError)
-				return nil, err
-			}
-
-			// no need to do anything in the validation DB table
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
-
 	}
 
+	stopHeartbeat := func() {}
+	if !dryRun {
+		stopHeartbeat = a.keepAlive(ctx, constants.JobValidation, fileName)
+	}
 	validationData, err := a.proc.RunValidation(ctx, fileName, dryRun, fromQueue)
+	stopHeartbeat()
 	if err != nil {
 		a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.ValidationRunError)
 		return nil, err
@@ -160,28 +221,214 @@ func (a *Agent) Validate(ctx context.Context, userID, fileName, handler string,
 		productCode := a.manager.GetProductCode(validationData.Mode)
 		a.log.Info().Str(handlerKey, handler).Str(userIDKey, userID).Msg(fmt.Sprintf("derived product code: %s", productCode))
 
-		if validationData.Passed {
-			if userIsNew {
-				err = a.storage.AddNewProductCode(ctx, userID, productCode)
-				if err != nil {
-					a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.AddingProductCodeError)
-					return nil, err
+		err = a.storage.WithinTx(ctx, func(ctx context.Context) error {
+			status := constants.ValidationStatusInvalid
+			if validationData.Passed {
+				status = constants.ValidationStatusValid
+			}
+			err := a.storage.UpdateValidationResult(ctx, &storageModels.Validation{
+				FileName: fileName,
+				Status:   status,
+				Mode:     validationData.Mode,
+				Sex:      validationData.Sex,
+				Err:      validationData.Err,
+				Passed:   validationData.Passed,
+			})
+			if err != nil {
+				a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.SavingValidationResultError)
+				return err
+			}
+
+			if fromQueue {
+				rsp := &modelbus.RspV2{
+					Rsp:     modelbus.Rsp{UserID: userID, FileName: fileName, IsReady: validationData.Passed},
+					Outcome: modelbus.OutcomeSucceeded,
+					Validation: &modelbus.RspValidation{
+						Mode:   validationData.Mode,
+						Sex:    validationData.Sex,
+						Error:  validationData.Err,
+						Passed: validationData.Passed,
+					},
+					ProductCode: productCode,
+					Timings:     modelbus.NewRspTimings(startedAt),
+				}
+				if !validationData.Passed {
+					rsp.Outcome = modelbus.OutcomeInvalid
+					rsp.Error = &modelbus.RspError{Code: modelbus.ErrorCodeInvalidFile, Message: validationData.Err}
+					rsp.ProductCode = ""
 				}
+				if err = a.notify(ctx, constants.JobValidation, messageID, rsp); err != nil {
+					return err
+				}
+			}
+
+			if !validationData.Passed {
+				return nil
+			}
+
+			currentProductCode, err := a.storage.GetProductCode(ctx, userID)
+			if err != nil {
+				a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.GettingProductCodeError)
+				return err
+			}
+			if currentProductCode == constants.NA {
+				err = a.storage.AddNewProductCode(ctx, userID, productCode)
 			} else {
 				err = a.storage.UpdateProductCode(ctx, userID, productCode)
-				if err != nil {
-					a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.AddingProductCodeError)
-					return nil, err
-				}
 			}
+			if err != nil {
+				a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.AddingProductCodeError)
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
 	}
 	return validationData, nil
 }
 
-// Process runs data processing.
-func (a *Agent) Process(ctx context.Context, userID, barcode, handler string, dryRun, fromQueue bool) error {
+// keepAlive extends the lease of a running job of a file periodically until the returned function is called, so that
+// the job is not taken for a stale one by the reaper.
+func (a *Agent) keepAlive(ctx context.Context, kind, fileName string) func() {
+	a.log.Debug().Msg("calling `keepAlive` method")
+	if a.cfg.Jobs.HeartbeatInterval <= 0 {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(a.cfg.Jobs.HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := a.storage.Heartbeat(ctx, kind, fileName); err != nil {
+					a.log.Warn().Err(err).Str("fileName", fileName).Msg(errors.SendingHeartbeatError)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// exchange returns the exchange results of jobs of a kind are sent to.
+func (a *Agent) exchange(kind string) string {
+	if kind == constants.JobProcessing {
+		return a.cfg.AMQP.ProcessingExchangeOutputName
+	}
+	return a.cfg.AMQP.ValidationExchangeOutputName
+}
+
+// notify saves a result of a job to the outbox to be sent to rrs by the relay, it is called within the transaction
+// saving the final status, so that the result is sent if and only if it is saved. The result is also recorded for the
+// message the job is run for, so that duplicates of the message are answered with it.
+func (a *Agent) notify(ctx context.Context, kind, messageID string, rsp *modelbus.RspV2) error {
+	a.log.Debug().Msg("calling `notify` method")
+	rsp.RspType = kind
+	rsp.SchemaVersion = modelbus.RspSchemaVersion
+	serialized, err := json.Marshal(rsp)
+	if err != nil {
+		a.log.Error().Err(err).Str(userIDKey, rsp.UserID).Msg(errors.AddingOutboxMessageError)
+		return err
+	}
+	headers := map[string]string{modelbus.HeaderSchemaVersion: strconv.Itoa(modelbus.RspSchemaVersion)}
+	err = a.storage.AddOutboxMessage(ctx, &storageModels.OutboxMessage{
+		Exchange:    a.exchange(kind),
+		ContentType: "application/json",
+		Headers:     headers,
+		Payload:     serialized,
+	})
+	if err != nil {
+		a.log.Error().Err(err).Str(userIDKey, rsp.UserID).Msg(errors.AddingOutboxMessageError)
+		return err
+	}
+	if messageID == "" {
+		return nil
+	}
+	err = a.storage.AddProcessedMessage(ctx, &storageModels.ProcessedMessage{
+		MessageID:   messageID,
+		Kind:        kind,
+		UserID:      rsp.UserID,
+		FileName:    rsp.FileName,
+		ContentType: "application/json",
+		Headers:     headers,
+		Response:    serialized,
+	})
+	if err != nil {
+		a.log.Error().Err(err).Str(userIDKey, rsp.UserID).Str("messageID", messageID).Msg(errors.AddingProcessedMessageError)
+		return err
+	}
+	return nil
+}
+
+// MessageLockKey returns a lock key for handling a task message.
+func MessageLockKey(messageID string) string {
+	return fmt.Sprintf("message:%s", messageID)
+}
+
+// Claim takes a task message for handling. The returned function releases the message once its job is done, until
+// then duplicates of the message get LockNotAcquiredError. For a message whose job is done already, the known result
+// is sent to rrs again and returned instead, so the job does not have to be run again.
+func (a *Agent) Claim(ctx context.Context, messageID, handler string) (*modelbus.RspV2, func(), error) {
+	a.log.Debug().Msg("calling `Claim` method")
+	unlock, err := a.storage.TryLock(ctx, MessageLockKey(messageID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rsp *modelbus.RspV2
+	err = a.storage.WithinTx(ctx, func(ctx context.Context) error {
+		processed, err := a.storage.GetProcessedMessage(ctx, messageID)
+		if err != nil {
+			var notFound *storageErrors.NotFoundError
+			if goErrors.As(err, &notFound) {
+				return nil
+			}
+			a.log.Error().Err(err).Str(handlerKey, handler).Str("messageID", messageID).Msg(errors.GettingProcessedMessageError)
+			return err
+		}
+		known := &modelbus.RspV2{}
+		if err = json.Unmarshal(processed.Response, known); err != nil {
+			a.log.Error().Err(err).Str(handlerKey, handler).Str("messageID", messageID).Msg(errors.GettingProcessedMessageError)
+			return err
+		}
+		err = a.storage.AddOutboxMessage(ctx, &storageModels.OutboxMessage{
+			Exchange:    a.exchange(processed.Kind),
+			ContentType: processed.ContentType,
+			Headers:     processed.Headers,
+			Payload:     processed.Response,
+		})
+		if err != nil {
+			a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, processed.UserID).Msg(errors.AddingOutboxMessageError)
+			return err
+		}
+		rsp = known
+		return nil
+	})
+	if err != nil || rsp != nil {
+		unlock()
+		return rsp, func() {}, err
+	}
+	return nil, unlock, nil
+}
+
+// ProcessingLockKey returns a lock key for processing a file.
+func ProcessingLockKey(fileName string) string {
+	return fmt.Sprintf("processing:%s", fileName)
+}
+
+// Process runs data processing, the result is recorded for the message it is run for unless messageID is empty.
+func (a *Agent) Process(ctx context.Context, userID, barcode, messageID, handler string, dryRun, fromQueue bool) error {
 	a.log.Debug().Msg("calling `Process` method")
+	startedAt := time.Now()
 	err := a.storage.CheckUserID(ctx, userID)
 	if err != nil {
 		a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.UserNotFoundError)
@@ -200,28 +447,106 @@ func (a *Agent) Process(ctx context.Context, userID, barcode, handler string, dr
 		return err
 	}
 
-	status, err := a.storage.GetProcessingStatus(ctx, fileName)
+	// the lock is shared by all consumers using the same DB and is held until the final status is saved
+	unlock, err := a.storage.TryLock(ctx, ProcessingLockKey(fileName))
 	if err != nil {
-		a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.GettingProcessingStatusError)
+		a.log.Warn().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.ProcessingInProgressError)
 		return err
 	}
+	defer unlock()
 
-	if status == constants.ProcessingStatusRunning {
-		a.log.Warn().Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.ProcessingInProgressError)
-		return fmt.Errorf("processing blocked: %s", errors.ProcessingInProgressError)
-	} else if status == constants.NA {
-		err := a.storage.AddNewProcessingEntry(ctx, fileName, barcode)
+	err = a.storage.WithinTx(ctx, func(ctx context.Context) error {
+		status, err := a.storage.GetProcessingStatus(ctx, fileName)
 		if err != nil {
-			a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.AddingProcessingEntryError)
+			a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.GettingProcessingStatusError)
 			return err
 		}
+
+		if status == constants.ProcessingStatusRunning {
+			a.log.Warn().Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.ProcessingInProgressError)
+			return fmt.Errorf("processing blocked: %s", errors.ProcessingInProgressError)
+		} else if status == constants.NA {
+			err := a.storage.AddNewProcessingEntry(ctx, fileName, barcode)
+			if err != nil {
+				a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.AddingProcessingEntryError)
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	err = a.proc.RunProcessing(ctx, fileName, barcode, dryRun, fromQueue)
+	stopHeartbeat := a.keepAlive(ctx, constants.JobProcessing, fileName)
+	objects, err := a.proc.RunProcessing(ctx, userID, fileName, barcode, dryRun, fromQueue)
+	stopHeartbeat()
 	if err != nil {
 		a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.ProcessingRunError)
 		return err
 	}
 
+	// results of earlier runs are read before the new ones are recorded, keys reused by this run are kept
+	var previous []storageModels.Artifact
+	if !dryRun {
+		previous, err = a.storage.GetArtifacts(ctx, userID)
+		if err != nil {
+			a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.GettingArtifactsError)
+			return err
+		}
+	}
+	keys := make([]string, 0, len(objects))
+	artifacts := make([]storageModels.Artifact, 0, len(objects))
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+		artifacts = append(artifacts, storageModels.Artifact{
+			UserID:   userID,
+			FileName: fileName,
+			Barcode:  barcode,
+			Bucket:   a.cfg.S3Storage.Bucket,
+			Key:      object.Key,
+			Size:     object.Size,
+			SHA256:   object.Metadata[s3.MetadataSHA256],
+		})
+	}
+
+	err = a.storage.WithinTx(ctx, func(ctx context.Context) error {
+		err := a.storage.UpdateProcessingStatus(ctx, fileName, constants.ProcessingStatusDone)
+		if err != nil {
+			a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.UpdatingProcessingStatusError)
+			return err
+		}
+		if len(artifacts) > 0 {
+			if err = a.storage.AddArtifacts(ctx, artifacts); err != nil {
+				a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.AddingArtifactsError)
+				return err
+			}
+		}
+		if !fromQueue {
+			return nil
+		}
+		productCode, err := a.storage.GetProductCode(ctx, userID)
+		if err != nil {
+			a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.GettingProductCodeError)
+			return err
+		}
+		if productCode == constants.NA {
+			productCode = ""
+		}
+		return a.notify(ctx, constants.JobProcessing, messageID, &modelbus.RspV2{
+			Rsp:         modelbus.Rsp{UserID: userID, FileName: fileName, IsReady: true},
+			Outcome:     modelbus.OutcomeSucceeded,
+			ProductCode: productCode,
+			Barcode:     barcode,
+			Timings:     modelbus.NewRspTimings(startedAt),
+			S3Keys:      keys,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if !dryRun {
+		a.removeStaleArtifacts(ctx, userID, handler, previous, keys)
+	}
 	return nil
 }
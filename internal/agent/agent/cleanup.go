@@ -0,0 +1,212 @@
+// Package agent provides intermediary functionality for HTTP and AMQP handlers.
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"upload-service-auto/internal/agent/errors"
+	"upload-service-auto/internal/constants"
+	"upload-service-auto/internal/s3/artifacts"
+	storageModels "upload-service-auto/internal/storage/v1/models"
+)
+
+// removeArtifact removes an object uploaded as a processing result to the configured bucket and its record, the
+// removal is recorded in the deletion audit.
+func (a *Agent) removeArtifact(ctx context.Context, artifact *storageModels.Artifact, reason string) error {
+	a.log.Debug().Msg("calling `removeArtifact` method")
+	if err := a.s3.DeleteResult(artifact.Key); err != nil {
+		return err
+	}
+	return a.storage.WithinTx(ctx, func(ctx context.Context) error {
+		if err := a.storage.RemoveArtifact(ctx, artifact.Bucket, artifact.Key); err != nil {
+			return err
+		}
+		return a.storage.AddDeletionAudit(ctx, &storageModels.DeletionAudit{
+			UserID: artifact.UserID,
+			Kind:   constants.ObjectKindArtifact,
+			Bucket: artifact.Bucket,
+			Key:    artifact.Key,
+			Reason: reason,
+		})
+	})
+}
+
+// removeStaleArtifacts removes results of earlier processing runs of a user which are not replaced by the given keys,
+// results kept in a bucket other than the configured one are left as they are. Failures are only logged since the new
+// results are already reported, the remaining objects are removed by a later run or along with the user data.
+func (a *Agent) removeStaleArtifacts(ctx context.Context, userID, handler string, previous []storageModels.Artifact, keys []string) {
+	a.log.Debug().Msg("calling `removeStaleArtifacts` method")
+	current := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		current[key] = true
+	}
+	for i := range previous {
+		artifact := &previous[i]
+		if artifact.Bucket != a.cfg.S3Storage.Bucket {
+			a.log.Warn().Str(handlerKey, handler).Str(userIDKey, userID).Str("bucket", artifact.Bucket).
+				Str("key", artifact.Key).Msg(errors.ForeignBucketError)
+			continue
+		}
+		if current[artifact.Key] {
+			continue
+		}
+		if err := a.removeArtifact(ctx, artifact, constants.DeletionReasonReprocessed); err != nil {
+			a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Str("key", artifact.Key).
+				Msg(errors.RemovingArtifactError)
+			continue
+		}
+		a.log.Info().Str(handlerKey, handler).Str(userIDKey, userID).Str("key", artifact.Key).
+			Msg("stale artifact removed")
+	}
+}
+
+// unrecordedArtifacts finds results of processed uploads without recorded artifacts, i.e. results uploaded before
+// artifacts were recorded. Objects of the configured bucket are matched against keys of the manifest for the barcode
+// and the user, recorded keys are skipped.
+func (a *Agent) unrecordedArtifacts(ctx context.Context, userID string, uploads []storageModels.Upload, recorded []storageModels.Artifact) ([]storageModels.Artifact, error) {
+	a.log.Debug().Msg("calling `unrecordedArtifacts` method")
+	known := make(map[string]bool, len(recorded))
+	withArtifacts := make(map[string]bool, len(recorded))
+	for _, artifact := range recorded {
+		known[artifact.Key] = true
+		withArtifacts[artifact.FileName] = true
+	}
+	var pending []storageModels.Upload
+	for _, upload := range uploads {
+		if upload.Barcode != "" && !withArtifacts[upload.FileName] {
+			pending = append(pending, upload)
+		}
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	productCode, err := a.storage.GetProductCode(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if productCode == constants.NA {
+		productCode = ""
+	}
+	var objects []string
+	for _, prefix := range a.manifest.Prefixes() {
+		listed, err := a.s3.ListResults(prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range listed {
+			objects = append(objects, object.Key)
+		}
+	}
+
+	var found []storageModels.Artifact
+	for _, upload := range pending {
+		matches, err := a.manifest.KeyMatcher(artifacts.Data{Barcode: upload.Barcode, UserID: userID, ProductCode: productCode})
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range objects {
+			if known[key] || !matches(key) {
+				continue
+			}
+			known[key] = true
+			found = append(found, storageModels.Artifact{
+				UserID:   userID,
+				FileName: upload.FileName,
+				Barcode:  upload.Barcode,
+				Bucket:   a.cfg.S3Storage.Bucket,
+				Key:      key,
+			})
+		}
+	}
+	return found, nil
+}
+
+// DeleteUser removes all data of a user including their source files in the upload bucket and their processing
+// results, and returns the removed objects. Results uploaded before artifacts were recorded are found by keys of the
+// manifest, the deletion fails before anything is removed if they cannot be told apart from results of other users.
+// Every removed object is recorded in the deletion audit, the DB data is removed once all objects are, so that a
+// failed deletion can be run again. With dryRun nothing is removed and the objects to be removed are returned.
+func (a *Agent) DeleteUser(ctx context.Context, userID, handler string, dryRun bool) ([]storageModels.DeletionAudit, error) {
+	a.log.Debug().Msg("calling `DeleteUser` method")
+	err := a.storage.CheckUserID(ctx, userID)
+	if err != nil {
+		a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.UserNotFoundError)
+		return nil, err
+	}
+	uploads, err := a.storage.GetUserUploads(ctx, userID)
+	if err != nil {
+		a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.GettingUploadsError)
+		return nil, err
+	}
+	artifacts, err := a.storage.GetArtifacts(ctx, userID)
+	if err != nil {
+		a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.GettingArtifactsError)
+		return nil, err
+	}
+	unrecorded, err := a.unrecordedArtifacts(ctx, userID, uploads, artifacts)
+	if err != nil {
+		a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.FindingUnrecordedError)
+		return nil, err
+	}
+	artifacts = append(artifacts, unrecorded...)
+
+	planned := make([]storageModels.DeletionAudit, 0, len(uploads)+len(artifacts))
+	for _, upload := range uploads {
+		planned = append(planned, storageModels.DeletionAudit{
+			UserID: userID,
+			Kind:   constants.ObjectKindSource,
+			Bucket: a.cfg.S3Storage.BucketUpload,
+			Key:    a.s3.SourceKey(upload.FileName),
+			Reason: constants.DeletionReasonUserDeleted,
+		})
+	}
+	for _, artifact := range artifacts {
+		planned = append(planned, storageModels.DeletionAudit{
+			UserID: userID,
+			Kind:   constants.ObjectKindArtifact,
+			Bucket: artifact.Bucket,
+			Key:    artifact.Key,
+			Reason: constants.DeletionReasonUserDeleted,
+		})
+	}
+	if dryRun {
+		return planned, nil
+	}
+	// objects of another bucket cannot be removed, the user data is kept until they are removed by hand
+	for _, artifact := range artifacts {
+		if artifact.Bucket != a.cfg.S3Storage.Bucket {
+			a.log.Error().Str(handlerKey, handler).Str(userIDKey, userID).Str("bucket", artifact.Bucket).
+				Str("key", artifact.Key).Msg(errors.ForeignBucketError)
+			return nil, fmt.Errorf("%s: %s/%s", errors.ForeignBucketError, artifact.Bucket, artifact.Key)
+		}
+	}
+
+	removed := make([]storageModels.DeletionAudit, 0, len(planned))
+	for _, upload := range uploads {
+		if err = a.s3.DeleteSource(upload.FileName); err != nil {
+			a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.RemovingSourceError)
+			return removed, err
+		}
+		audit := planned[len(removed)]
+		if err = a.storage.AddDeletionAudit(ctx, &audit); err != nil {
+			return removed, err
+		}
+		removed = append(removed, audit)
+	}
+	for i := range artifacts {
+		if err = a.removeArtifact(ctx, &artifacts[i], constants.DeletionReasonUserDeleted); err != nil {
+			a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.RemovingArtifactError)
+			return removed, err
+		}
+		removed = append(removed, planned[len(removed)])
+	}
+
+	if err = a.storage.RemoveUserData(ctx, userID); err != nil {
+		a.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.RemovingUserDataError)
+		return removed, err
+	}
+	a.log.Info().Str(handlerKey, handler).Str(userIDKey, userID).Int("objects", len(removed)).Msg("user data removed")
+	return removed, nil
+}
@@ -0,0 +1,197 @@
+package agent
+
+import (
+	"context"
+	goErrors "errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/constants"
+	"upload-service-auto/internal/s3/artifacts"
+	"upload-service-auto/internal/s3/blob"
+	"upload-service-auto/internal/s3/s3"
+	storageErrors "upload-service-auto/internal/storage/errors"
+	"upload-service-auto/internal/storage/v1/memory"
+	storageModels "upload-service-auto/internal/storage/v1/models"
+	"upload-service-auto/internal/syncutils"
+
+	"github.com/rs/zerolog"
+)
+
+// cleanupFixture defines an agent over the in-memory storage and the local blob store.
+type cleanupFixture struct {
+	cfg     *config.Config
+	storage *memory.Storage
+	s3      *s3.Service
+	agent   *Agent
+}
+
+// newCleanupFixture initializes a new cleanupFixture with a manifest file if it is given.
+func newCleanupFixture(t *testing.T, manifestFile string) *cleanupFixture {
+	t.Helper()
+	logger := zerolog.Nop()
+	cfg := &config.Config{}
+	cfg.S3Storage.Backend = blob.BackendLocal
+	cfg.S3Storage.LocalDir = t.TempDir()
+	cfg.S3Storage.Bucket = "results"
+	cfg.S3Storage.BucketUpload = "uploads"
+	cfg.S3Storage.FolderUpload = "upload"
+	cfg.S3Storage.FolderInternal = "internal"
+	cfg.S3Storage.FolderExternal = "external"
+	cfg.S3Storage.FolderBinary = "binary"
+	cfg.S3Storage.ArtifactManifest = manifestFile
+
+	manifest, err := artifacts.NewManifest(cfg, &logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, err := s3.NewService(cfg, &logger, syncutils.NewSyncUtils())
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := memory.NewStorage(&logger)
+	return &cleanupFixture{
+		cfg:     cfg,
+		storage: storage,
+		s3:      service,
+		agent:   NewAgent(&logger, cfg, storage, nil, service, nil, manifest),
+	}
+}
+
+// processed adds a user with a processed upload of the given barcode.
+func (f *cleanupFixture) processed(t *testing.T, userID, fileName, barcode string) {
+	t.Helper()
+	ctx := context.Background()
+	for _, err := range []error{
+		f.storage.AddNewUserID(ctx, userID),
+		f.storage.AddNewUserFilePair(ctx, userID, fileName),
+		f.storage.AddNewProcessingEntry(ctx, fileName, barcode),
+		f.storage.UpdateProcessingStatus(ctx, fileName, constants.ProcessingStatusDone),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// upload uploads a result without recording it.
+func (f *cleanupFixture) upload(t *testing.T, key string) {
+	t.Helper()
+	local := filepath.Join(t.TempDir(), filepath.Base(key))
+	if err := os.WriteFile(local, []byte(key), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.s3.UploadFile(local, key, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// keys returns the keys of the results in the bucket.
+func (f *cleanupFixture) keys(t *testing.T) map[string]bool {
+	t.Helper()
+	objects, err := f.s3.ListResults("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		keys[object.Key] = true
+	}
+	return keys
+}
+
+// artifactKeys returns the keys of artifacts among removed objects.
+func artifactKeys(objects []storageModels.DeletionAudit) map[string]bool {
+	keys := make(map[string]bool)
+	for _, object := range objects {
+		if object.Kind == constants.ObjectKindArtifact {
+			keys[object.Key] = true
+		}
+	}
+	return keys
+}
+
+func TestDeleteUserRemovesUnrecordedResults(t *testing.T) {
+	f := newCleanupFixture(t, "")
+	ctx := context.Background()
+	f.processed(t, "user", "file.txt", "B1")
+	f.processed(t, "other", "other.txt", "B2")
+	f.upload(t, "internal/B1.txt")
+	f.upload(t, "binary/B1.bed")
+	f.upload(t, "internal/B2.txt")
+	f.upload(t, "binary/recorded.bed")
+	err := f.storage.AddArtifacts(ctx, []storageModels.Artifact{{
+		UserID:   "user",
+		FileName: "recorded.txt",
+		Barcode:  "B0",
+		Bucket:   f.cfg.S3Storage.Bucket,
+		Key:      "binary/recorded.bed",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"internal/B1.txt", "binary/B1.bed", "binary/recorded.bed"}
+
+	planned, err := f.agent.DeleteUser(ctx, "user", "test", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plannedKeys := artifactKeys(planned)
+	if len(plannedKeys) != len(expected) {
+		t.Errorf("expected %d artifacts to be removed, got %+v", len(expected), planned)
+	}
+	for _, key := range expected {
+		if !plannedKeys[key] {
+			t.Errorf("%s is not listed by the dry run", key)
+		}
+	}
+	if keys := f.keys(t); len(keys) != 4 {
+		t.Fatalf("dry run removed objects, left %v", keys)
+	}
+
+	removed, err := f.agent.DeleteUser(ctx, "user", "test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != len(planned) {
+		t.Errorf("expected %d removed objects, got %+v", len(planned), removed)
+	}
+	keys := f.keys(t)
+	for _, key := range expected {
+		if keys[key] {
+			t.Errorf("%s was not removed", key)
+		}
+	}
+	if !keys["internal/B2.txt"] {
+		t.Error("result of another user was removed")
+	}
+	var notFound *storageErrors.NotFoundError
+	if err = f.storage.CheckUserID(ctx, "user"); !goErrors.As(err, &notFound) {
+		t.Errorf("expected the user to be removed, got %v", err)
+	}
+}
+
+func TestDeleteUserRefusesUnidentifiedKeys(t *testing.T) {
+	manifest := filepath.Join(t.TempDir(), "manifest.json")
+	err := os.WriteFile(manifest, []byte(`[{"glob": "out/*", "key": "results/{{.Name}}", "required": true}]`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newCleanupFixture(t, manifest)
+	ctx := context.Background()
+	f.processed(t, "user", "file.txt", "B1")
+	f.upload(t, "results/B1.txt")
+
+	for _, dryRun := range []bool{true, false} {
+		if _, err = f.agent.DeleteUser(ctx, "user", "test", dryRun); err == nil {
+			t.Errorf("expected deletion to fail with dry run %v", dryRun)
+		}
+	}
+	if !f.keys(t)["results/B1.txt"] {
+		t.Error("result was removed")
+	}
+	if err = f.storage.CheckUserID(ctx, "user"); err != nil {
+		t.Errorf("user data was removed: %v", err)
+	}
+}
@@ -3,17 +3,32 @@
 package errors
 
 const (
-	ValidationRunError           = "could not run validation"
-	ProcessingRunError           = "could not run processing"
-	AddingUserError              = "could not add user to DB"
-	UserNotFoundError            = "could not find userID in DB"
-	FileNotFoundError            = "could not find file name in DB"
-	InvalidFileError             = "file is not valid"
-	GettingProcessingStatusError = "could not find processing status in DB"
-	GettingProductCodeError      = "could not find product code in DB"
-	AddingFileError              = "could not add a new file name"
-	AddingValidationEntryError   = "could not add a new validation entry"
-	AddingProcessingEntryError   = "could not add a new processing entry"
-	AddingProductCodeError       = "could not add a new product code"
-	ProcessingInProgressError    = "processing is currently running and locked"
+	ValidationRunError            = "could not run validation"
+	ProcessingRunError            = "could not run processing"
+	AddingUserError               = "could not add user to DB"
+	UserNotFoundError             = "could not find userID in DB"
+	FileNotFoundError             = "could not find file name in DB"
+	InvalidFileError              = "file is not valid"
+	GettingProcessingStatusError  = "could not find processing status in DB"
+	GettingProductCodeError       = "could not find product code in DB"
+	GettingUploadsError           = "could not find uploads in DB"
+	GettingValidationResultError  = "could not find validation result in DB"
+	AddingFileError               = "could not add a new file name"
+	AddingValidationEntryError    = "could not add a new validation entry"
+	AddingProcessingEntryError    = "could not add a new processing entry"
+	AddingProductCodeError        = "could not add a new product code"
+	ProcessingInProgressError     = "processing is currently running and locked"
+	SavingValidationResultError   = "could not save validation result"
+	UpdatingProcessingStatusError = "could not update processing status"
+	SendingHeartbeatError         = "could not extend job lease"
+	AddingOutboxMessageError      = "could not save a status message to the outbox"
+	AddingProcessedMessageError   = "could not record a processed message"
+	GettingProcessedMessageError  = "could not get a processed message from DB"
+	GettingArtifactsError         = "could not find artifacts in DB"
+	AddingArtifactsError          = "could not record artifacts"
+	RemovingArtifactError         = "could not remove an artifact"
+	RemovingSourceError           = "could not remove a source file"
+	RemovingUserDataError         = "could not remove user data"
+	ForeignBucketError            = "artifact is not in the configured bucket"
+	FindingUnrecordedError        = "could not find unrecorded results in S3"
 )
@@ -2,6 +2,8 @@
 
 package modeldto
 
+import "time"
+
 type (
 	RequestGetByUserID struct {
 		UserID string `json:"user_id"`
@@ -14,4 +16,27 @@ type (
 	ResponseProcessingStatus struct {
 		Status string `json:"current_status" example:"done"`
 	}
+
+	ResponseValidation struct {
+		FileName  string    `json:"file_name" example:"some_file.txt"`
+		Status    string    `json:"status" example:"valid"`
+		Mode      string    `json:"mode" example:"tsv"`
+		Sex       string    `json:"sex" example:"male"`
+		Err       string    `json:"error" example:""`
+		Passed    bool      `json:"passed" example:"true"`
+		UpdatedAt time.Time `json:"updated_at" example:"2023-07-20T12:00:00Z"`
+	}
+
+	ResponseUpload struct {
+		FileName         string    `json:"file_name" example:"some_file.txt"`
+		IsCurrent        bool      `json:"is_current" example:"true"`
+		CreatedAt        time.Time `json:"created_at" example:"2023-07-20T12:00:00Z"`
+		ValidationStatus string    `json:"validation_status" example:"valid"`
+		Barcode          string    `json:"barcode" example:"0000-0000"`
+		ProcessingStatus string    `json:"processing_status" example:"done"`
+	}
+
+	ResponseUploads struct {
+		Uploads []ResponseUpload `json:"uploads"`
+	}
 )
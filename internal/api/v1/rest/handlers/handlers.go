@@ -23,7 +23,7 @@ import (
 	"upload-service-auto/internal/api/v1/errors"
 	"upload-service-auto/internal/api/v1/modeldto"
 	"upload-service-auto/internal/config"
-	"upload-service-auto/internal/storage/v1/psql"
+	"upload-service-auto/internal/storage"
 
 	"github.com/rs/zerolog"
 )
@@ -37,7 +37,7 @@ const (
 type EndpointHandlers struct {
 	log     *zerolog.Logger
 	cfg     *config.Config
-	storage *psql.Storage
+	storage storage.Storage
 	agent   *agent.Agent
 }
 
@@ -45,7 +45,7 @@ type EndpointHandlers struct {
 func NewEndpointHandlers(
 	cfg *config.Config,
 	logger *zerolog.Logger,
-	storage *psql.Storage,
+	storage storage.Storage,
 	agent *agent.Agent,
 ) *EndpointHandlers {
 	logger.Debug().Msg("calling initializer of HTTP handling service")
@@ -137,3 +137,107 @@ func (h *EndpointHandlers) GetProductCodeHandle(w http.ResponseWriter, r *http.R
 	_, _ = w.Write(resBody)
 	h.log.Info().Str(handlerKey, handler).Msg("response sent")
 }
+
+// GetValidationResultHandle handles requests to get validation result of a user.
+// @summary Get validation result request
+// @desc Get validation result of the current upload for a user ID
+// @id getValidationResult
+// @accept x-www-form-urlencoded
+// @produce json
+// @param userID path string true "User ID to get validation result for"
+// @success 200 {object} modeldto.ResponseValidation
+// @failure 400 {string} Bad request
+// @failure 500 {string} Internal Server Error
+// @failure 404 {string} Not found
+// @failure 417 {string} Expectation failed
+// @router /api/v1/validation/{userID} [get]
+func (h *EndpointHandlers) GetValidationResultHandle(w http.ResponseWriter, r *http.Request) {
+	const handler = "get-validation-result"
+
+	h.log.Info().Str(handlerKey, handler).Msg(fmt.Sprintf("HTTP: %s endpoint hit", handler))
+
+	ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
+	defer cancel()
+
+	userID := chi.URLParam(r, "userID")
+
+	validation, httpStatus, errorCode := h.agent.GetValidationResult(ctx, userID, handler)
+	if validation == nil {
+		http.Error(w, errorCode, httpStatus)
+		return
+	}
+
+	responseValidation := modeldto.ResponseValidation{
+		FileName:  validation.FileName,
+		Status:    validation.Status,
+		Mode:      validation.Mode,
+		Sex:       validation.Sex,
+		Err:       validation.Err,
+		Passed:    validation.Passed,
+		UpdatedAt: validation.UpdatedAt,
+	}
+	resBody, err := json.Marshal(responseValidation)
+	if err != nil {
+		h.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.MarshallingError)
+		http.Error(w, errors.MarshallingError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(resBody)
+	h.log.Info().Str(handlerKey, handler).Str(userIDKey, userID).Msg("response sent")
+}
+
+// GetUserUploadsHandle handles requests to get upload history of a user.
+// @summary Get upload history request
+// @desc Get all uploads for a user ID in time order
+// @id getUserUploads
+// @accept x-www-form-urlencoded
+// @produce json
+// @param userID path string true "User ID to get upload history for"
+// @success 200 {object} modeldto.ResponseUploads
+// @failure 400 {string} Bad request
+// @failure 500 {string} Internal Server Error
+// @failure 404 {string} Not found
+// @failure 417 {string} Expectation failed
+// @router /api/v1/users/{userID}/uploads [get]
+func (h *EndpointHandlers) GetUserUploadsHandle(w http.ResponseWriter, r *http.Request) {
+	const handler = "get-user-uploads"
+
+	h.log.Info().Str(handlerKey, handler).Msg(fmt.Sprintf("HTTP: %s endpoint hit", handler))
+
+	ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
+	defer cancel()
+
+	userID := chi.URLParam(r, "userID")
+
+	uploads, httpStatus, errorCode := h.agent.GetUserUploads(ctx, userID, handler)
+	if errorCode != "" {
+		http.Error(w, errorCode, httpStatus)
+		return
+	}
+
+	responseUploads := modeldto.ResponseUploads{Uploads: make([]modeldto.ResponseUpload, 0, len(uploads))}
+	for _, upload := range uploads {
+		responseUploads.Uploads = append(responseUploads.Uploads, modeldto.ResponseUpload{
+			FileName:         upload.FileName,
+			IsCurrent:        upload.IsCurrent,
+			CreatedAt:        upload.CreatedAt,
+			ValidationStatus: upload.ValidationStatus,
+			Barcode:          upload.Barcode,
+			ProcessingStatus: upload.ProcessingStatus,
+		})
+	}
+	resBody, err := json.Marshal(responseUploads)
+	if err != nil {
+		h.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.MarshallingError)
+		http.Error(w, errors.MarshallingError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(resBody)
+	h.log.Info().Str(handlerKey, handler).Str(userIDKey, userID).Msg("response sent")
+}
@@ -4,10 +4,14 @@ package amqp
 
 import (
 	"context"
-	"encoding/json"
+	stdErrors "errors"
+	"sync"
+	"time"
+	"upload-service-auto/internal/bus/dispatch"
 	"upload-service-auto/internal/bus/errors"
 	"upload-service-auto/internal/bus/modelbus"
 	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/metrics"
 	"upload-service-auto/internal/syncutils"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -15,11 +19,20 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
-// AMQP defines queue client object and sets its attributes.
+// processingConsumerTimeout limits the time a processing delivery stays unacknowledged, including the time it waits
+// for a worker, RabbitMQ closes the channel of a consumer exceeding it and requeues all of its deliveries.
+const processingConsumerTimeout = 6 * time.Hour
+
+// AMQP defines queue client object and sets its attributes. The connection is recovered by a supervisor once it is
+// lost, the connection and its channel are nil while it is being recovered.
 type AMQP struct {
 	config          *config.Config
 	log             *zerolog.Logger
+	mu              sync.RWMutex
+	conn            *amqp.Connection
 	channel         *amqp.Channel
+	ready           chan struct{}
+	lost            chan struct{}
 	validationQueue *amqp.Queue
 	processingQueue *amqp.Queue
 	rrsQueue        *amqp.Queue
@@ -33,6 +46,7 @@ func NewAMQP(config *config.Config, logger *zerolog.Logger, syncUtils *syncutils
 		config:    config,
 		log:       logger,
 		syncUtils: syncUtils,
+		ready:     make(chan struct{}),
 	}
 	if err := t.init(); err != nil {
 		t.log.Fatal().Err(err).Msg(errors.AMQPInitiationError)
@@ -40,9 +54,24 @@ func NewAMQP(config *config.Config, logger *zerolog.Logger, syncUtils *syncutils
 	return t
 }
 
-// init performs declaration and bindings of queues and exchanges.
+// init connects to AMQP and starts the connection supervisor.
 func (a *AMQP) init() error {
 	a.log.Debug().Msg("calling `init` method")
+	if err := a.connect(); err != nil {
+		return err
+	}
+
+	a.syncUtils.Wg.Add(1)
+	go func() {
+		defer a.syncUtils.Wg.Done()
+		a.supervise()
+	}()
+	return nil
+}
+
+// connect dials AMQP, declares the topology and makes the connection available to publishers and consumers.
+func (a *AMQP) connect() error {
+	a.log.Debug().Msg("calling `connect` method")
 	conn, err := amqp.Dial(a.config.AMQP.Addr)
 	if err != nil {
 		a.log.Error().Err(err).Msg(errors.AMQPConnectionError)
@@ -50,17 +79,38 @@ func (a *AMQP) init() error {
 	}
 
 	channel, err := conn.Channel()
-	a.channel = channel
 	if err != nil {
 		a.log.Error().Err(err).Msg(errors.AMQPChannelOpeningError)
+		_ = conn.Close()
 		return err
 	}
 
-	if err = channel.Qos(1, 0, false); err != nil {
-		a.log.Error().Err(err).Msg(errors.AMQPSettingQosError)
+	// the broker confirms every message published on the channel
+	if err = channel.Confirm(false); err != nil {
+		a.log.Error().Err(err).Msg(errors.AMQPConfirmModeError)
+		_ = conn.Close()
 		return err
 	}
 
+	if err = a.declare(channel); err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	a.mu.Lock()
+	a.conn = conn
+	a.channel = channel
+	a.lost = make(chan struct{})
+	close(a.ready)
+	a.mu.Unlock()
+	metrics.AMQPConnected.Set(1)
+	a.log.Info().Msg("AMQP: connected")
+	return nil
+}
+
+// declare performs declaration and bindings of queues and exchanges.
+func (a *AMQP) declare(channel *amqp.Channel) error {
+	a.log.Debug().Msg("calling `declare` method")
 	var (
 		validationQueue amqp.Queue
 		processingQueue amqp.Queue
@@ -70,28 +120,28 @@ func (a *AMQP) init() error {
 
 	{ // exchange declaration
 		waitGroup.Go(func() error {
-			if err = channel.ExchangeDeclare(a.config.AMQP.ValidationExchangeInputName,
+			if err := channel.ExchangeDeclare(a.config.AMQP.ValidationExchangeInputName,
 				"fanout", true, false, false, false, nil); err != nil {
 				return err
 			}
 			return nil
 		})
 		waitGroup.Go(func() error {
-			if err = channel.ExchangeDeclare(a.config.AMQP.ValidationExchangeOutputName,
+			if err := channel.ExchangeDeclare(a.config.AMQP.ValidationExchangeOutputName,
 				"fanout", true, false, false, false, nil); err != nil {
 				return err
 			}
 			return nil
 		})
 		waitGroup.Go(func() error {
-			if err = channel.ExchangeDeclare(a.config.AMQP.ProcessingExchangeInputName,
+			if err := channel.ExchangeDeclare(a.config.AMQP.ProcessingExchangeInputName,
 				"fanout", true, false, false, false, nil); err != nil {
 				return err
 			}
 			return nil
 		})
 		waitGroup.Go(func() error {
-			if err = channel.ExchangeDeclare(a.config.AMQP.ProcessingExchangeOutputName,
+			if err := channel.ExchangeDeclare(a.config.AMQP.ProcessingExchangeOutputName,
 				"fanout", true, false, false, false, nil); err != nil {
 				return err
 			}
@@ -104,7 +154,7 @@ func (a *AMQP) init() error {
 	}
 
 	{ // queue declaration
-		waitGroup.Go(func() error {
+		waitGroup.Go(func() (err error) {
 			if validationQueue, err = channel.QueueDeclare(a.config.AMQP.ValidationQueueName,
 				false, false, false, false, amqp.Table{}); err != nil {
 				return err
@@ -112,17 +162,15 @@ func (a *AMQP) init() error {
 			a.validationQueue = &validationQueue
 			return nil
 		})
-		waitGroup.Go(func() error {
+		waitGroup.Go(func() (err error) {
 			if processingQueue, err = channel.QueueDeclare(a.config.AMQP.ProcessingQueueName,
-				false, false, false, false, amqp.Table{
-					"x-consumer-timeout": 21600000,
-				}); err != nil {
+				false, false, false, false, a.processingArgs()); err != nil {
 				return err
 			}
 			a.processingQueue = &processingQueue
 			return nil
 		})
-		waitGroup.Go(func() error {
+		waitGroup.Go(func() (err error) {
 			if rrsQueue, err = channel.QueueDeclare(a.config.AMQP.RRSQueueName,
 				false, false, false, false, amqp.Table{}); err != nil {
 				return err
@@ -138,53 +186,228 @@ func (a *AMQP) init() error {
 
 	{ // queue binding
 		waitGroup.Go(func() error {
-			if err = channel.QueueBind(processingQueue.Name,
+			if err := channel.QueueBind(processingQueue.Name,
 				"", a.config.AMQP.ProcessingExchangeInputName, false, nil); err != nil {
 				return err
 			}
 			return nil
 		})
 		waitGroup.Go(func() error {
-			if err = channel.QueueBind(validationQueue.Name,
+			if err := channel.QueueBind(validationQueue.Name,
 				"", a.config.AMQP.ValidationExchangeInputName, false, nil); err != nil {
 				return err
 			}
 			return nil
 		})
 		waitGroup.Go(func() error {
-			if err = channel.QueueBind(rrsQueue.Name,
+			if err := channel.QueueBind(rrsQueue.Name,
 				"", a.config.AMQP.ValidationExchangeOutputName, false, nil); err != nil {
 				return err
 			}
 			return nil
 		})
 		waitGroup.Go(func() error {
-			if err = channel.QueueBind(rrsQueue.Name,
+			if err := channel.QueueBind(rrsQueue.Name,
 				"", a.config.AMQP.ProcessingExchangeOutputName, false, nil); err != nil {
 				return err
 			}
 			return nil
 		})
+		if err := waitGroup.Wait(); err != nil {
+			a.log.Error().Err(err).Msg(errors.AMQPQueueBindingError)
+			return err
+		}
 	}
 
-	a.syncUtils.Wg.Add(1)
-	go func() {
-		defer a.syncUtils.Wg.Done()
-		<-a.syncUtils.Ctx.Done()
-		err = conn.Close()
-		if err != nil {
-			a.log.Fatal().Err(err).Msg("could not close AMQP connection")
+	{ // retry queues and dead-letter queue declaration
+		if err := a.declareRetry(channel, validationQueue.Name); err != nil {
+			return err
 		}
-		a.log.Debug().Msg("AMQP connection was closed")
-	}()
+		if err := a.declareRetry(channel, processingQueue.Name); err != nil {
+			return err
+		}
+		if err := a.declareDeadLetter(channel); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// PublishToExchange publishes a message to the specified exchange.
-func (a *AMQP) PublishToExchange(exchange string, msg amqp.Publishing) error {
-	a.log.Debug().Msg("calling `PublishToExchange` method")
+// supervise waits for the connection or its publishing channel to close and reconnects, the connection is closed
+// once the shared context is done.
+func (a *AMQP) supervise() {
+	a.log.Debug().Msg("calling `supervise` method")
+	for {
+		a.mu.RLock()
+		conn, channel := a.conn, a.channel
+		a.mu.RUnlock()
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		channelClosed := channel.NotifyClose(make(chan *amqp.Error, 1))
+
+		select {
+		case <-a.syncUtils.Ctx.Done():
+			metrics.AMQPConnected.Set(0)
+			if err := conn.Close(); err != nil && err != amqp.ErrClosed {
+				a.log.Error().Err(err).Msg(errors.AMQPClosingError)
+				return
+			}
+			a.log.Debug().Msg("AMQP connection was closed")
+			return
+		case err := <-connClosed:
+			a.log.Warn().Err(err).Msg(errors.AMQPConnectionLostError)
+		case err := <-channelClosed:
+			a.log.Warn().Err(err).Msg(errors.AMQPConnectionLostError)
+			_ = conn.Close()
+		}
+
+		a.mu.Lock()
+		a.conn = nil
+		a.channel = nil
+		a.ready = make(chan struct{})
+		close(a.lost)
+		a.mu.Unlock()
+		metrics.AMQPConnected.Set(0)
+
+		if !a.reconnect() {
+			return
+		}
+	}
+}
+
+// reconnect tries to connect with exponential backoff until it succeeds or the shared context is done.
+func (a *AMQP) reconnect() bool {
+	a.log.Debug().Msg("calling `reconnect` method")
+	delay := a.config.AMQP.ReconnectMinDelay
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-a.syncUtils.Ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+
+		metrics.AMQPReconnectAttempts.Add(1)
+		a.log.Info().Int("attempt", attempt).Dur("delay", delay).Msg("AMQP: reconnecting")
+		if err := a.connect(); err == nil {
+			metrics.AMQPReconnects.Add(1)
+			a.log.Info().Int("attempt", attempt).Msg("AMQP: reconnected")
+			return true
+		}
+
+		delay *= 2
+		if delay > a.config.AMQP.ReconnectMaxDelay {
+			delay = a.config.AMQP.ReconnectMaxDelay
+		}
+	}
+}
+
+// connection waits for an open connection and returns it along with its publishing channel and a channel closed once
+// the connection is lost.
+func (a *AMQP) connection(ctx context.Context) (*amqp.Connection, *amqp.Channel, chan struct{}, error) {
+	for {
+		a.mu.RLock()
+		conn, channel, ready, lost := a.conn, a.channel, a.ready, a.lost
+		a.mu.RUnlock()
+		if conn != nil {
+			return conn, channel, lost, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, nil, ctx.Err()
+		case <-ready:
+		}
+	}
+}
+
+// publishConfirmed publishes a message on a channel in confirm mode and waits for the broker to confirm it.
+func (a *AMQP) publishConfirmed(channel *amqp.Channel, exchange, key string, msg amqp.Publishing) error {
+	ctx, cancel := context.WithTimeout(a.syncUtils.Ctx, a.config.AMQP.ConfirmTimeout)
+	defer cancel()
 
-	if err := a.channel.PublishWithContext(a.syncUtils.Ctx, exchange, "", false, false, msg); err != nil {
+	confirmation, err := channel.PublishWithDeferredConfirmWithContext(ctx, exchange, key, false, false, msg)
+	if err != nil {
+		return err
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		a.log.Error().Err(err).Str("exchange", exchange).Msg(errors.AMQPConfirmTimeoutError)
+		return err
+	}
+	if !acked {
+		return stdErrors.New(errors.AMQPPublishingNackedError)
+	}
+	return nil
+}
+
+// processingArgs returns arguments of the processing queue, it is a priority queue unless the maximum priority is 0.
+// Arguments of an existing queue cannot be changed, so the queue has to be deleted once its maximum priority changes.
+func (a *AMQP) processingArgs() amqp.Table {
+	args := amqp.Table{
+		// encoded as a 32-bit integer as the queue was declared with, so that existing queues can still be declared
+		"x-consumer-timeout": int(processingConsumerTimeout.Milliseconds()),
+	}
+	if a.config.AMQP.ProcessingMaxPriority > 0 {
+		args["x-max-priority"] = a.config.AMQP.ProcessingMaxPriority
+	}
+	return args
+}
+
+// publishing converts a message to an AMQP message.
+func publishing(msg modelbus.Message) amqp.Publishing {
+	return amqp.Publishing{
+		ContentType:   msg.ContentType,
+		MessageId:     msg.MessageID,
+		CorrelationId: msg.CorrelationID,
+		Timestamp:     msg.Timestamp,
+		Priority:      msg.Priority,
+		Headers:       amqp.Table(msg.Headers),
+		Body:          msg.Body,
+	}
+}
+
+// message converts an AMQP delivery to a message.
+func message(delivery *amqp.Delivery) modelbus.Message {
+	return modelbus.Message{
+		ContentType:   delivery.ContentType,
+		MessageID:     delivery.MessageId,
+		CorrelationID: delivery.CorrelationId,
+		Timestamp:     delivery.Timestamp,
+		Priority:      delivery.Priority,
+		Headers:       delivery.Headers,
+		Body:          delivery.Body,
+	}
+}
+
+// acknowledger settles an AMQP delivery.
+type acknowledger struct {
+	delivery *amqp.Delivery
+}
+
+// Ack acknowledges the delivery.
+func (a *acknowledger) Ack() error {
+	return a.delivery.Ack(false)
+}
+
+// Nack rejects the delivery returning it to its queue if requeue is set.
+func (a *acknowledger) Nack(requeue bool) error {
+	return a.delivery.Nack(false, requeue)
+}
+
+// publish publishes a message to an exchange with a routing key and waits for the broker to confirm it, it waits for
+// the connection to be recovered if it is lost.
+func (a *AMQP) publish(exchange, key string, msg amqp.Publishing) error {
+	_, channel, _, err := a.connection(a.syncUtils.Ctx)
+	if err != nil {
+		return err
+	}
+	return a.publishConfirmed(channel, exchange, key, msg)
+}
+
+// Publish publishes a message to the specified exchange and waits for the broker to confirm it, it waits for the
+// connection to be recovered if it is lost.
+func (a *AMQP) Publish(exchange string, msg modelbus.Message) error {
+	a.log.Debug().Msg("calling `Publish` method")
+
+	if err := a.publish(exchange, "", publishing(msg)); err != nil {
 		a.log.Error().Err(err).Msg(errors.AMQPPublishingError)
 		return err
 	}
@@ -194,83 +417,91 @@ func (a *AMQP) PublishToExchange(exchange string, msg amqp.Publishing) error {
 	return nil
 }
 
-// AddInterpretationQueueListener is a middleware method for handling different AMQP handlers.
-func (a *AMQP) AddInterpretationQueueListener(ctx context.Context, republish bool, queueName, exchangeName, exchangeNameOut, runType string, fn func(ctx context.Context, d *amqp.Delivery) (string, string, bool, error)) error {
-	messages, err := a.channel.Consume(queueName,
-		"", false, false, false, false, nil)
+// Consume is a middleware method for handling different AMQP handlers. Deliveries are handled by the given number of
+// workers sharing a dedicated channel, deliveries prefetched beyond the number of workers are scheduled by priority and
+// fairly among producers. Failed messages are retried after
+// a delay and moved to the dead-letter queue once the attempts are exhausted. The consumer is resumed once its
+// channel or the connection is lost until the context is done.
+func (a *AMQP) Consume(ctx context.Context, consumer modelbus.Consumer, fn modelbus.HandlerFunc) error {
+	if consumer.Workers < 1 {
+		consumer.Workers = 1
+	}
+	for {
+		conn, _, lost, err := a.connection(ctx)
+		if err != nil {
+			return nil
+		}
+
+		err = a.consume(ctx, conn, consumer, fn)
+		if ctx.Err() != nil {
+			a.log.Info().Str("queue", consumer.Queue).Msg("AMQP: consumer stopped")
+			return nil
+		}
+		metrics.AMQPConsumerRestarts.Add(1)
+		a.log.Warn().Err(err).Str("queue", consumer.Queue).Msg(errors.AMQPConsumerLostError)
+
+		// the consumer waits for a new connection if the current one is lost, otherwise it is resumed on the same
+		// connection after a delay
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-lost:
+		case <-time.After(a.config.AMQP.ReconnectMinDelay):
+		}
+	}
+}
+
+// consume handles deliveries of a queue on a dedicated channel until the channel is closed, a worker fails or the
+// context is done. The prefetch of the channel matches the prefetch of the consumer.
+func (a *AMQP) consume(ctx context.Context, conn *amqp.Connection, consumer modelbus.Consumer, fn modelbus.HandlerFunc) error {
+	a.log.Debug().Msg("calling `consume` method")
+	channel, err := conn.Channel()
 	if err != nil {
-		a.log.Error().Err(err).Msg(errors.AMQPConsumingError)
+		a.log.Error().Err(err).Msg(errors.AMQPChannelOpeningError)
 		return err
 	}
+	defer channel.Close()
 
-	var waitGroup errgroup.Group
-	waitGroup.Go(func() error {
-		for delivery := range messages {
-			a.log.Debug().Str("body", string(delivery.Body)).Msg("AMQP: received message")
-
-			userID, fileName, status, fnErr := fn(ctx, &delivery)
-			if fnErr == nil {
-				if ackErr := delivery.Ack(false); ackErr != nil {
-					a.log.Error().Err(err).Msg(errors.AMQPAckError)
-					return err
-				}
-			} else {
-				a.log.Warn().Msg(errors.AMQPMessageProcessingError)
-				if ackErr := delivery.Ack(false); ackErr != nil {
-					a.log.Error().Err(err).Msg(errors.AMQPAckError)
-					return err
-				}
-
-				if republish {
-					retryMsg := amqp.Publishing{
-						ContentType: delivery.ContentType,
-						Headers:     delivery.Headers,
-						Body:        delivery.Body,
-					}
-
-					err := a.PublishToExchange(exchangeName, retryMsg)
-					if err != nil {
-						a.log.Error().Err(err).Msg(errors.AMQPSendingError)
-						return err
-					}
-				}
-			}
+	prefetch := consumer.Prefetch
+	if prefetch < consumer.Workers {
+		prefetch = consumer.Workers
+	}
+	if consumer.Queue == a.config.AMQP.ProcessingQueueName && prefetch > consumer.Workers {
+		a.log.Warn().Int("prefetch", prefetch).Int("workers", consumer.Workers).
+			Dur("consumer_timeout", processingConsumerTimeout).
+			Msg("deliveries waiting for a worker count towards the consumer timeout, jobs they wait for have to finish within it")
+	}
+	if err = channel.Qos(prefetch, 0, false); err != nil {
+		a.log.Error().Err(err).Msg(errors.AMQPSettingQosError)
+		return err
+	}
 
-			// send status to rrs
-			msg := modelbus.Rsp{
-				UserID:   userID,
-				FileName: fileName,
-				RspType:  runType,
-				IsReady:  status,
-			}
+	messages, err := channel.Consume(consumer.Queue,
+		"", false, false, false, false, nil)
+	if err != nil {
+		a.log.Error().Err(err).Msg(errors.AMQPConsumingError)
+		return err
+	}
 
-			serialized, err := json.Marshal(msg)
-			if err != nil {
-				a.log.Error().Err(err).Msg(errors.AMQPMarshallingError)
-				return err
-			}
+	a.log.Info().Str("queue", consumer.Queue).Int("workers", consumer.Workers).Int("prefetch", prefetch).Msg("AMQP: consumer started")
 
-			publishing := amqp.Publishing{
-				ContentType: "application/json",
-				Headers:     amqp.Table{},
-				Body:        serialized,
-			}
-			err = a.PublishToExchange(exchangeNameOut, publishing)
-			if err != nil {
-				a.log.Error().Err(err).Msg(errors.AMQPSendingError)
-				return err
+	err = dispatch.Serve(ctx, a.log, a, consumer, fn, func(ctx context.Context) (*modelbus.Delivery, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case delivery, ok := <-messages:
+			if !ok {
+				return nil, amqp.ErrClosed
 			}
-
+			return &modelbus.Delivery{
+				Message:      message(&delivery),
+				Acknowledger: &acknowledger{delivery: &delivery},
+			}, nil
 		}
-		return nil
 	})
-
-	a.log.Info().Msg("AMQP: consumer started")
-
-	if err := waitGroup.Wait(); err != nil {
+	if err != nil {
 		a.log.Error().Err(err).Msg(errors.AMQPListeningError)
 		return err
 	}
-
 	return nil
 }
@@ -0,0 +1,162 @@
+// Package amqp implements AMQP service.
+
+package amqp
+
+import (
+	"fmt"
+	"upload-service-auto/internal/bus/errors"
+	"upload-service-auto/internal/bus/modelbus"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// retryQueueName returns a name of a queue delaying the given retry of messages of a queue.
+func retryQueueName(queueName string, retry int) string {
+	return fmt.Sprintf("%s.retry.%d", queueName, retry)
+}
+
+// declareRetry declares queues delaying retries of messages of a queue, every queue holds messages for its delay and
+// returns them to the queue afterwards. The last delay is used for all further retries.
+func (a *AMQP) declareRetry(channel *amqp.Channel, queueName string) error {
+	a.log.Debug().Msg("calling `declareRetry` method")
+	for i, delay := range a.config.AMQP.RetryDelays {
+		_, err := channel.QueueDeclare(retryQueueName(queueName, i+1),
+			false, false, false, false, amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": queueName,
+			})
+		if err != nil {
+			a.log.Error().Err(err).Msg(errors.AMQPQueueDeclarationError)
+			return err
+		}
+	}
+	return nil
+}
+
+// declareDeadLetter declares the dead-letter exchange and queue, the queue is durable to keep failed messages until
+// they are replayed.
+func (a *AMQP) declareDeadLetter(channel *amqp.Channel) error {
+	a.log.Debug().Msg("calling `declareDeadLetter` method")
+	if err := channel.ExchangeDeclare(a.config.AMQP.DeadLetterExchangeName,
+		"fanout", true, false, false, false, nil); err != nil {
+		a.log.Error().Err(err).Msg(errors.AMQPExchangeDeclarationError)
+		return err
+	}
+	if _, err := channel.QueueDeclare(a.config.AMQP.DeadLetterQueueName,
+		true, false, false, false, amqp.Table{}); err != nil {
+		a.log.Error().Err(err).Msg(errors.AMQPQueueDeclarationError)
+		return err
+	}
+	if err := channel.QueueBind(a.config.AMQP.DeadLetterQueueName,
+		"", a.config.AMQP.DeadLetterExchangeName, false, nil); err != nil {
+		a.log.Error().Err(err).Msg(errors.AMQPQueueBindingError)
+		return err
+	}
+	return nil
+}
+
+// Delay puts a message back to a queue through the retry queue of the given retry, the last delay is used for all
+// further retries. Without delays the message is returned to its queue at once.
+func (a *AMQP) Delay(queueName string, retry int, msg modelbus.Message) error {
+	a.log.Debug().Msg("calling `Delay` method")
+	key := queueName
+	if delays := len(a.config.AMQP.RetryDelays); delays > 0 {
+		if retry > delays {
+			retry = delays
+		}
+		key = retryQueueName(queueName, retry)
+	}
+	return a.publish("", key, publishing(msg))
+}
+
+// DeadLetter moves a message to the dead-letter exchange.
+func (a *AMQP) DeadLetter(msg modelbus.Message) error {
+	a.log.Debug().Msg("calling `DeadLetter` method")
+	dead := publishing(msg)
+	dead.DeliveryMode = amqp.Persistent
+	return a.publish(a.config.AMQP.DeadLetterExchangeName, "", dead)
+}
+
+// browseDeadLetters returns up to limit messages of the dead-letter queue fn returns true for, all of them are returned
+// if limit is 0. The returned messages are removed from the queue if ack is set, the rest are left in the queue.
+func (a *AMQP) browseDeadLetters(limit int, ack bool, fn func(channel *amqp.Channel, delivery *amqp.Delivery, letter *modelbus.DeadLetter) (bool, error)) ([]modelbus.DeadLetter, error) {
+	a.log.Debug().Msg("calling `browseDeadLetters` method")
+	conn, _, _, err := a.connection(a.syncUtils.Ctx)
+	if err != nil {
+		a.log.Error().Err(err).Msg(errors.AMQPDeadLetterReadingError)
+		return nil, err
+	}
+	// unacknowledged messages are returned to the queue once the channel is closed
+	channel, err := conn.Channel()
+	if err != nil {
+		a.log.Error().Err(err).Msg(errors.AMQPChannelOpeningError)
+		return nil, err
+	}
+	defer channel.Close()
+	if err = channel.Confirm(false); err != nil {
+		a.log.Error().Err(err).Msg(errors.AMQPConfirmModeError)
+		return nil, err
+	}
+
+	var letters []modelbus.DeadLetter
+	for limit == 0 || len(letters) < limit {
+		delivery, ok, err := channel.Get(a.config.AMQP.DeadLetterQueueName, false)
+		if err != nil {
+			a.log.Error().Err(err).Msg(errors.AMQPDeadLetterReadingError)
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		msg := message(&delivery)
+		letter := modelbus.NewDeadLetter(&msg)
+		matched, err := fn(channel, &delivery, &letter)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+		if ack {
+			if err = delivery.Ack(false); err != nil {
+				a.log.Error().Err(err).Msg(errors.AMQPAckError)
+				return nil, err
+			}
+		}
+		letters = append(letters, letter)
+		if delivery.MessageCount == 0 {
+			break
+		}
+	}
+	return letters, nil
+}
+
+// ListDeadLetters returns up to limit messages of the dead-letter queue leaving them in the queue, all messages are
+// returned if limit is 0.
+func (a *AMQP) ListDeadLetters(limit int) ([]modelbus.DeadLetter, error) {
+	a.log.Debug().Msg("calling `ListDeadLetters` method")
+	return a.browseDeadLetters(limit, false, func(*amqp.Channel, *amqp.Delivery, *modelbus.DeadLetter) (bool, error) {
+		return true, nil
+	})
+}
+
+// ReplayDeadLetters puts up to limit messages of the dead-letter queue matching a filter back to their queues with
+// the retry count reset, all matching messages are replayed if limit is 0.
+func (a *AMQP) ReplayDeadLetters(limit int, match func(letter *modelbus.DeadLetter) bool) ([]modelbus.DeadLetter, error) {
+	a.log.Debug().Msg("calling `ReplayDeadLetters` method")
+	return a.browseDeadLetters(limit, true, func(channel *amqp.Channel, delivery *amqp.Delivery, letter *modelbus.DeadLetter) (bool, error) {
+		if letter.Queue == "" || !match(letter) {
+			return false, nil
+		}
+		msg := message(delivery)
+		msg.Headers = modelbus.CopyHeaders(delivery.Headers, modelbus.HeaderRetryCount, modelbus.HeaderOriginalQueue,
+			modelbus.HeaderError, modelbus.HeaderDeadAt, "x-death")
+		err := a.publishConfirmed(channel, "", letter.Queue, publishing(msg))
+		if err != nil {
+			a.log.Error().Err(err).Str("queue", letter.Queue).Msg(errors.AMQPDeadLetterReplayError)
+			return false, err
+		}
+		return true, nil
+	})
+}
@@ -0,0 +1,49 @@
+// Package bus provides a message bus interface and selects its transport.
+
+package bus
+
+import (
+	"context"
+	"upload-service-auto/internal/bus/amqp"
+	"upload-service-auto/internal/bus/kafka"
+	"upload-service-auto/internal/bus/memory"
+	"upload-service-auto/internal/bus/modelbus"
+	"upload-service-auto/internal/bus/nats"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/syncutils"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	TransportAMQP   = "amqp"
+	TransportMemory = "memory"
+	TransportNATS   = "nats"
+	TransportKafka  = "kafka"
+)
+
+// Bus defines methods for publishing messages to exchanges and consuming queues. A delivery is acknowledged once it
+// is handled, failed deliveries are retried and dead-lettered by the transport.
+type Bus interface {
+	Publish(exchange string, msg modelbus.Message) error
+	Consume(ctx context.Context, consumer modelbus.Consumer, fn modelbus.HandlerFunc) error
+	ListDeadLetters(limit int) ([]modelbus.DeadLetter, error)
+	ReplayDeadLetters(limit int, match func(letter *modelbus.DeadLetter) bool) ([]modelbus.DeadLetter, error)
+}
+
+// NewBus initializes a transport selected by configuration.
+func NewBus(cfg *config.Config, logger *zerolog.Logger, syncUtils *syncutils.SyncUtils) Bus {
+	switch cfg.Bus.Transport {
+	case TransportMemory:
+		return memory.NewBroker(cfg, logger)
+	case TransportAMQP:
+		return amqp.NewAMQP(cfg, logger, syncUtils)
+	case TransportNATS:
+		return nats.NewNATS(cfg, logger, syncUtils)
+	case TransportKafka:
+		return kafka.NewKafka(cfg, logger, syncUtils)
+	default:
+		logger.Fatal().Str("transport", cfg.Bus.Transport).Msg("invalid bus transport")
+		return nil
+	}
+}
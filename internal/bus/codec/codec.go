@@ -0,0 +1,172 @@
+// Package codec provides encoding of bus messages in an envelope chosen by the content type.
+
+package codec
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+	"upload-service-auto/internal/bus/errors"
+	"upload-service-auto/internal/bus/modelbus"
+
+	"github.com/google/uuid"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	ContentTypeJSON    = "application/json"
+	ContentTypeMsgpack = "application/msgpack"
+
+	// FormatJSON and FormatMsgpack name the formats for CLI flags.
+	FormatJSON    = "json"
+	FormatMsgpack = "msgpack"
+
+	// SchemaVersion is the schema version of the envelope and the message payloads.
+	SchemaVersion = 1
+	// LegacySchemaVersion is reported for messages sent without an envelope, they are read as payloads of the
+	// current schema version.
+	LegacySchemaVersion = 0
+)
+
+// SupportedSchemaVersions lists schema versions that can be decoded.
+var SupportedSchemaVersions = []int{SchemaVersion}
+
+// jsonEnvelope defines an envelope in JSON keeping its payload undecoded.
+type jsonEnvelope struct {
+	modelbus.Envelope
+	Payload json.RawMessage `json:"payload"`
+}
+
+// msgpackEnvelope defines an envelope in msgpack keeping its payload undecoded.
+type msgpackEnvelope struct {
+	modelbus.Envelope `msgpack:",inline"`
+	Payload           msgpack.RawMessage `msgpack:"payload"`
+}
+
+// ContentType returns the content type of a CLI format.
+func ContentType(format string) (string, error) {
+	switch format {
+	case FormatJSON:
+		return ContentTypeJSON, nil
+	case FormatMsgpack:
+		return ContentTypeMsgpack, nil
+	default:
+		return "", &errors.UnsupportedContentTypeError{ContentType: format}
+	}
+}
+
+// normalize maps a content type to one of the supported ones, a missing content type is taken for JSON.
+func normalize(contentType string) (string, error) {
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	switch strings.ToLower(mediaType) {
+	case "", ContentTypeJSON:
+		return ContentTypeJSON, nil
+	case ContentTypeMsgpack, "application/x-msgpack", "application/vnd.msgpack":
+		return ContentTypeMsgpack, nil
+	default:
+		return "", &errors.UnsupportedContentTypeError{ContentType: contentType}
+	}
+}
+
+// NewEnvelope returns an envelope of a new message of the current schema version.
+func NewEnvelope(correlationID string) modelbus.Envelope {
+	return modelbus.Envelope{
+		MessageID:     uuid.NewString(),
+		SchemaVersion: SchemaVersion,
+		CorrelationID: correlationID,
+		Timestamp:     time.Now().UTC(),
+	}
+}
+
+// Encode encodes a payload in an envelope in the format of a content type.
+func Encode(contentType string, envelope modelbus.Envelope, payload interface{}) ([]byte, error) {
+	contentType, err := normalize(contentType)
+	if err != nil {
+		return nil, err
+	}
+	if contentType == ContentTypeMsgpack {
+		raw, err := msgpack.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		return msgpack.Marshal(&msgpackEnvelope{Envelope: envelope, Payload: raw})
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&jsonEnvelope{Envelope: envelope, Payload: raw})
+}
+
+// Decode decodes a payload from an envelope in the format of a content type. Messages of unsupported schema versions
+// are rejected, messages without an envelope are decoded as payloads.
+func Decode(contentType string, body []byte, payload interface{}) (*modelbus.Envelope, error) {
+	contentType, err := normalize(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		envelope  modelbus.Envelope
+		raw       []byte
+		unmarshal func(data []byte, v interface{}) error
+	)
+	if contentType == ContentTypeMsgpack {
+		unmarshal = msgpack.Unmarshal
+		decoded := msgpackEnvelope{}
+		if err = unmarshal(body, &decoded); err != nil {
+			return nil, err
+		}
+		envelope, raw = decoded.Envelope, decoded.Payload
+	} else {
+		unmarshal = json.Unmarshal
+		decoded := jsonEnvelope{}
+		if err = unmarshal(body, &decoded); err != nil {
+			return nil, err
+		}
+		envelope, raw = decoded.Envelope, decoded.Payload
+	}
+
+	if len(raw) == 0 && envelope.SchemaVersion == LegacySchemaVersion {
+		return &envelope, unmarshal(body, payload)
+	}
+	if !supported(envelope.SchemaVersion) {
+		return nil, &errors.UnsupportedSchemaVersionError{Version: envelope.SchemaVersion}
+	}
+	if err = unmarshal(raw, payload); err != nil {
+		return nil, err
+	}
+	return &envelope, nil
+}
+
+// supported checks that a schema version can be decoded.
+func supported(version int) bool {
+	for _, v := range SupportedSchemaVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Message encodes a payload in an envelope and returns a message carrying the envelope metadata in its properties as
+// well.
+func Message(contentType string, envelope modelbus.Envelope, payload interface{}) (modelbus.Message, error) {
+	contentType, err := normalize(contentType)
+	if err != nil {
+		return modelbus.Message{}, err
+	}
+	body, err := Encode(contentType, envelope, payload)
+	if err != nil {
+		return modelbus.Message{}, err
+	}
+	return modelbus.Message{
+		ContentType:   contentType,
+		MessageID:     envelope.MessageID,
+		CorrelationID: envelope.CorrelationID,
+		Timestamp:     envelope.Timestamp,
+		Headers:       map[string]interface{}{modelbus.HeaderSchemaVersion: strconv.Itoa(envelope.SchemaVersion)},
+		Body:          body,
+	}, nil
+}
@@ -0,0 +1,204 @@
+// Package dispatch provides handling of deliveries shared by the bus transports.
+
+package dispatch
+
+import (
+	"context"
+	"encoding/json"
+	stdErrors "errors"
+	"strconv"
+	"time"
+	"upload-service-auto/internal/bus/errors"
+	"upload-service-auto/internal/bus/modelbus"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/errgroup"
+)
+
+// Transport defines methods a transport provides for settling failed deliveries.
+type Transport interface {
+	// Publish publishes a message to an exchange.
+	Publish(exchange string, msg modelbus.Message) error
+	// Delay puts a message back to a queue once the delay of the given retry is over.
+	Delay(queue string, retry int, msg modelbus.Message) error
+	// DeadLetter moves a message to the dead-letter queue.
+	DeadLetter(msg modelbus.Message) error
+}
+
+// Fetcher returns the next delivery of a queue waiting for it until the context is done, it returns nil if there is no
+// delivery to hand over yet.
+type Fetcher func(ctx context.Context) (*modelbus.Delivery, error)
+
+// Serve handles deliveries returned by the fetchers by the given number of workers until a fetcher or a worker fails or
+// the context is done. Fetched deliveries wait for a worker in a scheduler holding up to the prefetch of the consumer,
+// the ones still waiting once serving is over are returned to the queue.
+func Serve(ctx context.Context, log *zerolog.Logger, t Transport, consumer modelbus.Consumer, fn modelbus.HandlerFunc, fetchers ...Fetcher) error {
+	if consumer.Prefetch < consumer.Workers {
+		consumer.Prefetch = consumer.Workers
+	}
+	scheduler := NewScheduler(consumer.Prefetch, consumer.Weights)
+
+	// workers stop taking deliveries once one of them fails, running handlers keep the original context
+	waitGroup, ctxGroup := errgroup.WithContext(ctx)
+	for _, fetch := range fetchers {
+		fetch := fetch
+		waitGroup.Go(func() error {
+			for ctxGroup.Err() == nil {
+				d, err := fetch(ctxGroup)
+				if err != nil {
+					if ctxGroup.Err() != nil {
+						return nil
+					}
+					return err
+				}
+				if d == nil {
+					continue
+				}
+				if err = scheduler.Push(ctxGroup, d); err != nil {
+					if nackErr := d.Nack(true); nackErr != nil {
+						log.Error().Err(nackErr).Msg(errors.AMQPAckError)
+					}
+					return nil
+				}
+			}
+			return nil
+		})
+	}
+	for i := 0; i < consumer.Workers; i++ {
+		waitGroup.Go(func() error {
+			for {
+				d, err := scheduler.Pop(ctxGroup)
+				if err != nil {
+					return nil
+				}
+				stop, err := Handle(ctx, log, t, d, consumer, fn)
+				if err != nil {
+					return err
+				}
+				if stop {
+					return nil
+				}
+			}
+		})
+	}
+
+	// deliveries are returned in reverse, so that transports putting them to the head of the queue keep their order
+	err := waitGroup.Wait()
+	waiting := scheduler.Drain()
+	for i := len(waiting) - 1; i >= 0; i-- {
+		if nackErr := waiting[i].Nack(true); nackErr != nil {
+			log.Error().Err(nackErr).Msg(errors.AMQPAckError)
+		}
+	}
+	return err
+}
+
+// Handle runs a handler for one delivery and acknowledges it, it reports whether the worker has to stop since the
+// handler was cancelled by shutdown. The status of a handled message is sent to rrs from the outbox written by the
+// handler, the status of a failed message is sent here once it is dead-lettered, not after every attempt.
+func Handle(ctx context.Context, log *zerolog.Logger, t Transport, d *modelbus.Delivery, consumer modelbus.Consumer, fn modelbus.HandlerFunc) (bool, error) {
+	log.Debug().Str("body", string(d.Body)).Int("retry_count", modelbus.RetryCount(d.Headers)).
+		Uint8("priority", d.Priority).Str("producer", modelbus.HeaderString(d.Headers, modelbus.HeaderProducer)).
+		Msg("received message")
+
+	startedAt := time.Now()
+	userID, fileName, status, fnErr := fn(ctx, d)
+	if fnErr != nil && ctx.Err() != nil {
+		// the job was cancelled by shutdown, the message is returned to the queue to be run again
+		log.Warn().Msg(errors.AMQPMessageCancelledError)
+		if nackErr := d.Nack(true); nackErr != nil {
+			log.Error().Err(nackErr).Msg(errors.AMQPAckError)
+		}
+		return true, nil
+	}
+
+	// the message is acknowledged once its retry or its status is confirmed by the broker, so that it is redelivered
+	// if publishing fails
+	if fnErr != nil {
+		log.Warn().Err(fnErr).Msg(errors.AMQPMessageProcessingError)
+		retried, err := retry(log, t, d, consumer, fnErr)
+		if err != nil {
+			return false, err
+		}
+		if !retried {
+			if err = publishFailure(log, t, consumer, userID, fileName, startedAt, fnErr); err != nil {
+				return false, err
+			}
+		}
+	}
+	if ackErr := d.Ack(); ackErr != nil {
+		log.Error().Err(ackErr).Msg(errors.AMQPAckError)
+		return false, ackErr
+	}
+	log.Debug().Str("queue", consumer.Queue).Bool("status", status).Msg("message handled")
+	return false, nil
+}
+
+// retry schedules a failed message for another attempt after a delay, the message is dead-lettered once the
+// attempts are exhausted or the failure is permanent. It reports whether the message is retried.
+func retry(log *zerolog.Logger, t Transport, d *modelbus.Delivery, consumer modelbus.Consumer, fnErr error) (bool, error) {
+	attempts := modelbus.RetryCount(d.Headers) + 1
+	msg := d.Message
+	msg.Headers = modelbus.CopyHeaders(d.Headers)
+	msg.Headers[modelbus.HeaderRetryCount] = int32(attempts)
+	msg.Headers[modelbus.HeaderError] = fnErr.Error()
+
+	var permanent *errors.PermanentError
+	if attempts >= consumer.MaxAttempts || stdErrors.As(fnErr, &permanent) {
+		msg.Headers[modelbus.HeaderOriginalQueue] = consumer.Queue
+		msg.Headers[modelbus.HeaderDeadAt] = time.Now().Format(time.RFC3339)
+		if err := t.DeadLetter(msg); err != nil {
+			log.Error().Err(err).Msg(errors.AMQPDeadLetteringError)
+			return false, err
+		}
+		log.Warn().Err(fnErr).Str("queue", consumer.Queue).Int("attempts", attempts).Msg(errors.AMQPMessageDeadLetteredError)
+		return false, nil
+	}
+
+	if err := t.Delay(consumer.Queue, attempts, msg); err != nil {
+		log.Error().Err(err).Msg(errors.AMQPRetryError)
+		return false, err
+	}
+	log.Info().Str("queue", consumer.Queue).Int("attempt", attempts).Msg("message retry scheduled")
+	return true, nil
+}
+
+// publishFailure sends a result of a dead-lettered message to rrs telling a rejected message from a failed job.
+func publishFailure(log *zerolog.Logger, t Transport, consumer modelbus.Consumer, userID, fileName string, startedAt time.Time, fnErr error) error {
+	rsp := modelbus.RspV2{
+		Rsp: modelbus.Rsp{
+			UserID:   userID,
+			FileName: fileName,
+			RspType:  consumer.RunType,
+			IsReady:  false,
+		},
+		SchemaVersion: modelbus.RspSchemaVersion,
+		Outcome:       modelbus.OutcomeFailed,
+		Error:         &modelbus.RspError{Code: modelbus.ErrorCodeInfrastructure, Message: fnErr.Error()},
+		Timings:       modelbus.NewRspTimings(startedAt),
+	}
+	var permanent *errors.PermanentError
+	if stdErrors.As(fnErr, &permanent) {
+		rsp.Outcome = modelbus.OutcomeRejected
+		rsp.Error.Code = modelbus.ErrorCodeInvalidMessage
+	} else if stdErrors.Is(fnErr, context.DeadlineExceeded) {
+		rsp.Error.Code = modelbus.ErrorCodeTimeout
+	}
+
+	serialized, err := json.Marshal(rsp)
+	if err != nil {
+		log.Error().Err(err).Msg(errors.AMQPMarshallingError)
+		return err
+	}
+
+	err = t.Publish(consumer.ExchangeOut, modelbus.Message{
+		ContentType: "application/json",
+		Headers:     map[string]interface{}{modelbus.HeaderSchemaVersion: strconv.Itoa(modelbus.RspSchemaVersion)},
+		Body:        serialized,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg(errors.AMQPSendingError)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+// Package dispatch provides handling of deliveries shared by the bus transports.
+
+package dispatch
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"upload-service-auto/internal/bus/modelbus"
+)
+
+// lane defines deliveries of one priority waiting for a worker grouped by their producers. Producers without waiting
+// deliveries are kept until the lane is empty, so that their passes are not lost.
+type lane struct {
+	producers map[string]*producer
+	waiting   int
+	// vtime is the pass of the producer served last, producers becoming active again start from it, so that an idle
+	// producer cannot save up turns.
+	vtime float64
+}
+
+// producer defines deliveries of one producer waiting in a lane and the pass telling when the producer is served.
+type producer struct {
+	deliveries []*modelbus.Delivery
+	pass       float64
+}
+
+// Scheduler defines deliveries held by a consumer and waiting for a worker. Deliveries of a higher priority are taken
+// first, deliveries of the same priority are taken from their producers by stride scheduling: every producer is served
+// in proportion to its weight, so that a producer sending a batch cannot starve the others.
+type Scheduler struct {
+	mu       sync.Mutex
+	capacity int
+	weights  map[string]int
+	lanes    map[uint8]*lane
+	size     int
+	ready    chan struct{}
+	space    chan struct{}
+}
+
+// NewScheduler initializes a new Scheduler instance holding up to capacity deliveries, producers missing in weights
+// have the weight of 1.
+func NewScheduler(capacity int, weights map[string]int) *Scheduler {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Scheduler{
+		capacity: capacity,
+		weights:  weights,
+		lanes:    make(map[uint8]*lane),
+		ready:    make(chan struct{}, 1),
+		space:    make(chan struct{}, 1),
+	}
+}
+
+// signal wakes up a goroutine waiting on a channel.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// weight returns the weight of a producer.
+func (s *Scheduler) weight(name string) float64 {
+	if weight, ok := s.weights[name]; ok && weight > 0 {
+		return float64(weight)
+	}
+	return 1
+}
+
+// Push adds a delivery waiting for the context to be done while the scheduler is full.
+func (s *Scheduler) Push(ctx context.Context, d *modelbus.Delivery) error {
+	for {
+		s.mu.Lock()
+		if s.size < s.capacity {
+			break
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.space:
+		}
+	}
+	defer s.mu.Unlock()
+
+	l, ok := s.lanes[d.Priority]
+	if !ok {
+		l = &lane{producers: make(map[string]*producer)}
+		s.lanes[d.Priority] = l
+	}
+	name := modelbus.HeaderString(d.Headers, modelbus.HeaderProducer)
+	p, ok := l.producers[name]
+	if !ok {
+		p = &producer{}
+		l.producers[name] = p
+	}
+	if len(p.deliveries) == 0 && p.pass < l.vtime {
+		p.pass = l.vtime
+	}
+	p.deliveries = append(p.deliveries, d)
+	l.waiting++
+	s.size++
+	signal(s.ready)
+	return nil
+}
+
+// take removes the next delivery, it returns nil if there is none. The caller has to hold the lock.
+func (s *Scheduler) take() *modelbus.Delivery {
+	if s.size == 0 {
+		return nil
+	}
+	var priority uint8
+	found := false
+	for p := range s.lanes {
+		if !found || p > priority {
+			priority, found = p, true
+		}
+	}
+	l := s.lanes[priority]
+
+	// ties are broken by name, so that the order does not depend on map iteration
+	names := make([]string, 0, len(l.producers))
+	for name, p := range l.producers {
+		if len(p.deliveries) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	next := names[0]
+	for _, name := range names[1:] {
+		if l.producers[name].pass < l.producers[next].pass {
+			next = name
+		}
+	}
+
+	p := l.producers[next]
+	d := p.deliveries[0]
+	p.deliveries = p.deliveries[1:]
+	l.vtime = p.pass
+	p.pass += 1 / s.weight(next)
+	l.waiting--
+	if l.waiting == 0 {
+		delete(s.lanes, priority)
+	}
+	s.size--
+	return d
+}
+
+// Pop removes the next delivery waiting for one until the context is done.
+func (s *Scheduler) Pop(ctx context.Context) (*modelbus.Delivery, error) {
+	for {
+		s.mu.Lock()
+		d := s.take()
+		if d != nil {
+			// other waiting workers are woken up for the remaining deliveries
+			if s.size > 0 {
+				signal(s.ready)
+			}
+			signal(s.space)
+			s.mu.Unlock()
+			return d, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.ready:
+		}
+	}
+}
+
+// Drain removes all deliveries in the order they would be taken.
+func (s *Scheduler) Drain() []*modelbus.Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deliveries []*modelbus.Delivery
+	for d := s.take(); d != nil; d = s.take() {
+		deliveries = append(deliveries, d)
+	}
+	return deliveries
+}
@@ -0,0 +1,63 @@
+// Package dispatch provides handling of deliveries shared by the bus transports.
+
+package dispatch
+
+import (
+	"fmt"
+	"time"
+	"upload-service-auto/internal/config"
+)
+
+// Bindings returns queues bound to every exchange, transports declare the same exchanges and queues as the AMQP
+// service.
+func Bindings(cfg *config.Config) map[string][]string {
+	bindings := map[string][]string{}
+	bind := func(exchange, queue string) {
+		for _, bound := range bindings[exchange] {
+			if bound == queue {
+				return
+			}
+		}
+		bindings[exchange] = append(bindings[exchange], queue)
+	}
+	bind(cfg.AMQP.ValidationExchangeInputName, cfg.AMQP.ValidationQueueName)
+	bind(cfg.AMQP.ProcessingExchangeInputName, cfg.AMQP.ProcessingQueueName)
+	bind(cfg.AMQP.ValidationExchangeOutputName, cfg.AMQP.RRSQueueName)
+	bind(cfg.AMQP.ProcessingExchangeOutputName, cfg.AMQP.RRSQueueName)
+	bind(cfg.AMQP.DeadLetterExchangeName, cfg.AMQP.DeadLetterQueueName)
+	return bindings
+}
+
+// Exchanges returns exchanges a queue is bound to.
+func Exchanges(cfg *config.Config, queue string) []string {
+	var exchanges []string
+	for exchange, queues := range Bindings(cfg) {
+		for _, bound := range queues {
+			if bound == queue {
+				exchanges = append(exchanges, exchange)
+			}
+		}
+	}
+	return exchanges
+}
+
+// RetryName returns a name of a subject or a topic delayed messages of a queue are put back through by transports
+// without delayed queues.
+func RetryName(queue string) string {
+	return fmt.Sprintf("%s.retry", queue)
+}
+
+// RetryDelay returns the delay before the given retry, the last delay is used for all further retries.
+func RetryDelay(cfg *config.Config, retry int) time.Duration {
+	delays := len(cfg.AMQP.RetryDelays)
+	if delays == 0 {
+		return 0
+	}
+	if retry > delays {
+		retry = delays
+	}
+	if retry < 1 {
+		retry = 1
+	}
+	return cfg.AMQP.RetryDelays[retry-1]
+}
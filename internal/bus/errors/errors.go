@@ -2,22 +2,81 @@
 
 package errors
 
+import (
+	"fmt"
+)
+
 const (
 	AMQPConnectionError          = "could not connect to AMQP"
 	AMQPChannelOpeningError      = "could not open an AMQP channel"
 	AMQPSettingQosError          = "could not set QoS"
 	AMQPExchangeDeclarationError = "could not declare an exchange"
 	AMQPQueueDeclarationError    = "could not declare a queue"
+	AMQPQueueBindingError        = "could not bind a queue"
+	AMQPClosingError             = "could not close AMQP connection"
+	AMQPConnectionLostError      = "AMQP connection was lost"
+	AMQPConsumerLostError        = "AMQP consumer was stopped, resuming"
+	AMQPRetryError               = "could not schedule a retry of a message"
+	AMQPDeadLetteringError       = "could not move a message to the dead-letter queue"
+	AMQPMessageDeadLetteredError = "message was moved to the dead-letter queue"
+	AMQPDeadLetterReadingError   = "could not read the dead-letter queue"
+	AMQPDeadLetterReplayError    = "could not replay a dead-lettered message"
+	AMQPDecodingError            = "failed to decode message"
+	AMQPEncodingError            = "failed to encode message"
 	AMQPInitiationError          = "could not initialize AMQP"
 	AMQPSerialisationError       = "could not serialize a message"
 	AMQPPublishingError          = "could not publish a message"
+	AMQPPublishingNackedError    = "message was rejected by the broker"
+	AMQPConfirmModeError         = "could not put a channel into confirm mode"
+	AMQPConfirmTimeoutError      = "message was not confirmed by the broker in time"
 	AMQPConsumingError           = "failed to start consuming messages from queue"
 	AMQPAckError                 = "failed to acknowledge message"
 	AMQPMessageProcessingError   = "failed to process message"
+	AMQPMessageCancelledError    = "message processing was cancelled"
 	AMQPSendingError             = "failed to send message"
 	AMQPListeningError           = "failed to listen to queue"
 	AMQPUnmarshallingError       = "failed to unmarshall message"
 	AMQPMarshallingError         = "failed to marshall message"
 	AMQPHandlerValidationError   = "failed to run validation for AMQP-derived query"
 	AMQPHandlerProcessingError   = "failed to run processing for AMQP-derived query"
+	BusUnknownExchangeError      = "exchange is not declared"
+	BusUnknownQueueError         = "queue is not declared"
+	NATSConnectionError          = "could not connect to NATS"
+	NATSStreamDeclarationError   = "could not declare a JetStream stream"
+	NATSSubscriptionError        = "could not subscribe to a JetStream consumer"
+	NATSFetchingError            = "could not fetch messages from JetStream"
+	KafkaTopicDeclarationError   = "could not declare a Kafka topic"
+	KafkaFetchingError           = "could not fetch messages from Kafka"
+	KafkaCommitError             = "could not commit Kafka offsets"
 )
+
+// PermanentError marks a failure that is not retried, e.g. a malformed message.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return fmt.Sprintf("%s: permanent failure", e.Err.Error())
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// UnsupportedContentTypeError reports a message encoded in an unknown format.
+type UnsupportedContentTypeError struct {
+	ContentType string
+}
+
+func (e *UnsupportedContentTypeError) Error() string {
+	return fmt.Sprintf("%s: unsupported content type", e.ContentType)
+}
+
+// UnsupportedSchemaVersionError reports a message of an unknown schema version.
+type UnsupportedSchemaVersionError struct {
+	Version int
+}
+
+func (e *UnsupportedSchemaVersionError) Error() string {
+	return fmt.Sprintf("%d: unsupported schema version", e.Version)
+}
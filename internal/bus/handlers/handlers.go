@@ -4,71 +4,116 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
+	goErrors "errors"
 	"time"
 	"upload-service-auto/internal/agent/agent"
-	busamqp "upload-service-auto/internal/bus/amqp"
+	"upload-service-auto/internal/bus"
+	"upload-service-auto/internal/bus/codec"
 	"upload-service-auto/internal/bus/errors"
 	"upload-service-auto/internal/bus/modelbus"
 	"upload-service-auto/internal/config"
+	storageErrors "upload-service-auto/internal/storage/errors"
 	"upload-service-auto/internal/syncutils"
 
-	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/rs/zerolog"
 	"golang.org/x/sync/errgroup"
 )
 
 const (
-	dryRun              = false
-	fromQueue           = true
-	republishValidation = false
-	runTypeValidation   = "validation"
-	republishProcessing = false
-	runTypeProcessing   = "processing"
-	handlerKey          = "amqp"
-	userIDKey           = "userID"
+	dryRun            = false
+	fromQueue         = true
+	runTypeValidation = "validation"
+	runTypeProcessing = "processing"
+	handlerKey        = "amqp"
+	userIDKey         = "userID"
 )
 
 // AMQPHandler defines an AMQP handler object and sets its attributes.
 type AMQPHandler struct {
 	log       *zerolog.Logger
-	amqp      *busamqp.AMQP
+	bus       bus.Bus
 	cfg       *config.Config
 	agent     *agent.Agent
 	syncUtils *syncutils.SyncUtils
 }
 
 // NewAMQPHandler initializes a new AMQP handling service.
-func NewAMQPHandler(logger *zerolog.Logger, agent *agent.Agent, amqp *busamqp.AMQP, cfg *config.Config, syncUtils *syncutils.SyncUtils) *AMQPHandler {
+func NewAMQPHandler(logger *zerolog.Logger, agent *agent.Agent, bus bus.Bus, cfg *config.Config, syncUtils *syncutils.SyncUtils) *AMQPHandler {
 	logger.Debug().Msg("calling initializer of AMQP handling service")
 	return &AMQPHandler{
 		log:       logger,
 		agent:     agent,
-		amqp:      amqp,
+		bus:       bus,
 		cfg:       cfg,
 		syncUtils: syncUtils,
 	}
 }
 
+// messageID returns an identifier of a task message taken from its envelope or from the message properties for
+// messages sent without an envelope.
+func messageID(envelope *modelbus.Envelope, d *modelbus.Delivery) string {
+	if envelope.MessageID != "" {
+		return envelope.MessageID
+	}
+	return d.MessageID
+}
+
+// claim takes a task message for handling, a message without an identifier is handled without deduplication. It
+// reports a duplicate of a message handled already, which is answered with the known result, or of a message being
+// handled by another worker, which is answered once that worker is done. Duplicates are acknowledged without running
+// the job again.
+func (h *AMQPHandler) claim(ctx context.Context, handler, messageID string) (*modelbus.RspV2, func(), bool, error) {
+	h.log.Debug().Msg("calling `claim` method")
+	if messageID == "" {
+		return nil, func() {}, false, nil
+	}
+
+	rsp, release, err := h.agent.Claim(ctx, messageID, handler)
+	if err != nil {
+		var locked *storageErrors.LockNotAcquiredError
+		if goErrors.As(err, &locked) {
+			h.log.Warn().Str(handlerKey, handler).Str("message_id", messageID).Msg("duplicate of a message being handled is dropped")
+			return nil, func() {}, true, nil
+		}
+		return nil, nil, false, err
+	}
+	if rsp != nil {
+		h.log.Info().Str(handlerKey, handler).Str("message_id", messageID).Msg("duplicate message is answered with the known result")
+		return rsp, release, true, nil
+	}
+	return nil, release, false, nil
+}
+
 // handleProcessingQueue handles queue message management for processing tasks.
-func (h *AMQPHandler) handleProcessingQueue(ctx context.Context, d *amqp.Delivery) (string, string, bool, error) {
+func (h *AMQPHandler) handleProcessingQueue(ctx context.Context, d *modelbus.Delivery) (string, string, bool, error) {
 	h.log.Debug().Msg("calling `handleProcessingQueue` method")
 	const handler = "process"
 	ctxMain, cancel := context.WithTimeout(ctx, 6*time.Hour)
 	defer cancel()
 
 	msg := modelbus.MsgProcess{}
-	err := json.Unmarshal(d.Body, &msg)
+	envelope, err := codec.Decode(d.ContentType, d.Body, &msg)
 	if err != nil {
-		h.log.Error().Err(err).Msg(errors.AMQPUnmarshallingError)
-		return "", "", false, err
+		h.log.Error().Err(err).Str("content_type", d.ContentType).Msg(errors.AMQPDecodingError)
+		return "", "", false, &errors.PermanentError{Err: err}
 	}
+	h.log.Info().Str(handlerKey, handler).Str("message_id", envelope.MessageID).Str("correlation_id", envelope.CorrelationID).Int("schema_version", envelope.SchemaVersion).Uint8("priority", d.Priority).Str("producer", msg.Producer).Msg("message decoded")
 
 	userID := msg.UserID
 	fileName := msg.FileName
 	barcode := msg.Barcode
 
-	err = h.agent.Process(ctxMain, userID, barcode, handler, dryRun, fromQueue)
+	msgID := messageID(envelope, d)
+	known, release, duplicate, err := h.claim(ctxMain, handler, msgID)
+	if err != nil {
+		return userID, fileName, false, err
+	}
+	defer release()
+	if duplicate {
+		return userID, fileName, known != nil && known.IsReady, nil
+	}
+
+	err = h.agent.Process(ctxMain, userID, barcode, msgID, handler, dryRun, fromQueue)
 	if err != nil {
 		h.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.AMQPHandlerProcessingError)
 		return userID, fileName, false, err
@@ -80,7 +125,7 @@ func (h *AMQPHandler) handleProcessingQueue(ctx context.Context, d *amqp.Deliver
 }
 
 // handleValidationQueue handles queue message management for validation tasks.
-func (h *AMQPHandler) handleValidationQueue(ctx context.Context, d *amqp.Delivery) (string, string, bool, error) {
+func (h *AMQPHandler) handleValidationQueue(ctx context.Context, d *modelbus.Delivery) (string, string, bool, error) {
 	h.log.Debug().Msg("calling `handleValidationQueue` method")
 	const handler = "validate"
 
@@ -88,16 +133,27 @@ func (h *AMQPHandler) handleValidationQueue(ctx context.Context, d *amqp.Deliver
 	defer cancel()
 
 	msg := modelbus.MsgValidate{}
-	err := json.Unmarshal(d.Body, &msg)
+	envelope, err := codec.Decode(d.ContentType, d.Body, &msg)
 	if err != nil {
-		h.log.Error().Err(err).Msg(errors.AMQPUnmarshallingError)
-		return "", "", false, err
+		h.log.Error().Err(err).Str("content_type", d.ContentType).Msg(errors.AMQPDecodingError)
+		return "", "", false, &errors.PermanentError{Err: err}
 	}
+	h.log.Info().Str(handlerKey, handler).Str("message_id", envelope.MessageID).Str("correlation_id", envelope.CorrelationID).Int("schema_version", envelope.SchemaVersion).Msg("message decoded")
 
 	userID := msg.UserID
 	fileName := msg.FileName
 
-	validationData, err := h.agent.Validate(ctxMain, userID, fileName, handler, dryRun, fromQueue)
+	msgID := messageID(envelope, d)
+	known, release, duplicate, err := h.claim(ctxMain, handler, msgID)
+	if err != nil {
+		return userID, fileName, false, err
+	}
+	defer release()
+	if duplicate {
+		return userID, fileName, known != nil && known.IsReady, nil
+	}
+
+	validationData, err := h.agent.Validate(ctxMain, userID, fileName, msgID, handler, dryRun, fromQueue)
 	if err != nil {
 		h.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.AMQPHandlerValidationError)
 		return userID, fileName, false, err
@@ -116,30 +172,28 @@ func (h *AMQPHandler) Handle(ctx context.Context) error {
 	h.syncUtils.Wg.Add(1)
 	g.Go(func() error {
 		defer h.syncUtils.Wg.Done()
-		return h.amqp.AddInterpretationQueueListener(
-			ctx,
-			republishValidation,
-			h.cfg.AMQP.ValidationQueueName,
-			h.cfg.AMQP.ValidationExchangeInputName,
-			h.cfg.AMQP.ValidationExchangeOutputName,
-			runTypeValidation,
-			h.handleValidationQueue,
-		)
+		return h.bus.Consume(ctx, modelbus.Consumer{
+			Queue:       h.cfg.AMQP.ValidationQueueName,
+			ExchangeOut: h.cfg.AMQP.ValidationExchangeOutputName,
+			RunType:     runTypeValidation,
+			Workers:     h.cfg.AMQP.ValidationWorkers,
+			MaxAttempts: h.cfg.AMQP.MaxAttempts,
+		}, h.handleValidationQueue)
 	})
 
 	// handling processing queue
 	h.syncUtils.Wg.Add(1)
 	g.Go(func() error {
 		defer h.syncUtils.Wg.Done()
-		return h.amqp.AddInterpretationQueueListener(
-			ctx,
-			republishProcessing,
-			h.cfg.AMQP.ProcessingQueueName,
-			h.cfg.AMQP.ProcessingExchangeInputName,
-			h.cfg.AMQP.ProcessingExchangeOutputName,
-			runTypeProcessing,
-			h.handleProcessingQueue,
-		)
+		return h.bus.Consume(ctx, modelbus.Consumer{
+			Queue:       h.cfg.AMQP.ProcessingQueueName,
+			ExchangeOut: h.cfg.AMQP.ProcessingExchangeOutputName,
+			RunType:     runTypeProcessing,
+			Workers:     h.cfg.AMQP.ProcessingWorkers,
+			Prefetch:    h.cfg.AMQP.ProcessingPrefetch,
+			Weights:     h.cfg.AMQP.ProducerWeights,
+			MaxAttempts: h.cfg.AMQP.MaxAttempts,
+		}, h.handleProcessingQueue)
 	})
 	if err := g.Wait(); err != nil {
 		return err
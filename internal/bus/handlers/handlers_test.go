@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"upload-service-auto/internal/agent/agent"
+	"upload-service-auto/internal/bus/codec"
+	"upload-service-auto/internal/bus/memory"
+	"upload-service-auto/internal/bus/modelbus"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/constants"
+	"upload-service-auto/internal/limiter"
+	"upload-service-auto/internal/processor/v1/processor"
+	"upload-service-auto/internal/productmanager"
+	"upload-service-auto/internal/runner"
+	"upload-service-auto/internal/s3/artifacts"
+	"upload-service-auto/internal/s3/blob"
+	"upload-service-auto/internal/s3/s3"
+	storageMemory "upload-service-auto/internal/storage/v1/memory"
+	"upload-service-auto/internal/syncutils"
+	"upload-service-auto/internal/workspace"
+
+	"github.com/rs/zerolog"
+)
+
+// waitTimeout defines how long a test waits for messages to be handled.
+const waitTimeout = 10 * time.Second
+
+// fixture defines a handler consuming the in-memory broker, jobs are run by the fake runner over the in-memory
+// storage and the local blob store.
+type fixture struct {
+	cfg     *config.Config
+	storage *storageMemory.Storage
+	broker  *memory.Broker
+	runner  *runner.FakeRunner
+	handler *AMQPHandler
+}
+
+// newFixture initializes a new fixture, failed messages are retried at once.
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	logger := zerolog.Nop()
+	cfg := &config.Config{}
+	cfg.AMQP.ValidationExchangeInputName = "validation_exchange_input"
+	cfg.AMQP.ValidationExchangeOutputName = "validation_exchange_output"
+	cfg.AMQP.ProcessingExchangeInputName = "processing_exchange_input"
+	cfg.AMQP.ProcessingExchangeOutputName = "processing_exchange_output"
+	cfg.AMQP.ValidationQueueName = "validation"
+	cfg.AMQP.ProcessingQueueName = "processing"
+	cfg.AMQP.RRSQueueName = "rrs"
+	cfg.AMQP.DeadLetterExchangeName = "dead_letter_exchange"
+	cfg.AMQP.DeadLetterQueueName = "dead_letter"
+	cfg.AMQP.ValidationWorkers = 1
+	cfg.AMQP.ProcessingWorkers = 1
+	cfg.AMQP.MaxAttempts = 2
+	cfg.S3Storage.Backend = blob.BackendLocal
+	cfg.S3Storage.LocalDir = t.TempDir()
+	cfg.S3Storage.Bucket = "results"
+	cfg.S3Storage.BucketUpload = "uploads"
+	cfg.S3Storage.FolderUpload = "upload"
+	cfg.S3Storage.FolderInternal = "internal"
+	cfg.S3Storage.FolderExternal = "external"
+	cfg.S3Storage.FolderBinary = "binary"
+	cfg.Docker.MountDir = t.TempDir()
+
+	syncUtils := syncutils.NewSyncUtils()
+	manifest, err := artifacts.NewManifest(cfg, &logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, err := s3.NewService(cfg, &logger, syncUtils)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := storageMemory.NewStorage(&logger)
+	fake := runner.NewFakeRunner(&logger)
+	proc := processor.NewProcessor(storage, cfg, &logger, service, manifest, syncUtils, fake,
+		workspace.NewManager(cfg, &logger), limiter.NewLimiter(cfg, &logger))
+	a := agent.NewAgent(&logger, cfg, storage, proc, service, productmanager.NewProductManager(&logger), manifest)
+	broker := memory.NewBroker(cfg, &logger)
+	return &fixture{
+		cfg:     cfg,
+		storage: storage,
+		broker:  broker,
+		runner:  fake,
+		handler: NewAMQPHandler(&logger, a, broker, cfg, syncUtils),
+	}
+}
+
+// start runs the handler until the test is over.
+func (f *fixture) start(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- f.handler.Handle(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// source puts an uploaded file into the upload bucket.
+func (f *fixture) source(t *testing.T, fileName string) {
+	t.Helper()
+	path := filepath.Join(f.cfg.S3Storage.LocalDir, f.cfg.S3Storage.BucketUpload, f.cfg.S3Storage.FolderUpload, fileName)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("genotypes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// publish publishes a task message with the given identifier to an exchange.
+func (f *fixture) publish(t *testing.T, exchange, messageID string, payload interface{}) {
+	t.Helper()
+	envelope := codec.NewEnvelope("")
+	envelope.MessageID = messageID
+	msg, err := codec.Message(codec.ContentTypeJSON, envelope, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f.broker.Publish(exchange, msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// outbox returns responses waiting in the outbox.
+func (f *fixture) outbox(t *testing.T) []modelbus.RspV2 {
+	t.Helper()
+	messages, err := f.storage.GetOutboxMessages(context.Background(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsps := make([]modelbus.RspV2, 0, len(messages))
+	for _, msg := range messages {
+		rsp := modelbus.RspV2{}
+		if err = json.Unmarshal(msg.Payload, &rsp); err != nil {
+			t.Fatal(err)
+		}
+		rsps = append(rsps, rsp)
+	}
+	return rsps
+}
+
+// rrs returns responses published to rrs directly by the bus.
+func (f *fixture) rrs(t *testing.T) []modelbus.RspV2 {
+	t.Helper()
+	messages := f.broker.Messages(f.cfg.AMQP.RRSQueueName)
+	rsps := make([]modelbus.RspV2, 0, len(messages))
+	for _, msg := range messages {
+		rsp := modelbus.RspV2{}
+		if err := json.Unmarshal(msg.Body, &rsp); err != nil {
+			t.Fatal(err)
+		}
+		rsps = append(rsps, rsp)
+	}
+	return rsps
+}
+
+// runs counts the runs of the pipeline image for a command.
+func (f *fixture) runs(command string) int {
+	count := 0
+	for _, spec := range f.runner.Runs() {
+		if len(spec.Args) > 1 && spec.Args[1] == command {
+			count++
+		}
+	}
+	return count
+}
+
+// eventually waits until a condition holds failing the test on timeout.
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// writeResults makes processing runs of the fake runner write the results required by the default manifest.
+func (f *fixture) writeResults() {
+	output := f.runner.Output
+	f.runner.Output = func(spec *runner.Spec) ([]byte, error) {
+		if spec.Args[1] != "process" {
+			return output(spec)
+		}
+		return nil, writeResults(spec)
+	}
+}
+
+// writeResults writes the results of a processing run to its workspace.
+func writeResults(spec *runner.Spec) error {
+	barcode := spec.Args[len(spec.Args)-1]
+	for _, name := range []string{
+		"atlas_raw_data/" + barcode + ".txt",
+		"external_raw_data/" + barcode + ".txt",
+		"binary/" + barcode + ".bed",
+		"binary/" + barcode + ".bim",
+		"binary/" + barcode + ".fam",
+	} {
+		path := filepath.Join(spec.Mounts[0].Source, "raw_data", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestHandleValidatesAndProcesses(t *testing.T) {
+	f := newFixture(t)
+	f.writeResults()
+	f.source(t, "file.txt")
+	f.start(t)
+	ctx := context.Background()
+
+	f.publish(t, f.cfg.AMQP.ValidationExchangeInputName, "validate-1",
+		modelbus.MsgValidate{UserID: "user", FileName: "file.txt"})
+	eventually(t, "validation result", func() bool { return len(f.outbox(t)) == 1 })
+	rsp := f.outbox(t)[0]
+	if rsp.RspType != constants.JobValidation || rsp.Outcome != modelbus.OutcomeSucceeded || !rsp.IsReady {
+		t.Fatalf("unexpected validation result %+v", rsp)
+	}
+	if err := f.storage.CheckIsValid(ctx, "file.txt"); err != nil {
+		t.Fatalf("file is not valid: %v", err)
+	}
+
+	f.publish(t, f.cfg.AMQP.ProcessingExchangeInputName, "process-1",
+		modelbus.MsgProcess{UserID: "user", FileName: "file.txt", Barcode: "B1"})
+	eventually(t, "processing result", func() bool { return len(f.outbox(t)) == 2 })
+	rsp = f.outbox(t)[1]
+	if rsp.RspType != constants.JobProcessing || rsp.Outcome != modelbus.OutcomeSucceeded || rsp.Barcode != "B1" ||
+		len(rsp.S3Keys) != 5 {
+		t.Fatalf("unexpected processing result %+v", rsp)
+	}
+	status, err := f.storage.GetProcessingStatus(ctx, "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != constants.ProcessingStatusDone {
+		t.Errorf("expected processing to be done, status %s", status)
+	}
+	recorded, err := f.storage.GetArtifacts(ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded) != 5 {
+		t.Errorf("expected 5 recorded artifacts, got %+v", recorded)
+	}
+	if letters := f.broker.Messages(f.cfg.AMQP.DeadLetterQueueName); len(letters) != 0 {
+		t.Errorf("expected no dead letters, got %+v", letters)
+	}
+}
+
+func TestHandleAnswersDuplicateWithKnownResult(t *testing.T) {
+	f := newFixture(t)
+	f.source(t, "file.txt")
+	f.start(t)
+
+	msg := modelbus.MsgValidate{UserID: "user", FileName: "file.txt"}
+	f.publish(t, f.cfg.AMQP.ValidationExchangeInputName, "validate-1", msg)
+	eventually(t, "validation result", func() bool { return len(f.outbox(t)) == 1 })
+	f.publish(t, f.cfg.AMQP.ValidationExchangeInputName, "validate-1", msg)
+	eventually(t, "known result", func() bool { return len(f.outbox(t)) == 2 })
+
+	if runs := f.runs("validate"); runs != 1 {
+		t.Errorf("expected validation to run once, it ran %d times", runs)
+	}
+	rsps := f.outbox(t)
+	if rsps[0].Outcome != rsps[1].Outcome || rsps[0].FileName != rsps[1].FileName ||
+		rsps[0].IsReady != rsps[1].IsReady {
+		t.Errorf("duplicate is answered with %+v instead of %+v", rsps[1], rsps[0])
+	}
+	if letters := f.broker.Messages(f.cfg.AMQP.DeadLetterQueueName); len(letters) != 0 {
+		t.Errorf("expected no dead letters, got %+v", letters)
+	}
+}
+
+func TestHandleDeadLettersUndecodableMessage(t *testing.T) {
+	f := newFixture(t)
+	f.start(t)
+
+	err := f.broker.Publish(f.cfg.AMQP.ValidationExchangeInputName, modelbus.Message{
+		ContentType: codec.ContentTypeJSON,
+		MessageID:   "broken",
+		Body:        []byte("{"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "dead letter", func() bool {
+		return len(f.broker.Messages(f.cfg.AMQP.DeadLetterQueueName)) == 1
+	})
+
+	letter := f.broker.Messages(f.cfg.AMQP.DeadLetterQueueName)[0]
+	if attempts := modelbus.RetryCount(letter.Headers); attempts != 1 {
+		t.Errorf("expected the message to be dead-lettered without retries, attempts %d", attempts)
+	}
+	eventually(t, "rejection", func() bool { return len(f.rrs(t)) == 1 })
+	rsp := f.rrs(t)[0]
+	if rsp.Outcome != modelbus.OutcomeRejected || rsp.Error == nil || rsp.Error.Code != modelbus.ErrorCodeInvalidMessage {
+		t.Errorf("unexpected rejection %+v", rsp)
+	}
+	if runs := len(f.runner.Runs()); runs != 0 {
+		t.Errorf("expected no runs, got %d", runs)
+	}
+}
+
+func TestHandleRetriesAndDeadLettersFailedJob(t *testing.T) {
+	f := newFixture(t)
+	f.runner.Output = func(spec *runner.Spec) ([]byte, error) {
+		return nil, errors.New("container exited with code 1")
+	}
+	f.source(t, "file.txt")
+	f.start(t)
+
+	f.publish(t, f.cfg.AMQP.ValidationExchangeInputName, "validate-1",
+		modelbus.MsgValidate{UserID: "user", FileName: "file.txt"})
+	eventually(t, "dead letter", func() bool {
+		return len(f.broker.Messages(f.cfg.AMQP.DeadLetterQueueName)) == 1
+	})
+
+	if runs := f.runs("validate"); runs != f.cfg.AMQP.MaxAttempts {
+		t.Errorf("expected %d attempts, got %d", f.cfg.AMQP.MaxAttempts, runs)
+	}
+	letter := f.broker.Messages(f.cfg.AMQP.DeadLetterQueueName)[0]
+	if attempts := modelbus.RetryCount(letter.Headers); attempts != f.cfg.AMQP.MaxAttempts {
+		t.Errorf("expected %d attempts recorded, got %d", f.cfg.AMQP.MaxAttempts, attempts)
+	}
+	if queue := modelbus.HeaderString(letter.Headers, modelbus.HeaderOriginalQueue); queue != f.cfg.AMQP.ValidationQueueName {
+		t.Errorf("expected the original queue %s, got %s", f.cfg.AMQP.ValidationQueueName, queue)
+	}
+	eventually(t, "failure", func() bool { return len(f.rrs(t)) == 1 })
+	rsp := f.rrs(t)[0]
+	if rsp.Outcome != modelbus.OutcomeFailed || rsp.UserID != "user" || rsp.FileName != "file.txt" ||
+		rsp.Error == nil || !strings.Contains(rsp.Error.Message, "exited") {
+		t.Errorf("unexpected failure %+v", rsp)
+	}
+	if rsps := f.outbox(t); len(rsps) != 0 {
+		t.Errorf("expected no results of the failed job, got %+v", rsps)
+	}
+}
@@ -0,0 +1,425 @@
+// Package kafka implements a Kafka transport.
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+	"upload-service-auto/internal/bus/dispatch"
+	"upload-service-auto/internal/bus/errors"
+	"upload-service-auto/internal/bus/modelbus"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/syncutils"
+
+	"github.com/rs/zerolog"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+const (
+	// joinTimeout limits waiting for the first dead letter, it covers joining the consumer group.
+	joinTimeout = 30 * time.Second
+	// idleTimeout is a time without dead letters after which the dead-letter topic is considered read.
+	idleTimeout = 5 * time.Second
+)
+
+// Kafka defines a Kafka client object and sets its attributes. Exchanges are topics, a queue is a consumer group
+// reading the topics the queue is bound to, so every queue receives every message published to its exchanges.
+// Delayed retries are published to a retry topic of the queue read by its own consumer group which waits until they
+// are due.
+type Kafka struct {
+	config    *config.Config
+	log       *zerolog.Logger
+	writer    *kafka.Writer
+	bindings  map[string][]string
+	syncUtils *syncutils.SyncUtils
+}
+
+// NewKafka initializes a new Kafka service.
+func NewKafka(config *config.Config, logger *zerolog.Logger, syncUtils *syncutils.SyncUtils) *Kafka {
+	logger.Debug().Msg("calling initializer of Kafka service")
+	k := &Kafka{
+		config:    config,
+		log:       logger,
+		bindings:  dispatch.Bindings(config),
+		syncUtils: syncUtils,
+	}
+	if err := k.init(); err != nil {
+		k.log.Fatal().Err(err).Msg(errors.KafkaTopicDeclarationError)
+	}
+	return k
+}
+
+// init declares the topics and closes the writer once the shared context is done.
+func (k *Kafka) init() error {
+	k.log.Debug().Msg("calling `init` method")
+	if err := k.declare(); err != nil {
+		return err
+	}
+	k.writer = &kafka.Writer{
+		Addr:         kafka.TCP(k.config.Kafka.Brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		WriteTimeout: k.config.AMQP.ConfirmTimeout,
+		BatchTimeout: time.Millisecond,
+	}
+	k.log.Info().Msg("Kafka: connected")
+
+	k.syncUtils.Wg.Add(1)
+	go func() {
+		defer k.syncUtils.Wg.Done()
+		<-k.syncUtils.Ctx.Done()
+		if err := k.writer.Close(); err != nil {
+			k.log.Error().Err(err).Msg(errors.AMQPClosingError)
+			return
+		}
+		k.log.Debug().Msg("Kafka writer was closed")
+	}()
+	return nil
+}
+
+// declare creates missing topics of the exchanges and retry topics of the queues on the controller broker.
+func (k *Kafka) declare() error {
+	k.log.Debug().Msg("calling `declare` method")
+	var topics []kafka.TopicConfig
+	topic := func(name string) {
+		topics = append(topics, kafka.TopicConfig{
+			Topic:             name,
+			NumPartitions:     k.config.Kafka.Partitions,
+			ReplicationFactor: k.config.Kafka.ReplicationFactor,
+		})
+	}
+	retries := map[string]bool{}
+	for exchange, queues := range k.bindings {
+		topic(exchange)
+		for _, queue := range queues {
+			retries[queue] = true
+		}
+	}
+	for queue := range retries {
+		topic(dispatch.RetryName(queue))
+	}
+
+	conn, err := kafka.Dial("tcp", k.config.Kafka.Brokers[0])
+	if err != nil {
+		k.log.Error().Err(err).Msg(errors.KafkaTopicDeclarationError)
+		return err
+	}
+	defer conn.Close()
+	controller, err := conn.Controller()
+	if err != nil {
+		k.log.Error().Err(err).Msg(errors.KafkaTopicDeclarationError)
+		return err
+	}
+	controllerConn, err := kafka.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	if err != nil {
+		k.log.Error().Err(err).Msg(errors.KafkaTopicDeclarationError)
+		return err
+	}
+	defer controllerConn.Close()
+
+	// creating an existing topic has no effect
+	if err = controllerConn.CreateTopics(topics...); err != nil {
+		k.log.Error().Err(err).Msg(errors.KafkaTopicDeclarationError)
+		return err
+	}
+	return nil
+}
+
+// publish publishes a message to a topic and waits for all in-sync replicas to store it. Messages are partitioned by
+// their identifiers.
+func (k *Kafka) publish(topic string, msg modelbus.Message) error {
+	var headers []kafka.Header
+	for key, value := range modelbus.FlatHeaders(&msg) {
+		headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), k.config.AMQP.ConfirmTimeout)
+	defer cancel()
+	return k.writer.WriteMessages(ctx, kafka.Message{
+		Topic:   topic,
+		Key:     []byte(msg.MessageID),
+		Value:   msg.Body,
+		Headers: headers,
+	})
+}
+
+// message converts a Kafka message to a message.
+func message(msg *kafka.Message) modelbus.Message {
+	flat := make(map[string]string, len(msg.Headers))
+	for _, header := range msg.Headers {
+		flat[header.Key] = string(header.Value)
+	}
+	return modelbus.NewFlatMessage(flat, msg.Value)
+}
+
+// Publish publishes a message to the specified exchange and waits for the brokers to store it.
+func (k *Kafka) Publish(exchange string, msg modelbus.Message) error {
+	k.log.Debug().Msg("calling `Publish` method")
+	if _, ok := k.bindings[exchange]; !ok {
+		err := fmt.Errorf("%s: %s", exchange, errors.BusUnknownExchangeError)
+		k.log.Error().Err(err).Msg(errors.AMQPPublishingError)
+		return err
+	}
+	if err := k.publish(exchange, msg); err != nil {
+		k.log.Error().Err(err).Msg(errors.AMQPPublishingError)
+		return err
+	}
+	k.log.Info().Msg("message was successfully published to Kafka")
+	return nil
+}
+
+// Delay puts a message back to a queue through its retry topic, the message is handled once the delay of the given
+// retry is over. The last delay is used for all further retries.
+func (k *Kafka) Delay(queue string, retry int, msg modelbus.Message) error {
+	k.log.Debug().Msg("calling `Delay` method")
+	msg.Headers = modelbus.CopyHeaders(msg.Headers)
+	msg.Headers[modelbus.HeaderNotBefore] = time.Now().Add(dispatch.RetryDelay(k.config, retry)).Format(time.RFC3339Nano)
+	return k.publish(dispatch.RetryName(queue), msg)
+}
+
+// DeadLetter moves a message to the dead-letter exchange.
+func (k *Kafka) DeadLetter(msg modelbus.Message) error {
+	k.log.Debug().Msg("calling `DeadLetter` method")
+	return k.publish(k.config.AMQP.DeadLetterExchangeName, msg)
+}
+
+// inflight defines a fetched message waiting to be settled.
+type inflight struct {
+	msg     kafka.Message
+	settled bool
+}
+
+// offsets tracks fetched messages of a reader and commits the offset of a partition once all messages before it are
+// settled, so that a message is never committed before an earlier one handled by another worker.
+type offsets struct {
+	mu      sync.Mutex
+	reader  *kafka.Reader
+	timeout time.Duration
+	pending map[string][]*inflight
+}
+
+// partition returns a key of the topic partition of a message.
+func partition(msg *kafka.Message) string {
+	return fmt.Sprintf("%s/%d", msg.Topic, msg.Partition)
+}
+
+// add starts tracking a fetched message, messages of a partition have to be added in the order they are fetched.
+func (o *offsets) add(msg kafka.Message) *inflight {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	f := &inflight{msg: msg}
+	o.pending[partition(&msg)] = append(o.pending[partition(&msg)], f)
+	return f
+}
+
+// settle marks a message settled and commits the last settled message of its partition not preceded by an unsettled
+// one.
+func (o *offsets) settle(f *inflight) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	f.settled = true
+
+	key := partition(&f.msg)
+	pending := o.pending[key]
+	var last *kafka.Message
+	for len(pending) > 0 && pending[0].settled {
+		last = &pending[0].msg
+		pending = pending[1:]
+	}
+	o.pending[key] = pending
+	if last == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+	return o.reader.CommitMessages(ctx, *last)
+}
+
+// acknowledger settles a Kafka message.
+type acknowledger struct {
+	offsets *offsets
+	msg     *inflight
+}
+
+// Ack commits the message once all messages fetched before it are settled.
+func (a *acknowledger) Ack() error {
+	return a.offsets.settle(a.msg)
+}
+
+// Nack rejects the message, it is never committed if requeue is set, so that it is fetched again once the consumer
+// is restarted, and it is settled as handled otherwise.
+func (a *acknowledger) Nack(requeue bool) error {
+	if requeue {
+		return nil
+	}
+	return a.offsets.settle(a.msg)
+}
+
+// reader returns a consumer group reader of topics.
+func (k *Kafka) reader(group string, topics ...string) *kafka.Reader {
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     k.config.Kafka.Brokers,
+		GroupID:     group,
+		GroupTopics: topics,
+		StartOffset: kafka.FirstOffset,
+		MaxWait:     time.Second,
+	})
+}
+
+// Consume handles deliveries of a queue by the given number of workers until the context is done. Failed messages
+// are retried after a delay and moved to the dead-letter topic once the attempts are exhausted. The consumer is
+// resumed once it fails until the context is done, uncommitted messages are fetched again.
+func (k *Kafka) Consume(ctx context.Context, consumer modelbus.Consumer, fn modelbus.HandlerFunc) error {
+	if consumer.Workers < 1 {
+		consumer.Workers = 1
+	}
+	for {
+		err := k.consume(ctx, consumer, fn)
+		if ctx.Err() != nil {
+			k.log.Info().Str("queue", consumer.Queue).Msg("Kafka: consumer stopped")
+			return nil
+		}
+		k.log.Warn().Err(err).Str("queue", consumer.Queue).Msg(errors.AMQPConsumerLostError)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(k.config.AMQP.ReconnectMinDelay):
+		}
+	}
+}
+
+// consume handles deliveries of a queue until a worker fails or the context is done. The queue is read by a group
+// reading its exchanges and a group reading its retry topic, the latter waits for every message until it is due.
+func (k *Kafka) consume(ctx context.Context, consumer modelbus.Consumer, fn modelbus.HandlerFunc) error {
+	k.log.Debug().Msg("calling `consume` method")
+	readers := []*kafka.Reader{
+		k.reader(consumer.Queue, dispatch.Exchanges(k.config, consumer.Queue)...),
+		k.reader(dispatch.RetryName(consumer.Queue), dispatch.RetryName(consumer.Queue)),
+	}
+
+	var fetchers []dispatch.Fetcher
+	for _, reader := range readers {
+		reader := reader
+		defer reader.Close()
+		tracked := &offsets{reader: reader, timeout: k.config.AMQP.ConfirmTimeout, pending: map[string][]*inflight{}}
+
+		fetchers = append(fetchers, func(ctx context.Context) (*modelbus.Delivery, error) {
+			msg, err := reader.FetchMessage(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					k.log.Error().Err(err).Str("queue", consumer.Queue).Msg(errors.KafkaFetchingError)
+				}
+				return nil, err
+			}
+			delivered := message(&msg)
+			if notBefore := modelbus.NotBefore(delivered.Headers); time.Now().Before(notBefore) {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(time.Until(notBefore)):
+				}
+			}
+			return &modelbus.Delivery{
+				Message:      delivered,
+				Acknowledger: &acknowledger{offsets: tracked, msg: tracked.add(msg)},
+			}, nil
+		})
+	}
+
+	k.log.Info().Str("queue", consumer.Queue).Int("workers", consumer.Workers).Msg("Kafka: consumer started")
+
+	if err := dispatch.Serve(ctx, k.log, k, consumer, fn, fetchers...); err != nil {
+		k.log.Error().Err(err).Msg(errors.AMQPListeningError)
+		return err
+	}
+	return nil
+}
+
+// browseDeadLetters returns up to limit messages of the dead-letter topic fn returns true for, all of them are
+// returned if limit is 0. Offsets of browsed messages are committed if commit is set, so a message fn leaves in the
+// topic has to be published to it again. Messages published to a partition after browsing started are not browsed.
+func (k *Kafka) browseDeadLetters(limit int, commit bool, fn func(msg *kafka.Message, letter *modelbus.DeadLetter) (bool, error)) ([]modelbus.DeadLetter, error) {
+	k.log.Debug().Msg("calling `browseDeadLetters` method")
+	reader := k.reader(k.config.AMQP.DeadLetterQueueName, k.config.AMQP.DeadLetterExchangeName)
+	defer reader.Close()
+
+	var (
+		letters []modelbus.DeadLetter
+		ends    = map[int]int64{}
+		timeout = joinTimeout
+	)
+	for limit == 0 || len(letters) < limit {
+		ctx, cancel := context.WithTimeout(k.syncUtils.Ctx, timeout)
+		msg, err := reader.FetchMessage(ctx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				break
+			}
+			k.log.Error().Err(err).Msg(errors.AMQPDeadLetterReadingError)
+			return nil, err
+		}
+		timeout = idleTimeout
+
+		if _, ok := ends[msg.Partition]; !ok {
+			ends[msg.Partition] = msg.HighWaterMark
+		}
+		if msg.Offset >= ends[msg.Partition] {
+			continue
+		}
+		delivered := message(&msg)
+		letter := modelbus.NewDeadLetter(&delivered)
+		matched, err := fn(&msg, &letter)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			letters = append(letters, letter)
+		}
+		if commit {
+			if err = reader.CommitMessages(k.syncUtils.Ctx, msg); err != nil {
+				k.log.Error().Err(err).Msg(errors.KafkaCommitError)
+				return nil, err
+			}
+		}
+	}
+	return letters, nil
+}
+
+// ListDeadLetters returns up to limit messages of the dead-letter topic leaving them in the topic, all messages are
+// returned if limit is 0.
+func (k *Kafka) ListDeadLetters(limit int) ([]modelbus.DeadLetter, error) {
+	k.log.Debug().Msg("calling `ListDeadLetters` method")
+	return k.browseDeadLetters(limit, false, func(*kafka.Message, *modelbus.DeadLetter) (bool, error) {
+		return true, nil
+	})
+}
+
+// ReplayDeadLetters puts up to limit messages of the dead-letter topic matching a filter back to their queues with
+// the retry count reset, all matching messages are replayed if limit is 0. Messages which are not replayed are
+// published to the dead-letter topic again.
+func (k *Kafka) ReplayDeadLetters(limit int, match func(letter *modelbus.DeadLetter) bool) ([]modelbus.DeadLetter, error) {
+	k.log.Debug().Msg("calling `ReplayDeadLetters` method")
+	return k.browseDeadLetters(limit, true, func(msg *kafka.Message, letter *modelbus.DeadLetter) (bool, error) {
+		if letter.Queue == "" || len(dispatch.Exchanges(k.config, letter.Queue)) == 0 || !match(letter) {
+			if err := k.publish(k.config.AMQP.DeadLetterExchangeName, message(msg)); err != nil {
+				k.log.Error().Err(err).Msg(errors.AMQPDeadLetterReplayError)
+				return false, err
+			}
+			return false, nil
+		}
+		replayed := message(msg)
+		replayed.Headers = modelbus.CopyHeaders(replayed.Headers, modelbus.HeaderRetryCount, modelbus.HeaderOriginalQueue,
+			modelbus.HeaderError, modelbus.HeaderDeadAt, modelbus.HeaderNotBefore)
+		if err := k.publish(dispatch.RetryName(letter.Queue), replayed); err != nil {
+			k.log.Error().Err(err).Str("queue", letter.Queue).Msg(errors.AMQPDeadLetterReplayError)
+			return false, err
+		}
+		return true, nil
+	})
+}
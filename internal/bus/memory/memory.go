@@ -0,0 +1,287 @@
+// Package memory implements an in-process message broker.
+
+package memory
+
+import (
+	"context"
+	stdErrors "errors"
+	"fmt"
+	"sync"
+	"time"
+	"upload-service-auto/internal/bus/dispatch"
+	"upload-service-auto/internal/bus/errors"
+	"upload-service-auto/internal/bus/modelbus"
+	"upload-service-auto/internal/config"
+
+	"github.com/rs/zerolog"
+)
+
+// queue defines messages waiting in a queue, ready is signalled once a message is added.
+type queue struct {
+	messages []modelbus.Message
+	ready    chan struct{}
+}
+
+// Broker defines an in-process broker and sets its attributes. Exchanges are fanout ones routing a message to all
+// bound queues, queues are priority ones. A message taken from a queue is gone once it is acknowledged and is put back to the head of the queue
+// if it is rejected with requeue. Messages are kept in memory only, so publishers and consumers have to share the
+// process.
+type Broker struct {
+	config   *config.Config
+	log      *zerolog.Logger
+	mu       sync.Mutex
+	bindings map[string][]string
+	queues   map[string]*queue
+}
+
+// NewBroker initializes a new Broker instance declaring the same exchanges and queues as the AMQP service.
+func NewBroker(config *config.Config, logger *zerolog.Logger) *Broker {
+	logger.Debug().Msg("calling initializer of in-memory broker")
+	b := &Broker{
+		config:   config,
+		log:      logger,
+		bindings: make(map[string][]string),
+		queues:   make(map[string]*queue),
+	}
+	for exchange, queueNames := range dispatch.Bindings(config) {
+		b.Declare(exchange, queueNames...)
+	}
+	return b
+}
+
+// Declare declares an exchange and binds queues to it, the exchange and the queues are created if they are missing.
+func (b *Broker) Declare(exchange string, queueNames ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bound := b.bindings[exchange]
+	for _, name := range queueNames {
+		if _, ok := b.queues[name]; !ok {
+			b.queues[name] = &queue{ready: make(chan struct{}, 1)}
+		}
+		exists := false
+		for _, boundName := range bound {
+			exists = exists || boundName == name
+		}
+		if !exists {
+			bound = append(bound, name)
+		}
+	}
+	b.bindings[exchange] = bound
+}
+
+// push adds a message to a queue, to its head if front is set. The caller has to hold the lock.
+func (b *Broker) push(queueName string, msg modelbus.Message, front bool) error {
+	q, ok := b.queues[queueName]
+	if !ok {
+		return fmt.Errorf("%s: %s", queueName, errors.BusUnknownQueueError)
+	}
+	msg.Headers = modelbus.CopyHeaders(msg.Headers)
+	if front {
+		q.messages = append([]modelbus.Message{msg}, q.messages...)
+	} else {
+		// a message goes after the messages of the same or a higher priority
+		i := len(q.messages)
+		for i > 0 && q.messages[i-1].Priority < msg.Priority {
+			i--
+		}
+		q.messages = append(q.messages, modelbus.Message{})
+		copy(q.messages[i+1:], q.messages[i:])
+		q.messages[i] = msg
+	}
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// pop takes the message at the head of a queue waiting for one until the context is done.
+func (b *Broker) pop(ctx context.Context, queueName string) (modelbus.Message, error) {
+	for {
+		b.mu.Lock()
+		q, ok := b.queues[queueName]
+		if !ok {
+			b.mu.Unlock()
+			return modelbus.Message{}, fmt.Errorf("%s: %s", queueName, errors.BusUnknownQueueError)
+		}
+		if len(q.messages) > 0 {
+			msg := q.messages[0]
+			q.messages = q.messages[1:]
+			// other waiting consumers are woken up for the remaining messages
+			if len(q.messages) > 0 {
+				select {
+				case q.ready <- struct{}{}:
+				default:
+				}
+			}
+			b.mu.Unlock()
+			return msg, nil
+		}
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return modelbus.Message{}, ctx.Err()
+		case <-q.ready:
+		}
+	}
+}
+
+// Publish routes a message to all queues bound to an exchange.
+func (b *Broker) Publish(exchange string, msg modelbus.Message) error {
+	b.log.Debug().Msg("calling `Publish` method")
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	queueNames, ok := b.bindings[exchange]
+	if !ok {
+		err := fmt.Errorf("%s: %s", exchange, errors.BusUnknownExchangeError)
+		b.log.Error().Err(err).Msg(errors.AMQPPublishingError)
+		return err
+	}
+	for _, name := range queueNames {
+		if err := b.push(name, msg, false); err != nil {
+			b.log.Error().Err(err).Msg(errors.AMQPPublishingError)
+			return err
+		}
+	}
+	return nil
+}
+
+// Delay puts a message back to a queue once the delay of the given retry is over, the last delay is used for all
+// further retries. Without delays the message is returned to its queue at once.
+func (b *Broker) Delay(queueName string, retry int, msg modelbus.Message) error {
+	b.log.Debug().Msg("calling `Delay` method")
+	delay := dispatch.RetryDelay(b.config, retry)
+
+	b.mu.Lock()
+	_, ok := b.queues[queueName]
+	b.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%s: %s", queueName, errors.BusUnknownQueueError)
+	}
+	time.AfterFunc(delay, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		_ = b.push(queueName, msg, false)
+	})
+	return nil
+}
+
+// DeadLetter moves a message to the dead-letter exchange.
+func (b *Broker) DeadLetter(msg modelbus.Message) error {
+	b.log.Debug().Msg("calling `DeadLetter` method")
+	return b.Publish(b.config.AMQP.DeadLetterExchangeName, msg)
+}
+
+// acknowledger settles a delivery taken from a queue of the broker.
+type acknowledger struct {
+	broker    *Broker
+	queueName string
+	msg       modelbus.Message
+}
+
+// Ack acknowledges the delivery, the message is already removed from its queue.
+func (a *acknowledger) Ack() error {
+	return nil
+}
+
+// Nack rejects the delivery returning it to the head of its queue if requeue is set.
+func (a *acknowledger) Nack(requeue bool) error {
+	if !requeue {
+		return nil
+	}
+	a.broker.mu.Lock()
+	defer a.broker.mu.Unlock()
+	return a.broker.push(a.queueName, a.msg, true)
+}
+
+// Consume handles deliveries of a queue by the given number of workers until the context is done. Failed messages
+// are retried after a delay and moved to the dead-letter queue once the attempts are exhausted.
+func (b *Broker) Consume(ctx context.Context, consumer modelbus.Consumer, fn modelbus.HandlerFunc) error {
+	if consumer.Workers < 1 {
+		consumer.Workers = 1
+	}
+	b.log.Info().Str("queue", consumer.Queue).Int("workers", consumer.Workers).Msg("in-memory consumer started")
+
+	err := dispatch.Serve(ctx, b.log, b, consumer, fn, func(ctx context.Context) (*modelbus.Delivery, error) {
+		msg, err := b.pop(ctx, consumer.Queue)
+		if err != nil {
+			return nil, err
+		}
+		return &modelbus.Delivery{
+			Message:      msg,
+			Acknowledger: &acknowledger{broker: b, queueName: consumer.Queue, msg: msg},
+		}, nil
+	})
+	if err != nil {
+		b.log.Error().Err(err).Msg(errors.AMQPListeningError)
+		return err
+	}
+	b.log.Info().Str("queue", consumer.Queue).Msg("in-memory consumer stopped")
+	return nil
+}
+
+// Messages returns copies of the messages waiting in a queue leaving them in the queue.
+func (b *Broker) Messages(queueName string) []modelbus.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[queueName]
+	if !ok {
+		return nil
+	}
+	messages := make([]modelbus.Message, len(q.messages))
+	copy(messages, q.messages)
+	return messages
+}
+
+// ListDeadLetters returns up to limit messages of the dead-letter queue leaving them in the queue, all messages are
+// returned if limit is 0.
+func (b *Broker) ListDeadLetters(limit int) ([]modelbus.DeadLetter, error) {
+	b.log.Debug().Msg("calling `ListDeadLetters` method")
+	var letters []modelbus.DeadLetter
+	for _, msg := range b.Messages(b.config.AMQP.DeadLetterQueueName) {
+		if limit > 0 && len(letters) == limit {
+			break
+		}
+		letters = append(letters, modelbus.NewDeadLetter(&msg))
+	}
+	return letters, nil
+}
+
+// ReplayDeadLetters puts up to limit messages of the dead-letter queue matching a filter back to their queues with
+// the retry count reset, all matching messages are replayed if limit is 0.
+func (b *Broker) ReplayDeadLetters(limit int, match func(letter *modelbus.DeadLetter) bool) ([]modelbus.DeadLetter, error) {
+	b.log.Debug().Msg("calling `ReplayDeadLetters` method")
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[b.config.AMQP.DeadLetterQueueName]
+	if !ok {
+		return nil, stdErrors.New(errors.AMQPDeadLetterReadingError)
+	}
+	var (
+		letters []modelbus.DeadLetter
+		kept    []modelbus.Message
+	)
+	for _, msg := range q.messages {
+		letter := modelbus.NewDeadLetter(&msg)
+		if (limit > 0 && len(letters) == limit) || letter.Queue == "" || !match(&letter) {
+			kept = append(kept, msg)
+			continue
+		}
+		replayed := msg
+		replayed.Headers = modelbus.CopyHeaders(msg.Headers, modelbus.HeaderRetryCount, modelbus.HeaderOriginalQueue,
+			modelbus.HeaderError, modelbus.HeaderDeadAt)
+		if err := b.push(letter.Queue, replayed, false); err != nil {
+			b.log.Error().Err(err).Str("queue", letter.Queue).Msg(errors.AMQPDeadLetterReplayError)
+			kept = append(kept, msg)
+			continue
+		}
+		letters = append(letters, letter)
+	}
+	q.messages = kept
+	return letters, nil
+}
@@ -2,15 +2,68 @@
 
 package modelbus
 
+import "time"
+
+const (
+	// HeaderSchemaVersion keeps the schema version of a response message.
+	HeaderSchemaVersion = "x-schema-version"
+	// RspSchemaVersion is the schema version of RspV2.
+	RspSchemaVersion = 2
+)
+
+// Outcomes of a job reported in RspV2.
+const (
+	// OutcomeSucceeded reports a finished job, for validation the file has passed it.
+	OutcomeSucceeded = "succeeded"
+	// OutcomeInvalid reports a file which has not passed validation.
+	OutcomeInvalid = "invalid"
+	// OutcomeRejected reports a message which cannot be handled, e.g. a malformed one.
+	OutcomeRejected = "rejected"
+	// OutcomeFailed reports a job failed due to an infrastructure error once all attempts are exhausted.
+	OutcomeFailed = "failed"
+)
+
+// Error codes reported in RspV2.
+const (
+	ErrorCodeInvalidFile    = "invalid_file"
+	ErrorCodeInvalidMessage = "invalid_message"
+	ErrorCodeTimeout        = "timeout"
+	ErrorCodeInfrastructure = "infrastructure_error"
+)
+
+// Envelope defines metadata sent along with every validation and processing message.
+type Envelope struct {
+	MessageID     string    `json:"message_id" msgpack:"message_id"`
+	SchemaVersion int       `json:"schema_version" msgpack:"schema_version"`
+	CorrelationID string    `json:"correlation_id,omitempty" msgpack:"correlation_id,omitempty"`
+	Timestamp     time.Time `json:"timestamp" msgpack:"timestamp"`
+}
+
 type MsgValidate struct {
 	UserID   string `json:"user_id" msgpack:"user_id"`
 	FileName string `json:"file_name" msgpack:"file_name"`
 }
 
+// MsgProcess defines a processing invoice, its priority and producer are mapped to message properties by Route.
 type MsgProcess struct {
 	UserID   string `json:"user_id" msgpack:"user_id"`
 	FileName string `json:"file_name" msgpack:"file_name"`
 	Barcode  string `json:"barcode" msgpack:"barcode"`
+	Priority uint8  `json:"priority,omitempty" msgpack:"priority,omitempty"`
+	Producer string `json:"producer,omitempty" msgpack:"producer,omitempty"`
+}
+
+// Route sets the priority and the producer of a message carrying the invoice, so that consumers can schedule it
+// without decoding its body.
+func (m MsgProcess) Route(msg *Message) {
+	msg.Priority = m.Priority
+	if m.Producer == "" {
+		return
+	}
+	if msg.Headers == nil {
+		msg.Headers = map[string]interface{}{}
+	}
+	msg.Headers[HeaderProducer] = m.Producer
 }
 
 type Rsp struct {
@@ -19,3 +72,47 @@ type Rsp struct {
 	RspType  string `json:"rsp_type" msgpack:"rsp_type"`
 	IsReady  bool   `json:"is_ready" msgpack:"is_ready"`
 }
+
+// RspError describes why a job has not succeeded.
+type RspError struct {
+	Code    string `json:"code" msgpack:"code"`
+	Message string `json:"message" msgpack:"message"`
+}
+
+// RspValidation holds the result reported by the validator.
+type RspValidation struct {
+	Mode   string `json:"mode" msgpack:"mode"`
+	Sex    string `json:"sex" msgpack:"sex"`
+	Error  string `json:"error" msgpack:"error"`
+	Passed bool   `json:"passed" msgpack:"passed"`
+}
+
+// RspTimings holds the time a job has taken.
+type RspTimings struct {
+	StartedAt  time.Time `json:"started_at" msgpack:"started_at"`
+	FinishedAt time.Time `json:"finished_at" msgpack:"finished_at"`
+	DurationMS int64     `json:"duration_ms" msgpack:"duration_ms"`
+}
+
+// NewRspTimings returns timings of a job started at the given time and finished now.
+func NewRspTimings(startedAt time.Time) RspTimings {
+	finishedAt := time.Now()
+	return RspTimings{
+		StartedAt:  startedAt.UTC(),
+		FinishedAt: finishedAt.UTC(),
+		DurationMS: finishedAt.Sub(startedAt).Milliseconds(),
+	}
+}
+
+// RspV2 extends Rsp keeping its fields, so that consumers of the first version can read it.
+type RspV2 struct {
+	Rsp           `msgpack:",inline"`
+	SchemaVersion int            `json:"schema_version" msgpack:"schema_version"`
+	Outcome       string         `json:"outcome" msgpack:"outcome"`
+	Error         *RspError      `json:"error,omitempty" msgpack:"error,omitempty"`
+	Validation    *RspValidation `json:"validation,omitempty" msgpack:"validation,omitempty"`
+	ProductCode   string         `json:"product_code,omitempty" msgpack:"product_code,omitempty"`
+	Barcode       string         `json:"barcode,omitempty" msgpack:"barcode,omitempty"`
+	Timings       RspTimings     `json:"timings" msgpack:"timings"`
+	S3Keys        []string       `json:"s3_keys,omitempty" msgpack:"s3_keys,omitempty"`
+}
@@ -0,0 +1,194 @@
+// Package modelbus provides models for AMQP transfer objects.
+
+package modelbus
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+const (
+	// HeaderRetryCount keeps the number of failed attempts to handle a message.
+	HeaderRetryCount = "x-retry-count"
+	// HeaderOriginalQueue keeps the queue a dead-lettered message is replayed to.
+	HeaderOriginalQueue = "x-original-queue"
+	// HeaderError keeps the error of the last failed attempt.
+	HeaderError = "x-error"
+	// HeaderDeadAt keeps the time a message was dead-lettered at.
+	HeaderDeadAt = "x-dead-at"
+	// HeaderNotBefore keeps the time a delayed message is handled at by transports without delayed queues.
+	HeaderNotBefore = "x-not-before"
+	// HeaderProducer keeps the producer or tenant a message is scheduled fairly for.
+	HeaderProducer = "x-producer"
+)
+
+// Headers keeping message properties on transports without them, see FlatHeaders.
+const (
+	HeaderContentType   = "content-type"
+	HeaderMessageID     = "x-message-id"
+	HeaderCorrelationID = "x-correlation-id"
+	HeaderTimestamp     = "x-timestamp"
+	HeaderPriority      = "x-priority"
+)
+
+// Message defines a message published to an exchange along with its properties.
+type Message struct {
+	ContentType   string
+	MessageID     string
+	CorrelationID string
+	Timestamp     time.Time
+	Priority      uint8
+	Headers       map[string]interface{}
+	Body          []byte
+}
+
+// Acknowledger settles a delivery with the transport it was received from.
+type Acknowledger interface {
+	Ack() error
+	Nack(requeue bool) error
+}
+
+// Delivery defines a message received from a queue, it has to be acknowledged or rejected once it is handled.
+type Delivery struct {
+	Message
+	Acknowledger
+}
+
+// HandlerFunc handles a delivery and returns the user identifier, the file name and the status of the job.
+type HandlerFunc func(ctx context.Context, d *Delivery) (string, string, bool, error)
+
+// Consumer defines a queue consumer: its queue, the exchange results of failed messages are sent to, the run type
+// reported in the results, the number of workers and the number of attempts to handle a message. Prefetch is the
+// number of deliveries held by the consumer, the ones waiting for a worker are scheduled by priority and fairly among
+// producers weighted by Weights, it is raised to the number of workers.
+type Consumer struct {
+	Queue       string
+	ExchangeOut string
+	RunType     string
+	Workers     int
+	Prefetch    int
+	Weights     map[string]int
+	MaxAttempts int
+}
+
+// DeadLetter defines a message moved to the dead-letter queue.
+type DeadLetter struct {
+	Queue       string
+	Attempts    int
+	Error       string
+	DeadAt      string
+	ContentType string
+	Body        []byte
+}
+
+// RetryCount returns the number of failed attempts recorded in message headers.
+func RetryCount(headers map[string]interface{}) int {
+	switch count := headers[HeaderRetryCount].(type) {
+	case int:
+		return count
+	case int8:
+		return int(count)
+	case int16:
+		return int(count)
+	case int32:
+		return int(count)
+	case int64:
+		return int(count)
+	case string:
+		value, _ := strconv.Atoi(count)
+		return value
+	default:
+		return 0
+	}
+}
+
+// HeaderString returns a string header or an empty string if it is missing.
+func HeaderString(headers map[string]interface{}, key string) string {
+	value, _ := headers[key].(string)
+	return value
+}
+
+// CopyHeaders copies message headers leaving out the given keys.
+func CopyHeaders(headers map[string]interface{}, without ...string) map[string]interface{} {
+	copied := map[string]interface{}{}
+	for key, value := range headers {
+		copied[key] = value
+	}
+	for _, key := range without {
+		delete(copied, key)
+	}
+	return copied
+}
+
+// NewDeadLetter returns a dead-lettered message described by its headers.
+func NewDeadLetter(msg *Message) DeadLetter {
+	return DeadLetter{
+		Queue:       HeaderString(msg.Headers, HeaderOriginalQueue),
+		Attempts:    RetryCount(msg.Headers),
+		Error:       HeaderString(msg.Headers, HeaderError),
+		DeadAt:      HeaderString(msg.Headers, HeaderDeadAt),
+		ContentType: msg.ContentType,
+		Body:        msg.Body,
+	}
+}
+
+// FlatHeaders returns message properties and headers as strings for transports carrying string headers only.
+func FlatHeaders(msg *Message) map[string]string {
+	flat := make(map[string]string, len(msg.Headers)+4)
+	for key, value := range msg.Headers {
+		switch value := value.(type) {
+		case string:
+			flat[key] = value
+		case int:
+			flat[key] = strconv.Itoa(value)
+		case int32:
+			flat[key] = strconv.Itoa(int(value))
+		case int64:
+			flat[key] = strconv.FormatInt(value, 10)
+		}
+	}
+	flat[HeaderContentType] = msg.ContentType
+	if msg.MessageID != "" {
+		flat[HeaderMessageID] = msg.MessageID
+	}
+	if msg.CorrelationID != "" {
+		flat[HeaderCorrelationID] = msg.CorrelationID
+	}
+	if !msg.Timestamp.IsZero() {
+		flat[HeaderTimestamp] = msg.Timestamp.Format(time.RFC3339Nano)
+	}
+	if msg.Priority > 0 {
+		flat[HeaderPriority] = strconv.Itoa(int(msg.Priority))
+	}
+	return flat
+}
+
+// NewFlatMessage returns a message with properties and headers taken from string headers, see FlatHeaders.
+func NewFlatMessage(flat map[string]string, body []byte) Message {
+	msg := Message{
+		ContentType:   flat[HeaderContentType],
+		MessageID:     flat[HeaderMessageID],
+		CorrelationID: flat[HeaderCorrelationID],
+		Headers:       make(map[string]interface{}, len(flat)),
+		Body:          body,
+	}
+	msg.Timestamp, _ = time.Parse(time.RFC3339Nano, flat[HeaderTimestamp])
+	if priority, err := strconv.ParseUint(flat[HeaderPriority], 10, 8); err == nil {
+		msg.Priority = uint8(priority)
+	}
+	for key, value := range flat {
+		switch key {
+		case HeaderContentType, HeaderMessageID, HeaderCorrelationID, HeaderTimestamp, HeaderPriority:
+		default:
+			msg.Headers[key] = value
+		}
+	}
+	return msg
+}
+
+// NotBefore returns the time a delayed message is handled at, it is zero for a message which is not delayed.
+func NotBefore(headers map[string]interface{}) time.Time {
+	notBefore, _ := time.Parse(time.RFC3339Nano, HeaderString(headers, HeaderNotBefore))
+	return notBefore
+}
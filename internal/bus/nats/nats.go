@@ -0,0 +1,441 @@
+// Package nats implements a NATS JetStream transport.
+
+package nats
+
+import (
+	"context"
+	stdErrors "errors"
+	"fmt"
+	"strings"
+	"time"
+	"upload-service-auto/internal/bus/dispatch"
+	"upload-service-auto/internal/bus/errors"
+	"upload-service-auto/internal/bus/modelbus"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/syncutils"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+)
+
+// fetchTimeout limits a single pull request, consumers issue a new one once it expires.
+const fetchTimeout = 5 * time.Second
+
+// consumerName replaces characters JetStream does not allow in consumer names.
+var consumerName = strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_")
+
+// NATS defines a JetStream client object and sets its attributes. Exchanges are subjects of one stream, a queue is a
+// set of durable pull consumers, one per subject the queue is bound to, so every queue receives every message
+// published to its exchanges. Delayed retries are published to a retry subject of the queue and are redelivered by
+// the server until they are due.
+type NATS struct {
+	config    *config.Config
+	log       *zerolog.Logger
+	conn      *nats.Conn
+	js        nats.JetStreamContext
+	bindings  map[string][]string
+	syncUtils *syncutils.SyncUtils
+}
+
+// NewNATS initializes a new NATS service.
+func NewNATS(config *config.Config, logger *zerolog.Logger, syncUtils *syncutils.SyncUtils) *NATS {
+	logger.Debug().Msg("calling initializer of NATS service")
+	n := &NATS{
+		config:    config,
+		log:       logger,
+		bindings:  dispatch.Bindings(config),
+		syncUtils: syncUtils,
+	}
+	if err := n.init(); err != nil {
+		n.log.Fatal().Err(err).Msg(errors.NATSConnectionError)
+	}
+	return n
+}
+
+// init connects to NATS, declares the stream and its consumers and closes the connection once the shared context is
+// done. The client reconnects on its own if the connection is lost.
+func (n *NATS) init() error {
+	n.log.Debug().Msg("calling `init` method")
+	conn, err := nats.Connect(n.config.NATS.URL,
+		nats.Name("upload-service"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			n.log.Warn().Err(err).Msg("NATS: disconnected")
+		}),
+		nats.ReconnectHandler(func(*nats.Conn) {
+			n.log.Info().Msg("NATS: reconnected")
+		}))
+	if err != nil {
+		return err
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	n.conn = conn
+	n.js = js
+
+	if err = n.declare(); err != nil {
+		conn.Close()
+		return err
+	}
+	n.log.Info().Msg("NATS: connected")
+
+	n.syncUtils.Wg.Add(1)
+	go func() {
+		defer n.syncUtils.Wg.Done()
+		<-n.syncUtils.Ctx.Done()
+		if err := n.conn.Drain(); err != nil {
+			n.log.Error().Err(err).Msg(errors.AMQPClosingError)
+			return
+		}
+		n.log.Debug().Msg("NATS connection was closed")
+	}()
+	return nil
+}
+
+// durable returns a name of the consumer delivering messages of a subject to a queue.
+func durable(queue, subject string) string {
+	return consumerName.Replace(fmt.Sprintf("%s_%s", queue, subject))
+}
+
+// declare creates or updates the stream holding all exchanges and retry subjects and creates missing consumers of the
+// queues. New consumers start with messages published after they are created, as messages published to an exchange
+// without bound queues are dropped by AMQP.
+func (n *NATS) declare() error {
+	n.log.Debug().Msg("calling `declare` method")
+	var subjects []string
+	retries := map[string]bool{}
+	for exchange, queues := range n.bindings {
+		subjects = append(subjects, exchange)
+		for _, queue := range queues {
+			retries[queue] = true
+		}
+	}
+	for queue := range retries {
+		subjects = append(subjects, dispatch.RetryName(queue))
+	}
+	stream := &nats.StreamConfig{
+		Name:      n.config.NATS.Stream,
+		Subjects:  subjects,
+		Retention: nats.LimitsPolicy,
+		Storage:   nats.FileStorage,
+		MaxAge:    n.config.NATS.MaxAge,
+	}
+	_, err := n.js.StreamInfo(stream.Name)
+	switch {
+	case stdErrors.Is(err, nats.ErrStreamNotFound):
+		_, err = n.js.AddStream(stream)
+	case err == nil:
+		_, err = n.js.UpdateStream(stream)
+	}
+	if err != nil {
+		n.log.Error().Err(err).Msg(errors.NATSStreamDeclarationError)
+		return err
+	}
+
+	for exchange, queues := range n.bindings {
+		for _, queue := range queues {
+			if err = n.declareConsumer(queue, exchange); err != nil {
+				return err
+			}
+		}
+	}
+	for queue := range retries {
+		if err = n.declareConsumer(queue, dispatch.RetryName(queue)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// declareConsumer creates a durable pull consumer delivering messages of a subject to a queue unless it exists.
+func (n *NATS) declareConsumer(queue, subject string) error {
+	name := durable(queue, subject)
+	_, err := n.js.ConsumerInfo(n.config.NATS.Stream, name)
+	if err == nil {
+		return nil
+	}
+	if stdErrors.Is(err, nats.ErrConsumerNotFound) {
+		_, err = n.js.AddConsumer(n.config.NATS.Stream, &nats.ConsumerConfig{
+			Durable:       name,
+			FilterSubject: subject,
+			DeliverPolicy: nats.DeliverNewPolicy,
+			AckPolicy:     nats.AckExplicitPolicy,
+			AckWait:       n.config.NATS.AckWait,
+		})
+	}
+	if err != nil {
+		n.log.Error().Err(err).Str("consumer", name).Msg(errors.NATSStreamDeclarationError)
+		return err
+	}
+	return nil
+}
+
+// publish publishes a message to a subject and waits for the stream to store it.
+func (n *NATS) publish(subject string, msg modelbus.Message) error {
+	out := nats.NewMsg(subject)
+	for key, value := range modelbus.FlatHeaders(&msg) {
+		out.Header.Set(key, value)
+	}
+	out.Data = msg.Body
+	_, err := n.js.PublishMsg(out, nats.AckWait(n.config.AMQP.ConfirmTimeout))
+	return err
+}
+
+// message converts a JetStream message to a message.
+func message(msg *nats.Msg) modelbus.Message {
+	flat := make(map[string]string, len(msg.Header))
+	for key := range msg.Header {
+		flat[key] = msg.Header.Get(key)
+	}
+	return modelbus.NewFlatMessage(flat, msg.Data)
+}
+
+// Publish publishes a message to the specified exchange and waits for the stream to store it.
+func (n *NATS) Publish(exchange string, msg modelbus.Message) error {
+	n.log.Debug().Msg("calling `Publish` method")
+	if _, ok := n.bindings[exchange]; !ok {
+		err := fmt.Errorf("%s: %s", exchange, errors.BusUnknownExchangeError)
+		n.log.Error().Err(err).Msg(errors.AMQPPublishingError)
+		return err
+	}
+	if err := n.publish(exchange, msg); err != nil {
+		n.log.Error().Err(err).Msg(errors.AMQPPublishingError)
+		return err
+	}
+	n.log.Info().Msg("message was successfully published to NATS")
+	return nil
+}
+
+// Delay puts a message back to a queue through its retry subject, the message is redelivered until the delay of the
+// given retry is over. The last delay is used for all further retries.
+func (n *NATS) Delay(queue string, retry int, msg modelbus.Message) error {
+	n.log.Debug().Msg("calling `Delay` method")
+	msg.Headers = modelbus.CopyHeaders(msg.Headers)
+	msg.Headers[modelbus.HeaderNotBefore] = time.Now().Add(dispatch.RetryDelay(n.config, retry)).Format(time.RFC3339Nano)
+	return n.publish(dispatch.RetryName(queue), msg)
+}
+
+// DeadLetter moves a message to the dead-letter exchange.
+func (n *NATS) DeadLetter(msg modelbus.Message) error {
+	n.log.Debug().Msg("calling `DeadLetter` method")
+	return n.publish(n.config.AMQP.DeadLetterExchangeName, msg)
+}
+
+// acknowledger settles a JetStream message, the server is told the message is in progress until it is settled, so
+// that messages waiting for a worker and long jobs are not redelivered once the ack wait is over.
+type acknowledger struct {
+	msg  *nats.Msg
+	done chan struct{}
+}
+
+// newAcknowledger returns an acknowledger of a message telling the server it is in progress every half of the ack wait.
+func newAcknowledger(msg *nats.Msg, ackWait time.Duration) *acknowledger {
+	a := &acknowledger{msg: msg, done: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(ackWait / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.done:
+				return
+			case <-ticker.C:
+				_ = msg.InProgress()
+			}
+		}
+	}()
+	return a
+}
+
+// Ack acknowledges the message and waits for the server to confirm it.
+func (a *acknowledger) Ack() error {
+	close(a.done)
+	return a.msg.AckSync()
+}
+
+// Nack rejects the message, it is redelivered if requeue is set and is never redelivered otherwise.
+func (a *acknowledger) Nack(requeue bool) error {
+	close(a.done)
+	if requeue {
+		return a.msg.Nak()
+	}
+	return a.msg.Term()
+}
+
+// subscribe binds a pull subscription to a consumer declared for a queue.
+func (n *NATS) subscribe(queue, subject string) (*nats.Subscription, error) {
+	sub, err := n.js.PullSubscribe(subject, "", nats.Bind(n.config.NATS.Stream, durable(queue, subject)))
+	if err != nil {
+		n.log.Error().Err(err).Str("subject", subject).Msg(errors.NATSSubscriptionError)
+		return nil, err
+	}
+	return sub, nil
+}
+
+// fetch pulls one message of a subscription, it returns nil once the pull request expires without messages.
+func (n *NATS) fetch(ctx context.Context, sub *nats.Subscription) (*nats.Msg, error) {
+	ctxFetch, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	msgs, err := sub.Fetch(1, nats.Context(ctxFetch))
+	if err != nil {
+		if stdErrors.Is(err, context.DeadlineExceeded) || stdErrors.Is(err, nats.ErrTimeout) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	return msgs[0], nil
+}
+
+// Consume handles deliveries of a queue by the given number of workers until the context is done. Failed messages
+// are retried after a delay and moved to the dead-letter subject once the attempts are exhausted. The consumer is
+// resumed once it fails until the context is done, unacknowledged messages are redelivered by the server.
+func (n *NATS) Consume(ctx context.Context, consumer modelbus.Consumer, fn modelbus.HandlerFunc) error {
+	if consumer.Workers < 1 {
+		consumer.Workers = 1
+	}
+	for {
+		err := n.consume(ctx, consumer, fn)
+		if ctx.Err() != nil {
+			n.log.Info().Str("queue", consumer.Queue).Msg("NATS: consumer stopped")
+			return nil
+		}
+		n.log.Warn().Err(err).Str("queue", consumer.Queue).Msg(errors.AMQPConsumerLostError)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(n.config.AMQP.ReconnectMinDelay):
+		}
+	}
+}
+
+// consume handles deliveries of a queue until a worker fails or the context is done. Every subject the queue is bound
+// to is pulled by its own fetcher, a delayed message is returned to the server until it is due.
+func (n *NATS) consume(ctx context.Context, consumer modelbus.Consumer, fn modelbus.HandlerFunc) error {
+	n.log.Debug().Msg("calling `consume` method")
+	var fetchers []dispatch.Fetcher
+	for _, subject := range append(dispatch.Exchanges(n.config, consumer.Queue), dispatch.RetryName(consumer.Queue)) {
+		sub, err := n.subscribe(consumer.Queue, subject)
+		if err != nil {
+			return err
+		}
+		defer sub.Unsubscribe()
+
+		fetchers = append(fetchers, func(ctx context.Context) (*modelbus.Delivery, error) {
+			msg, err := n.fetch(ctx, sub)
+			if err != nil {
+				if ctx.Err() == nil {
+					n.log.Error().Err(err).Str("queue", consumer.Queue).Msg(errors.NATSFetchingError)
+				}
+				return nil, err
+			}
+			if msg == nil {
+				return nil, nil
+			}
+			delivered := message(msg)
+			if notBefore := modelbus.NotBefore(delivered.Headers); time.Now().Before(notBefore) {
+				_ = msg.NakWithDelay(time.Until(notBefore))
+				return nil, nil
+			}
+			return &modelbus.Delivery{
+				Message:      delivered,
+				Acknowledger: newAcknowledger(msg, n.config.NATS.AckWait),
+			}, nil
+		})
+	}
+
+	n.log.Info().Str("queue", consumer.Queue).Int("workers", consumer.Workers).Msg("NATS: consumer started")
+
+	if err := dispatch.Serve(ctx, n.log, n, consumer, fn, fetchers...); err != nil {
+		n.log.Error().Err(err).Msg(errors.AMQPListeningError)
+		return err
+	}
+	return nil
+}
+
+// browseDeadLetters returns up to limit messages of the dead-letter queue fn returns true for, all of them are returned
+// if limit is 0. The returned messages are removed from the queue if ack is set, the rest are returned to the queue
+// once browsing is over.
+func (n *NATS) browseDeadLetters(limit int, ack bool, fn func(msg *nats.Msg, letter *modelbus.DeadLetter) (bool, error)) ([]modelbus.DeadLetter, error) {
+	n.log.Debug().Msg("calling `browseDeadLetters` method")
+	sub, err := n.subscribe(n.config.AMQP.DeadLetterQueueName, n.config.AMQP.DeadLetterExchangeName)
+	if err != nil {
+		n.log.Error().Err(err).Msg(errors.AMQPDeadLetterReadingError)
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+
+	// messages left in the queue are held until browsing is over, so that they are not fetched again
+	var held []*nats.Msg
+	defer func() {
+		for _, msg := range held {
+			_ = msg.Nak()
+		}
+	}()
+
+	var letters []modelbus.DeadLetter
+	for limit == 0 || len(letters) < limit {
+		msg, err := n.fetch(n.syncUtils.Ctx, sub)
+		if err != nil {
+			n.log.Error().Err(err).Msg(errors.AMQPDeadLetterReadingError)
+			return nil, err
+		}
+		if msg == nil {
+			break
+		}
+		delivered := message(msg)
+		letter := modelbus.NewDeadLetter(&delivered)
+		matched, err := fn(msg, &letter)
+		if err != nil {
+			held = append(held, msg)
+			return nil, err
+		}
+		if !matched || !ack {
+			held = append(held, msg)
+		} else if err = msg.AckSync(); err != nil {
+			n.log.Error().Err(err).Msg(errors.AMQPAckError)
+			return nil, err
+		}
+		if matched {
+			letters = append(letters, letter)
+		}
+		if meta, err := msg.Metadata(); err == nil && meta.NumPending == 0 {
+			break
+		}
+	}
+	return letters, nil
+}
+
+// ListDeadLetters returns up to limit messages of the dead-letter queue leaving them in the queue, all messages are
+// returned if limit is 0.
+func (n *NATS) ListDeadLetters(limit int) ([]modelbus.DeadLetter, error) {
+	n.log.Debug().Msg("calling `ListDeadLetters` method")
+	return n.browseDeadLetters(limit, false, func(*nats.Msg, *modelbus.DeadLetter) (bool, error) {
+		return true, nil
+	})
+}
+
+// ReplayDeadLetters puts up to limit messages of the dead-letter queue matching a filter back to their queues with
+// the retry count reset, all matching messages are replayed if limit is 0.
+func (n *NATS) ReplayDeadLetters(limit int, match func(letter *modelbus.DeadLetter) bool) ([]modelbus.DeadLetter, error) {
+	n.log.Debug().Msg("calling `ReplayDeadLetters` method")
+	return n.browseDeadLetters(limit, true, func(msg *nats.Msg, letter *modelbus.DeadLetter) (bool, error) {
+		if letter.Queue == "" || len(dispatch.Exchanges(n.config, letter.Queue)) == 0 || !match(letter) {
+			return false, nil
+		}
+		replayed := message(msg)
+		replayed.Headers = modelbus.CopyHeaders(replayed.Headers, modelbus.HeaderRetryCount, modelbus.HeaderOriginalQueue,
+			modelbus.HeaderError, modelbus.HeaderDeadAt, modelbus.HeaderNotBefore)
+		if err := n.publish(dispatch.RetryName(letter.Queue), replayed); err != nil {
+			n.log.Error().Err(err).Str("queue", letter.Queue).Msg(errors.AMQPDeadLetterReplayError)
+			return false, err
+		}
+		return true, nil
+	})
+}
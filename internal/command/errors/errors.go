@@ -12,4 +12,9 @@ const (
 	FileNotFoundError            = "could not find file name in DB"
 	GettingProcessingStatusError = "could not find processing status in DB"
 	GettingProductCodeError      = "could not find product code in DB"
+	GettingUploadsError          = "could not find uploads in DB"
+	GettingValidationResultError = "could not find validation result in DB"
+	ReapingJobsError             = "could not expire stale jobs"
+	PruningWorkspacesError       = "could not remove expired workspaces"
+	ReconcilingError             = "could not reconcile DB with S3"
 )
@@ -10,7 +10,7 @@ import (
 	"upload-service-auto/internal/command/errors"
 	"upload-service-auto/internal/config"
 	"upload-service-auto/internal/processor/v1/processor"
-	"upload-service-auto/internal/storage/v1/psql"
+	"upload-service-auto/internal/storage"
 	"upload-service-auto/internal/syncutils"
 
 	"github.com/rs/zerolog"
@@ -21,7 +21,7 @@ import (
 type ProcessCommand struct {
 	log       *zerolog.Logger
 	cfg       *config.Config
-	storage   *psql.Storage
+	storage   storage.Storage
 	proc      *processor.Processor
 	syncUtils *syncutils.SyncUtils
 	agent     *agent.Agent
@@ -30,7 +30,7 @@ type ProcessCommand struct {
 func NewProcessCommand(
 	logger *zerolog.Logger,
 	cfg *config.Config,
-	storage *psql.Storage,
+	storage storage.Storage,
 	proc *processor.Processor,
 	syncUtils *syncutils.SyncUtils,
 	agent *agent.Agent,
@@ -97,7 +97,7 @@ func (t *ProcessCommand) Execute(ctx *cli.Context) error {
 		t.syncUtils.Wg.Wait()
 	}()
 
-	err := t.agent.Process(ctxMain, userID, barcode, handler, dryRun, fromQueue)
+	err := t.agent.Process(ctxMain, userID, barcode, "", handler, dryRun, fromQueue)
 	if err != nil {
 		t.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.ProcessingRunError)
 		return err
@@ -106,26 +106,19 @@ func (t *ValidateCommand) Execute(ctx *cli.Context) error {
 
 	tempFileRelName := uuid.New().String() + "_" + fileName
 
-	tempFile, err := os.Create(t.cfg.Docker.MountDir + "/source/" + tempFileRelName)
-	defer func(tempFile *os.File) {
-		err := tempFile.Close()
-		if err != nil {
-			panic(err)
-		}
-	}(tempFile)
-	if err != nil {
-		t.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.TempFileOpeningError)
-		return err
-	}
-
-	_, err = tempFile.Write(f)
+	// the file is moved into the job workspace by validation and is kept only if it is to be processed
+	tempFilePath := t.cfg.Docker.MountDir + "/source/" + tempFileRelName
+	err = os.WriteFile(tempFilePath, f, 0o644)
 	if err != nil {
+		_ = os.Remove(tempFilePath)
 		t.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.TempFileWritingError)
 		return err
 	}
 
-	validationData, err := t.agent.Validate(ctxMain, userID, tempFileRelName, handler, dryRun, fromQueue)
+	validationData, err := t.agent.Validate(ctxMain, userID, tempFileRelName, "", handler, dryRun, fromQueue)
 	if err != nil {
+		// the file is left behind if validation fails before it is moved
+		_ = os.Remove(tempFilePath)
 		t.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.ValidationRunError)
 		return err
 	}
@@ -16,6 +16,7 @@ import (
 	"upload-service-auto/internal/api/v1/rest/handlers"
 	"upload-service-auto/internal/api/v1/rest/middleware"
 	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/metrics"
 	"upload-service-auto/internal/syncutils"
 
 	"github.com/go-chi/chi"
@@ -87,7 +88,10 @@ func (t *ServeCommand) Execute(ctx *cli.Context) error {
 	r.Use(middleware.DecompressHandle)
 	r.Get("/api/v1/status/{userID}", t.endpointHandlers.GetProcessingStatusHandle)
 	r.Get("/api/v1/product/{userID}", t.endpointHandlers.GetProductCodeHandle)
+	r.Get("/api/v1/validation/{userID}", t.endpointHandlers.GetValidationResultHandle)
+	r.Get("/api/v1/users/{userID}/uploads", t.endpointHandlers.GetUserUploadsHandle)
 	r.Mount("/api/v1/doc", httpSwagger.WrapHandler)
+	r.Handle(metrics.Path, metrics.Handler())
 
 	srv := &http.Server{
 		Addr:         addr,
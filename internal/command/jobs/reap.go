@@ -0,0 +1,114 @@
+// Package jobs provides CLI commands definitions and execution logic.
+
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+	"upload-service-auto/internal/command/errors"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/reaper"
+	"upload-service-auto/internal/syncutils"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+// ReapCommand defines a new command struct and sets its attributes.
+type ReapCommand struct {
+	log       *zerolog.Logger
+	cfg       *config.Config
+	reaper    *reaper.Reaper
+	syncUtils *syncutils.SyncUtils
+}
+
+// NewReapCommand creates a new command instance.
+func NewReapCommand(
+	logger *zerolog.Logger,
+	cfg *config.Config,
+	reaper *reaper.Reaper,
+	syncUtils *syncutils.SyncUtils,
+) *ReapCommand {
+	logger.Debug().Msg("calling initializer of jobs:reap command")
+	return &ReapCommand{
+		log:       logger,
+		cfg:       cfg,
+		reaper:    reaper,
+		syncUtils: syncUtils,
+	}
+}
+
+// Describe handles command description when invoked.
+func (t *ReapCommand) Describe() *cli.Command {
+	return &cli.Command{
+		Category: "jobs",
+		Name:     "jobs:reap",
+		Usage:    "Expire validation and processing jobs whose lease has run out and prune expired workspaces",
+		Action:   t.Execute,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "action",
+				Usage: fmt.Sprintf("Action applied to stale jobs, `%s` or `%s`", reaper.ActionError, reaper.ActionRequeue),
+				Value: t.cfg.Jobs.ReapAction,
+			},
+		},
+	}
+}
+
+// Execute runs the command-associated execution logic.
+func (t *ReapCommand) Execute(ctx *cli.Context) error {
+	const (
+		handler    = "jobs:reap"
+		handlerKey = "cli_command"
+	)
+
+	var (
+		action = ctx.String("action")
+	)
+
+	t.log.Info().Str(handlerKey, handler).Msg(fmt.Sprintf("CLI: %s endpoint hit", handler))
+
+	ctxMain, cancel := context.WithTimeout(t.syncUtils.Ctx, 60*time.Second)
+	defer func() {
+		cancel()
+		t.syncUtils.SyncCancel()
+		t.syncUtils.Wg.Wait()
+	}()
+
+	jobs, err := t.reaper.Reap(ctxMain, action)
+	if err != nil {
+		t.log.Error().Err(err).Str(handlerKey, handler).Msg(errors.ReapingJobsError)
+		return err
+	}
+
+	pruned, err := t.reaper.PruneWorkspaces(ctxMain)
+	if err != nil {
+		t.log.Error().Err(err).Str(handlerKey, handler).Msg(errors.PruningWorkspacesError)
+		return err
+	}
+	t.log.Info().Str(handlerKey, handler).Int("workspaces", pruned).Msg("expired workspaces removed")
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Job",
+		"User ID",
+		"File Name",
+		"Barcode",
+		"Last Heartbeat",
+	})
+	for _, job := range jobs {
+		table.Append([]string{
+			job.Kind,
+			job.UserID,
+			job.FileName,
+			job.Barcode,
+			job.HeartbeatAt.Format(time.RFC3339),
+		})
+	}
+	table.Render()
+
+	return nil
+}
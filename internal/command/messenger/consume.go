@@ -3,14 +3,18 @@
 package messenger
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 	"upload-service-auto/internal/bus/handlers"
 	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/metrics"
+	"upload-service-auto/internal/outbox"
 	"upload-service-auto/internal/processor/v1/processor"
-	"upload-service-auto/internal/storage/v1/psql"
+	"upload-service-auto/internal/reaper"
+	"upload-service-auto/internal/storage"
 	"upload-service-auto/internal/syncutils"
 
 	"github.com/rs/zerolog"
@@ -21,20 +25,24 @@ import (
 type ConsumeCommand struct {
 	log       *zerolog.Logger
 	cfg       *config.Config
-	storage   *psql.Storage
+	storage   storage.Storage
 	proc      *processor.Processor
 	syncUtils *syncutils.SyncUtils
 	handler   *handlers.AMQPHandler
+	reaper    *reaper.Reaper
+	relay     *outbox.Relay
 }
 
 // NewConsumeCommand creates a new command instance.
 func NewConsumeCommand(
 	logger *zerolog.Logger,
 	cfg *config.Config,
-	storage *psql.Storage,
+	storage storage.Storage,
 	proc *processor.Processor,
 	syncUtils *syncutils.SyncUtils,
 	handler *handlers.AMQPHandler,
+	reaper *reaper.Reaper,
+	relay *outbox.Relay,
 ) *ConsumeCommand {
 	logger.Debug().Msg("calling initializer of messenger:consume command")
 	return &ConsumeCommand{
@@ -44,6 +52,8 @@ func NewConsumeCommand(
 		proc:      proc,
 		syncUtils: syncUtils,
 		handler:   handler,
+		reaper:    reaper,
+		relay:     relay,
 	}
 }
 
@@ -65,15 +75,45 @@ func (t *ConsumeCommand) Execute(ctx *cli.Context) error {
 	)
 	t.log.Info().Str(handlerKey, handler).Msg(fmt.Sprintf("CLI: %s endpoint hit", handler))
 
+	// running jobs are cancelled first and the shared context is cancelled by the handler once they are finished,
+	// so that the final statuses are saved before DB and AMQP connections are closed
+	ctxJobs, cancel := context.WithCancel(t.syncUtils.Ctx)
+	defer cancel()
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	t.syncUtils.Wg.Add(1)
 	go func() {
-		<-done
-		t.log.Info().Msg("AMQP client shutdown attempted")
-		t.syncUtils.SyncCancel()
-		t.syncUtils.Wg.Done()
+		defer t.syncUtils.Wg.Done()
+		select {
+		case <-done:
+			t.log.Info().Msg("AMQP client shutdown attempted")
+			cancel()
+		case <-t.syncUtils.Ctx.Done():
+		}
 	}()
 
-	return t.handler.Handle(t.syncUtils.Ctx)
+	if t.cfg.Metrics.Addr != "" {
+		t.syncUtils.Wg.Add(1)
+		go func() {
+			defer t.syncUtils.Wg.Done()
+			metrics.Serve(t.syncUtils.Ctx, t.cfg.Metrics.Addr, t.log)
+		}()
+	}
+
+	// stale jobs left by crashed consumers are expired in background
+	t.syncUtils.Wg.Add(1)
+	go func() {
+		defer t.syncUtils.Wg.Done()
+		t.reaper.Run(ctxJobs)
+	}()
+
+	// statuses saved to the outbox are sent to rrs in background, messages left on shutdown are sent once a consumer
+	// is started again
+	t.syncUtils.Wg.Add(1)
+	go func() {
+		defer t.syncUtils.Wg.Done()
+		t.relay.Run(t.syncUtils.Ctx)
+	}()
+
+	return t.handler.Handle(ctxJobs)
 }
@@ -5,13 +5,15 @@ package messenger
 import (
 	"encoding/json"
 	"fmt"
-	busamqp "upload-service-auto/internal/bus/amqp"
+	"strconv"
+	"time"
+	"upload-service-auto/internal/bus"
+	"upload-service-auto/internal/bus/codec"
 	"upload-service-auto/internal/bus/errors"
 	"upload-service-auto/internal/bus/modelbus"
 	"upload-service-auto/internal/config"
 	"upload-service-auto/internal/syncutils"
 
-	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
 )
@@ -20,7 +22,7 @@ import (
 type CreateCommand struct {
 	log       *zerolog.Logger
 	cfg       *config.Config
-	amqp      *busamqp.AMQP
+	bus       bus.Bus
 	syncUtils *syncutils.SyncUtils
 }
 
@@ -28,14 +30,14 @@ type CreateCommand struct {
 func NewCreateCommand(
 	logger *zerolog.Logger,
 	cfg *config.Config,
-	amqp *busamqp.AMQP,
+	bus bus.Bus,
 	syncUtils *syncutils.SyncUtils,
 ) *CreateCommand {
 	logger.Debug().Msg("calling initializer of messenger:create command")
 	return &CreateCommand{
 		log:       logger,
 		cfg:       cfg,
-		amqp:      amqp,
+		bus:       bus,
 		syncUtils: syncUtils,
 	}
 }
@@ -76,6 +78,27 @@ func (t *CreateCommand) Describe() *cli.Command {
 				Aliases:  []string{"f"},
 				Required: true,
 			},
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "Encoding of `validate` and `process` invoices, either `json` or `msgpack`",
+				Value: codec.FormatJSON,
+			},
+			&cli.StringFlag{
+				Name:  "correlation-id",
+				Usage: "Correlation identifier sent in the envelope of `validate` and `process` invoices",
+			},
+			&cli.UintFlag{
+				Name:  "priority",
+				Usage: "Priority of `process` invoices, invoices of a higher priority are processed first, up to AMQP_PROCESSING_MAX_PRIORITY",
+			},
+			&cli.StringFlag{
+				Name:  "producer",
+				Usage: "Producer or tenant of `process` invoices, invoices of different producers are processed in turns",
+			},
+			&cli.StringFlag{
+				Name:  "message-id",
+				Usage: "Message identifier of `validate` and `process` invoices, invoices sent again with the same identifier are answered with the known result, a new identifier is generated if empty",
+			},
 		},
 	}
 }
@@ -88,11 +111,16 @@ func (t *CreateCommand) Execute(ctx *cli.Context) error {
 	)
 
 	var (
-		messageType  = ctx.String("type")
-		responseType = ctx.String("response-type")
-		userID       = ctx.String("user-id")
-		fileName     = ctx.String("file-name")
-		barcode      = ctx.String("barcode")
+		messageType   = ctx.String("type")
+		responseType  = ctx.String("response-type")
+		userID        = ctx.String("user-id")
+		fileName      = ctx.String("file-name")
+		barcode       = ctx.String("barcode")
+		format        = ctx.String("format")
+		correlationID = ctx.String("correlation-id")
+		messageID     = ctx.String("message-id")
+		priority      = ctx.Uint("priority")
+		producer      = ctx.String("producer")
 	)
 
 	defer func() {
@@ -102,25 +130,40 @@ func (t *CreateCommand) Execute(ctx *cli.Context) error {
 
 	t.log.Info().Str(handlerKey, handler).Msg(fmt.Sprintf("CLI: %s endpoint hit", handler))
 
+	contentType, err := codec.ContentType(format)
+	if err != nil {
+		return err
+	}
+	envelope := codec.NewEnvelope(correlationID)
+	if messageID != "" {
+		envelope.MessageID = messageID
+	}
+
 	switch messageType {
 	case "ready":
 		if responseType == "" {
 			return fmt.Errorf("string flag `--response-type` is required for `%s` message type", messageType)
 		}
-		msg := modelbus.Rsp{
-			UserID:   userID,
-			FileName: fileName,
-			RspType:  responseType,
-			IsReady:  true,
+		msg := modelbus.RspV2{
+			Rsp: modelbus.Rsp{
+				UserID:   userID,
+				FileName: fileName,
+				RspType:  responseType,
+				IsReady:  true,
+			},
+			SchemaVersion: modelbus.RspSchemaVersion,
+			Outcome:       modelbus.OutcomeSucceeded,
+			Barcode:       barcode,
+			Timings:       modelbus.NewRspTimings(time.Now()),
 		}
 		serialized, err := json.Marshal(msg)
 		if err != nil {
 			t.log.Error().Err(err).Msg(errors.AMQPMarshallingError)
 			return err
 		}
-		publishing := amqp.Publishing{
+		publishing := modelbus.Message{
 			ContentType: "application/json",
-			Headers:     amqp.Table{},
+			Headers:     map[string]interface{}{modelbus.HeaderSchemaVersion: strconv.Itoa(modelbus.RspSchemaVersion)},
 			Body:        serialized,
 		}
 		var exchName string
@@ -129,7 +172,7 @@ func (t *CreateCommand) Execute(ctx *cli.Context) error {
 		} else if responseType == "processing" {
 			exchName = t.cfg.AMQP.ProcessingExchangeOutputName
 		}
-		err = t.amqp.PublishToExchange(exchName, publishing)
+		err = t.bus.Publish(exchName, publishing)
 		if err != nil {
 			t.log.Error().Err(err).Msg(errors.AMQPSendingError)
 			return err
@@ -140,17 +183,12 @@ func (t *CreateCommand) Execute(ctx *cli.Context) error {
 			UserID:   userID,
 			FileName: fileName,
 		}
-		serialized, err := json.Marshal(msg)
+		publishing, err := codec.Message(contentType, envelope, msg)
 		if err != nil {
-			t.log.Error().Err(err).Msg(errors.AMQPMarshallingError)
+			t.log.Error().Err(err).Msg(errors.AMQPEncodingError)
 			return err
 		}
-		publishing := amqp.Publishing{
-			ContentType: "application/json",
-			Headers:     amqp.Table{},
-			Body:        serialized,
-		}
-		err = t.amqp.PublishToExchange(t.cfg.AMQP.ValidationExchangeInputName, publishing)
+		err = t.bus.Publish(t.cfg.AMQP.ValidationExchangeInputName, publishing)
 		if err != nil {
 			t.log.Error().Err(err).Msg(errors.AMQPSendingError)
 			return err
@@ -160,22 +198,23 @@ func (t *CreateCommand) Execute(ctx *cli.Context) error {
 		if barcode == "" {
 			return fmt.Errorf("string flag `--barcode` is required for `%s` message type", messageType)
 		}
+		if priority > uint(t.cfg.AMQP.ProcessingMaxPriority) {
+			return fmt.Errorf("flag `--priority` must not exceed %d", t.cfg.AMQP.ProcessingMaxPriority)
+		}
 		msg := modelbus.MsgProcess{
 			UserID:   userID,
 			FileName: fileName,
 			Barcode:  barcode,
+			Priority: uint8(priority),
+			Producer: producer,
 		}
-		serialized, err := json.Marshal(msg)
+		publishing, err := codec.Message(contentType, envelope, msg)
 		if err != nil {
-			t.log.Error().Err(err).Msg(errors.AMQPMarshallingError)
+			t.log.Error().Err(err).Msg(errors.AMQPEncodingError)
 			return err
 		}
-		publishing := amqp.Publishing{
-			ContentType: "application/json",
-			Headers:     amqp.Table{},
-			Body:        serialized,
-		}
-		err = t.amqp.PublishToExchange(t.cfg.AMQP.ProcessingExchangeInputName, publishing)
+		msg.Route(&publishing)
+		err = t.bus.Publish(t.cfg.AMQP.ProcessingExchangeInputName, publishing)
 		if err != nil {
 			t.log.Error().Err(err).Msg(errors.AMQPSendingError)
 			return err
@@ -0,0 +1,123 @@
+// Package messenger provides CLI commands definitions and execution logic.
+
+package messenger
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"upload-service-auto/internal/bus"
+	"upload-service-auto/internal/bus/codec"
+	"upload-service-auto/internal/bus/errors"
+	"upload-service-auto/internal/bus/modelbus"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/syncutils"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+// DLQListCommand defines a new command struct and sets its attributes.
+type DLQListCommand struct {
+	log       *zerolog.Logger
+	cfg       *config.Config
+	bus       bus.Bus
+	syncUtils *syncutils.SyncUtils
+}
+
+// NewDLQListCommand creates a new command instance.
+func NewDLQListCommand(
+	logger *zerolog.Logger,
+	cfg *config.Config,
+	bus bus.Bus,
+	syncUtils *syncutils.SyncUtils,
+) *DLQListCommand {
+	logger.Debug().Msg("calling initializer of messenger:dlq:list command")
+	return &DLQListCommand{
+		log:       logger,
+		cfg:       cfg,
+		bus:       bus,
+		syncUtils: syncUtils,
+	}
+}
+
+// Describe handles command description when invoked.
+func (t *DLQListCommand) Describe() *cli.Command {
+	return &cli.Command{
+		Category: "messenger",
+		Name:     "messenger:dlq:list",
+		Usage:    "List invoices moved to the dead-letter queue",
+		Action:   t.Execute,
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:    "limit",
+				Usage:   "Maximum number of invoices to list, `0` lists all of them",
+				Aliases: []string{"l"},
+				Value:   50,
+			},
+		},
+	}
+}
+
+// invoice extracts the user identifier and the file name from a message body, both are empty for a malformed body.
+func invoice(contentType string, body []byte) modelbus.MsgProcess {
+	msg := modelbus.MsgProcess{}
+	_, _ = codec.Decode(contentType, body, &msg)
+	return msg
+}
+
+// Execute runs the command-associated execution logic.
+func (t *DLQListCommand) Execute(ctx *cli.Context) error {
+	const (
+		handler    = "messenger:dlq:list"
+		handlerKey = "cli_command"
+	)
+
+	var (
+		limit = ctx.Int("limit")
+	)
+
+	defer func() {
+		t.syncUtils.SyncCancel()
+		t.syncUtils.Wg.Wait()
+	}()
+
+	t.log.Info().Str(handlerKey, handler).Msg(fmt.Sprintf("CLI: %s endpoint hit", handler))
+
+	letters, err := t.bus.ListDeadLetters(limit)
+	if err != nil {
+		t.log.Error().Err(err).Str(handlerKey, handler).Msg(errors.AMQPDeadLetterReadingError)
+		return err
+	}
+
+	printDeadLetters(letters)
+	return nil
+}
+
+// printDeadLetters prints dead-lettered invoices as a table.
+func printDeadLetters(letters []modelbus.DeadLetter) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Queue",
+		"User ID",
+		"File Name",
+		"Barcode",
+		"Attempts",
+		"Failed At",
+		"Error",
+	})
+	for _, letter := range letters {
+		msg := invoice(letter.ContentType, letter.Body)
+		table.Append([]string{
+			letter.Queue,
+			msg.UserID,
+			msg.FileName,
+			msg.Barcode,
+			strconv.Itoa(letter.Attempts),
+			letter.DeadAt,
+			letter.Error,
+		})
+	}
+	table.Render()
+}
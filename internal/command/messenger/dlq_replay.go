@@ -0,0 +1,108 @@
+// Package messenger provides CLI commands definitions and execution logic.
+
+package messenger
+
+import (
+	"fmt"
+	"upload-service-auto/internal/bus"
+	"upload-service-auto/internal/bus/errors"
+	"upload-service-auto/internal/bus/modelbus"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/syncutils"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+// DLQReplayCommand defines a new command struct and sets its attributes.
+type DLQReplayCommand struct {
+	log       *zerolog.Logger
+	cfg       *config.Config
+	bus       bus.Bus
+	syncUtils *syncutils.SyncUtils
+}
+
+// NewDLQReplayCommand creates a new command instance.
+func NewDLQReplayCommand(
+	logger *zerolog.Logger,
+	cfg *config.Config,
+	bus bus.Bus,
+	syncUtils *syncutils.SyncUtils,
+) *DLQReplayCommand {
+	logger.Debug().Msg("calling initializer of messenger:dlq:replay command")
+	return &DLQReplayCommand{
+		log:       logger,
+		cfg:       cfg,
+		bus:       bus,
+		syncUtils: syncUtils,
+	}
+}
+
+// Describe handles command description when invoked.
+func (t *DLQReplayCommand) Describe() *cli.Command {
+	return &cli.Command{
+		Category: "messenger",
+		Name:     "messenger:dlq:replay",
+		Usage:    "Put invoices from the dead-letter queue back to their queues",
+		Action:   t.Execute,
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:    "limit",
+				Usage:   "Maximum number of invoices to replay, `0` replays all of them",
+				Aliases: []string{"l"},
+			},
+			&cli.StringFlag{
+				Name:    "queue",
+				Usage:   "Replay only invoices of a queue",
+				Aliases: []string{"q"},
+			},
+			&cli.StringFlag{
+				Name:    "user-id",
+				Usage:   "Replay only invoices of a user (userID)",
+				Aliases: []string{"u"},
+			},
+			&cli.StringFlag{
+				Name:    "file-name",
+				Usage:   "Replay only invoices of a file (as stored in S3)",
+				Aliases: []string{"f"},
+			},
+		},
+	}
+}
+
+// Execute runs the command-associated execution logic.
+func (t *DLQReplayCommand) Execute(ctx *cli.Context) error {
+	const (
+		handler    = "messenger:dlq:replay"
+		handlerKey = "cli_command"
+	)
+
+	var (
+		limit    = ctx.Int("limit")
+		queue    = ctx.String("queue")
+		userID   = ctx.String("user-id")
+		fileName = ctx.String("file-name")
+	)
+
+	defer func() {
+		t.syncUtils.SyncCancel()
+		t.syncUtils.Wg.Wait()
+	}()
+
+	t.log.Info().Str(handlerKey, handler).Msg(fmt.Sprintf("CLI: %s endpoint hit", handler))
+
+	letters, err := t.bus.ReplayDeadLetters(limit, func(letter *modelbus.DeadLetter) bool {
+		msg := invoice(letter.ContentType, letter.Body)
+		return (queue == "" || letter.Queue == queue) &&
+			(userID == "" || msg.UserID == userID) &&
+			(fileName == "" || msg.FileName == fileName)
+	})
+	if err != nil {
+		t.log.Error().Err(err).Str(handlerKey, handler).Msg(errors.AMQPDeadLetterReplayError)
+		return err
+	}
+
+	printDeadLetters(letters)
+	t.log.Info().Str(handlerKey, handler).Int("replayed", len(letters)).Msg("dead-lettered invoices were replayed")
+	return nil
+}
@@ -0,0 +1,121 @@
+// Package s3 provides CLI commands definitions and execution logic.
+
+package s3
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+	"upload-service-auto/internal/command/errors"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/reconciler"
+	"upload-service-auto/internal/syncutils"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+// reconcileTimeout limits the duration of reconciling DB with S3.
+const reconcileTimeout = 10 * time.Minute
+
+// ReconcileCommand defines a new command struct and sets its attributes.
+type ReconcileCommand struct {
+	log        *zerolog.Logger
+	cfg        *config.Config
+	reconciler *reconciler.Reconciler
+	syncUtils  *syncutils.SyncUtils
+}
+
+// NewReconcileCommand creates a new command instance.
+func NewReconcileCommand(
+	logger *zerolog.Logger,
+	cfg *config.Config,
+	reconciler *reconciler.Reconciler,
+	syncUtils *syncutils.SyncUtils,
+) *ReconcileCommand {
+	logger.Debug().Msg("calling initializer of s3:reconcile command")
+	return &ReconcileCommand{
+		log:        logger,
+		cfg:        cfg,
+		reconciler: reconciler,
+		syncUtils:  syncUtils,
+	}
+}
+
+// Describe handles command description when invoked.
+func (t *ReconcileCommand) Describe() *cli.Command {
+	return &cli.Command{
+		Category: "s3",
+		Name:     "s3:reconcile",
+		Usage:    "Report missing, orphaned and size-mismatched processing results in S3",
+		Action:   t.Execute,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "fix",
+				Usage: "Reset processing of files with missing or size-mismatched results and remove orphaned objects",
+			},
+		},
+	}
+}
+
+// Execute runs the command-associated execution logic.
+func (t *ReconcileCommand) Execute(ctx *cli.Context) error {
+	const (
+		handler    = "s3:reconcile"
+		handlerKey = "cli_command"
+	)
+
+	var (
+		fix = ctx.Bool("fix")
+	)
+
+	t.log.Info().Str(handlerKey, handler).Msg(fmt.Sprintf("CLI: %s endpoint hit", handler))
+
+	ctxMain, cancel := context.WithTimeout(t.syncUtils.Ctx, reconcileTimeout)
+	defer func() {
+		cancel()
+		t.syncUtils.SyncCancel()
+		t.syncUtils.Wg.Wait()
+	}()
+
+	problems, err := t.reconciler.Reconcile(ctxMain, fix)
+	if err != nil {
+		t.log.Error().Err(err).Str(handlerKey, handler).Msg(errors.ReconcilingError)
+		return err
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Problem",
+		"User ID",
+		"File Name",
+		"Barcode",
+		"Key",
+		"Expected Size",
+		"Actual Size",
+		"Fixed",
+	})
+	for _, problem := range problems {
+		expectedSize, actualSize := "", ""
+		if problem.Kind == reconciler.ProblemSizeMismatch {
+			expectedSize = strconv.FormatInt(problem.ExpectedSize, 10)
+			actualSize = strconv.FormatInt(problem.ActualSize, 10)
+		}
+		table.Append([]string{
+			problem.Kind,
+			problem.UserID,
+			problem.FileName,
+			problem.Barcode,
+			problem.Key,
+			expectedSize,
+			actualSize,
+			strconv.FormatBool(problem.Fixed),
+		})
+	}
+	table.Render()
+
+	return nil
+}
@@ -4,7 +4,7 @@ package storage
 
 import (
 	"fmt"
-	"upload-service-auto/internal/storage/v1/psql"
+	"upload-service-auto/internal/storage"
 	"upload-service-auto/internal/syncutils"
 
 	"github.com/rs/zerolog"
@@ -14,14 +14,14 @@ import (
 // MigrateCommand defines a new command struct and sets its attributes.
 type MigrateCommand struct {
 	log       *zerolog.Logger
-	storage   *psql.Storage
+	storage   storage.Storage
 	syncUtils *syncutils.SyncUtils
 }
 
 // NewMigrateCommand creates a new command instance.
 func NewMigrateCommand(
 	logger *zerolog.Logger,
-	storage *psql.Storage,
+	storage storage.Storage,
 	syncUtils *syncutils.SyncUtils,
 ) *MigrateCommand {
 	logger.Debug().Msg("calling initializer of storage:migrate command")
@@ -39,6 +39,13 @@ func (t *MigrateCommand) Describe() *cli.Command {
 		Name:     "storage:migrate",
 		Usage:    "Run DB migration",
 		Action:   t.Execute,
+		Flags: []cli.Flag{
+			&cli.Int64Flag{
+				Name:  "to",
+				Usage: "Target schema version, all pending migrations are applied if omitted",
+				Value: 0,
+			},
+		},
 	}
 }
 
@@ -54,13 +61,23 @@ func (t *MigrateCommand) Execute(ctx *cli.Context) error {
 		t.syncUtils.Wg.Wait()
 	}()
 
+	var (
+		to = ctx.Int64("to")
+	)
+
 	t.log.Info().Str(handlerKey, handler).Msg(fmt.Sprintf("CLI: %s endpoint hit", handler))
 
-	err := t.storage.Migrate()
+	err := t.storage.Migrate(to)
 	if err != nil {
 		t.log.Fatal().Err(err).Msg("could not perform migration")
 	}
 
+	version, err := t.storage.SchemaVersion()
+	if err != nil {
+		t.log.Fatal().Err(err).Msg("could not get schema version")
+	}
+	t.log.Info().Str(handlerKey, handler).Int64("version", version).Msg("migration is complete")
+
 	t.syncUtils.SyncCancel()
 	t.syncUtils.Wg.Wait()
 
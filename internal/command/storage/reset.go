@@ -4,7 +4,7 @@ package storage
 
 import (
 	"fmt"
-	"upload-service-auto/internal/storage/v1/psql"
+	"upload-service-auto/internal/storage"
 	"upload-service-auto/internal/syncutils"
 
 	"github.com/rs/zerolog"
@@ -14,14 +14,14 @@ import (
 // ResetCommand defines a new command struct and sets its attributes.
 type ResetCommand struct {
 	log       *zerolog.Logger
-	storage   *psql.Storage
+	storage   storage.Storage
 	syncUtils *syncutils.SyncUtils
 }
 
 // NewResetCommand creates a new command instance.
 func NewResetCommand(
 	logger *zerolog.Logger,
-	storage *psql.Storage,
+	storage storage.Storage,
 	syncUtils *syncutils.SyncUtils,
 ) *ResetCommand {
 	logger.Debug().Msg("calling initializer of storage:reset command")
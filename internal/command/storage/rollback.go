@@ -0,0 +1,82 @@
+// Package storage provides CLI commands definitions and execution logic.
+
+package storage
+
+import (
+	"fmt"
+	"upload-service-auto/internal/storage"
+	"upload-service-auto/internal/syncutils"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+// RollbackCommand defines a new command struct and sets its attributes.
+type RollbackCommand struct {
+	log       *zerolog.Logger
+	storage   storage.Storage
+	syncUtils *syncutils.SyncUtils
+}
+
+// NewRollbackCommand creates a new command instance.
+func NewRollbackCommand(
+	logger *zerolog.Logger,
+	storage storage.Storage,
+	syncUtils *syncutils.SyncUtils,
+) *RollbackCommand {
+	logger.Debug().Msg("calling initializer of storage:rollback command")
+	return &RollbackCommand{
+		log:       logger,
+		storage:   storage,
+		syncUtils: syncUtils,
+	}
+}
+
+// Describe handles command description when invoked.
+func (t *RollbackCommand) Describe() *cli.Command {
+	return &cli.Command{
+		Category: "storage",
+		Name:     "storage:rollback",
+		Usage:    "Revert DB migrations",
+		Action:   t.Execute,
+		Flags: []cli.Flag{
+			&cli.Int64Flag{
+				Name:  "to",
+				Usage: "Target schema version to keep, only the latest migration is reverted if omitted",
+				Value: -1,
+			},
+		},
+	}
+}
+
+// Execute runs the command-associated execution logic.
+func (t *RollbackCommand) Execute(ctx *cli.Context) error {
+	const (
+		handler    = "storage:rollback"
+		handlerKey = "cli_command"
+	)
+
+	var (
+		to = ctx.Int64("to")
+	)
+
+	defer func() {
+		t.syncUtils.SyncCancel()
+		t.syncUtils.Wg.Wait()
+	}()
+
+	t.log.Info().Str(handlerKey, handler).Msg(fmt.Sprintf("CLI: %s endpoint hit", handler))
+
+	err := t.storage.Rollback(to)
+	if err != nil {
+		t.log.Fatal().Err(err).Msg("could not perform rollback")
+	}
+
+	version, err := t.storage.SchemaVersion()
+	if err != nil {
+		t.log.Fatal().Err(err).Msg("could not get schema version")
+	}
+	t.log.Info().Str(handlerKey, handler).Int64("version", version).Msg("rollback is complete")
+
+	return nil
+}
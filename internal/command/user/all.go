@@ -10,7 +10,7 @@ import (
 	"time"
 	"upload-service-auto/internal/command/errors"
 	"upload-service-auto/internal/config"
-	"upload-service-auto/internal/storage/v1/psql"
+	"upload-service-auto/internal/storage"
 	"upload-service-auto/internal/syncutils"
 
 	"github.com/olekukonko/tablewriter"
@@ -22,7 +22,7 @@ import (
 type AllCommand struct {
 	log       *zerolog.Logger
 	cfg       *config.Config
-	storage   *psql.Storage
+	storage   storage.Storage
 	syncUtils *syncutils.SyncUtils
 }
 
@@ -30,7 +30,7 @@ type AllCommand struct {
 func NewAllCommand(
 	logger *zerolog.Logger,
 	cfg *config.Config,
-	storage *psql.Storage,
+	storage storage.Storage,
 	syncUtils *syncutils.SyncUtils,
 ) *AllCommand {
 	logger.Debug().Msg("calling initializer of user:all command")
@@ -5,21 +5,25 @@ package user
 import (
 	"context"
 	"fmt"
+	"os"
 	"time"
-	"upload-service-auto/internal/command/errors"
+	"upload-service-auto/internal/agent/agent"
 	"upload-service-auto/internal/config"
-	"upload-service-auto/internal/storage/v1/psql"
 	"upload-service-auto/internal/syncutils"
 
+	"github.com/olekukonko/tablewriter"
 	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
 )
 
+// deleteTimeout limits the duration of removing user data including S3 objects.
+const deleteTimeout = 5 * time.Minute
+
 // DeleteCommand defines a new command struct and sets its attributes.
 type DeleteCommand struct {
 	log       *zerolog.Logger
 	cfg       *config.Config
-	storage   *psql.Storage
+	agent     *agent.Agent
 	syncUtils *syncutils.SyncUtils
 }
 
@@ -27,14 +31,14 @@ type DeleteCommand struct {
 func NewDeleteCommand(
 	logger *zerolog.Logger,
 	cfg *config.Config,
-	storage *psql.Storage,
+	agent *agent.Agent,
 	syncUtils *syncutils.SyncUtils,
 ) *DeleteCommand {
 	logger.Debug().Msg("calling initializer of user:delete command")
 	return &DeleteCommand{
 		log:       logger,
 		cfg:       cfg,
-		storage:   storage,
+		agent:     agent,
 		syncUtils: syncUtils,
 	}
 }
@@ -44,7 +48,7 @@ func (t *DeleteCommand) Describe() *cli.Command {
 	return &cli.Command{
 		Category: "user",
 		Name:     "user:delete",
-		Usage:    "Delete all user-related data",
+		Usage:    "Delete all user-related data including upload history, source files and results in S3",
 		Action:   t.Execute,
 		Flags: []cli.Flag{
 			&cli.StringFlag{
@@ -53,6 +57,10 @@ func (t *DeleteCommand) Describe() *cli.Command {
 				Aliases:  []string{"u"},
 				Required: true,
 			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "List S3 objects to be removed without removing anything",
+			},
 		},
 	}
 }
@@ -67,34 +75,40 @@ func (t *DeleteCommand) Execute(ctx *cli.Context) error {
 
 	var (
 		userID = ctx.String("user-id")
+		dryRun = ctx.Bool("dry-run")
 	)
 
 	t.log.Info().Str(handlerKey, handler).Str(userIDKey, userID).Msg(fmt.Sprintf("CLI: %s endpoint hit", handler))
 
-	ctxMain, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	ctxMain, cancel := context.WithTimeout(context.Background(), deleteTimeout)
 	defer func() {
 		cancel()
 		t.syncUtils.SyncCancel()
 		t.syncUtils.Wg.Wait()
 	}()
 
-	err := t.storage.CheckUserID(ctxMain, userID)
+	objects, err := t.agent.DeleteUser(ctxMain, userID, handler, dryRun)
 	if err != nil {
-		t.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.UserNotFoundError)
-		return err
+		t.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg("data deletion failed")
 	}
 
-	fileName, err := t.storage.GetFileNameForUser(ctxMain, userID)
-	if err != nil {
-		t.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.FileNotFoundError)
-		return err
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Kind",
+		"Bucket",
+		"Key",
+	})
+	for _, object := range objects {
+		table.Append([]string{
+			object.Kind,
+			object.Bucket,
+			object.Key,
+		})
 	}
-
-	err = t.storage.RemoveUserData(ctxMain, userID, fileName)
-	if err != nil {
-		t.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg("data deletion failed")
-		return err
+	if dryRun {
+		table.SetCaption(true, "dry run, nothing is removed")
 	}
+	table.Render()
 
-	return nil
+	return err
 }
@@ -0,0 +1,118 @@
+// Package user provides CLI commands definitions and execution logic.
+
+package user
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+	"upload-service-auto/internal/command/errors"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/storage"
+	"upload-service-auto/internal/syncutils"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+// HistoryCommand defines a new command struct and sets its attributes.
+type HistoryCommand struct {
+	log       *zerolog.Logger
+	cfg       *config.Config
+	storage   storage.Storage
+	syncUtils *syncutils.SyncUtils
+}
+
+// NewHistoryCommand creates a new command instance.
+func NewHistoryCommand(
+	logger *zerolog.Logger,
+	cfg *config.Config,
+	storage storage.Storage,
+	syncUtils *syncutils.SyncUtils,
+) *HistoryCommand {
+	logger.Debug().Msg("calling initializer of user:history command")
+	return &HistoryCommand{
+		log:       logger,
+		cfg:       cfg,
+		storage:   storage,
+		syncUtils: syncUtils,
+	}
+}
+
+// Describe handles command description when invoked.
+func (t *HistoryCommand) Describe() *cli.Command {
+	return &cli.Command{
+		Category: "user",
+		Name:     "user:history",
+		Usage:    "Get upload history for one user",
+		Action:   t.Execute,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "user-id",
+				Usage:    "User identifier (userID)",
+				Aliases:  []string{"u"},
+				Required: true,
+			},
+		},
+	}
+}
+
+// Execute runs the command-associated execution logic.
+func (t *HistoryCommand) Execute(ctx *cli.Context) error {
+	const (
+		handler    = "user:history"
+		handlerKey = "cli_command"
+		userIDKey  = "userID"
+	)
+
+	var (
+		userID = ctx.String("user-id")
+	)
+
+	t.log.Info().Str(handlerKey, handler).Str(userIDKey, userID).Msg(fmt.Sprintf("CLI: %s endpoint hit", handler))
+
+	ctxMain, cancel := context.WithTimeout(t.syncUtils.Ctx, 500*time.Millisecond)
+	defer func() {
+		cancel()
+		t.syncUtils.SyncCancel()
+		t.syncUtils.Wg.Wait()
+	}()
+
+	err := t.storage.CheckUserID(ctxMain, userID)
+	if err != nil {
+		t.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.UserNotFoundError)
+		return err
+	}
+
+	uploads, err := t.storage.GetUserUploads(ctxMain, userID)
+	if err != nil {
+		t.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.GettingUploadsError)
+		return err
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"File Name",
+		"Uploaded At",
+		"Current",
+		"Validation Status",
+		"Barcode",
+		"Processing Status",
+	})
+	for _, upload := range uploads {
+		table.Append([]string{
+			upload.FileName,
+			upload.CreatedAt.Format(time.RFC3339),
+			strconv.FormatBool(upload.IsCurrent),
+			upload.ValidationStatus,
+			upload.Barcode,
+			upload.ProcessingStatus,
+		})
+	}
+	table.Render()
+
+	return nil
+}
@@ -10,7 +10,9 @@ import (
 	"time"
 	"upload-service-auto/internal/command/errors"
 	"upload-service-auto/internal/config"
-	"upload-service-auto/internal/storage/v1/psql"
+	"upload-service-auto/internal/constants"
+	"upload-service-auto/internal/storage"
+	"upload-service-auto/internal/storage/v1/models"
 	"upload-service-auto/internal/syncutils"
 
 	"github.com/olekukonko/tablewriter"
@@ -22,7 +24,7 @@ import (
 type InfoCommand struct {
 	log       *zerolog.Logger
 	cfg       *config.Config
-	storage   *psql.Storage
+	storage   storage.Storage
 	syncUtils *syncutils.SyncUtils
 }
 
@@ -30,7 +32,7 @@ type InfoCommand struct {
 func NewInfoCommand(
 	logger *zerolog.Logger,
 	cfg *config.Config,
-	storage *psql.Storage,
+	storage storage.Storage,
 	syncUtils *syncutils.SyncUtils,
 ) *InfoCommand {
 	logger.Debug().Msg("calling initializer of user:info command")
@@ -100,6 +102,12 @@ func (t *InfoCommand) Execute(ctx *cli.Context) error {
 		valid = true
 	}
 
+	validation, err := t.storage.GetValidationResult(ctxMain, fileName)
+	if err != nil {
+		t.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.GettingValidationResultError)
+		validation = &models.Validation{FileName: fileName, Status: constants.NA}
+	}
+
 	productCode, err := t.storage.GetProductCode(ctxMain, userID)
 	if err != nil {
 		t.log.Error().Err(err).Str(handlerKey, handler).Str(userIDKey, userID).Msg(errors.GettingProductCodeError)
@@ -115,6 +123,10 @@ func (t *InfoCommand) Execute(ctx *cli.Context) error {
 		"User ID",
 		"File Name",
 		"Valid",
+		"Validation Status",
+		"Mode",
+		"Sex",
+		"Validation Error",
 		"Product Code",
 		"Processing Status",
 	})
@@ -122,6 +134,10 @@ func (t *InfoCommand) Execute(ctx *cli.Context) error {
 		userID,
 		fileName,
 		strconv.FormatBool(valid),
+		validation.Status,
+		validation.Mode,
+		validation.Sex,
+		validation.Err,
 		productCode,
 		status,
 	})
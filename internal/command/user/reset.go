@@ -10,7 +10,7 @@ import (
 	"upload-service-auto/internal/config"
 	"upload-service-auto/internal/constants"
 	errors2 "upload-service-auto/internal/processor/errors"
-	"upload-service-auto/internal/storage/v1/psql"
+	"upload-service-auto/internal/storage"
 	"upload-service-auto/internal/syncutils"
 
 	"github.com/rs/zerolog"
@@ -21,7 +21,7 @@ import (
 type ResetCommand struct {
 	log       *zerolog.Logger
 	cfg       *config.Config
-	storage   *psql.Storage
+	storage   storage.Storage
 	syncUtils *syncutils.SyncUtils
 }
 
@@ -29,7 +29,7 @@ type ResetCommand struct {
 func NewResetCommand(
 	logger *zerolog.Logger,
 	cfg *config.Config,
-	storage *psql.Storage,
+	storage storage.Storage,
 	syncUtils *syncutils.SyncUtils,
 ) *ResetCommand {
 	logger.Debug().Msg("calling initializer of user:reset command")
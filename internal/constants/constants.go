@@ -3,16 +3,30 @@
 package constants
 
 const (
-	ValidationStatusNew     = "new"
-	ValidationStatusRunning = "running"
-	ValidationStatusValid   = "valid"
-	ValidationStatusInvalid = "invalid"
-	ValidationStatusError   = "error"
+	ValidationStatusNew       = "new"
+	ValidationStatusRunning   = "running"
+	ValidationStatusValid     = "valid"
+	ValidationStatusInvalid   = "invalid"
+	ValidationStatusError     = "error"
+	ValidationStatusCancelled = "cancelled"
+	ValidationStatusTimeout   = "timeout"
 
-	ProcessingStatusNew     = "new"
-	ProcessingStatusRunning = "running"
-	ProcessingStatusDone    = "done"
-	ProcessingStatusError   = "error"
+	ProcessingStatusNew       = "new"
+	ProcessingStatusRunning   = "running"
+	ProcessingStatusDone      = "done"
+	ProcessingStatusError     = "error"
+	ProcessingStatusCancelled = "cancelled"
+	ProcessingStatusTimeout   = "timeout"
+
+	JobValidation = "validation"
+	JobProcessing = "processing"
+
+	ObjectKindSource   = "source"
+	ObjectKindArtifact = "artifact"
+
+	DeletionReasonUserDeleted = "user_deleted"
+	DeletionReasonReprocessed = "reprocessed"
+	DeletionReasonOrphaned    = "orphaned"
 
 	NA = "NA"
 )
@@ -22,10 +36,18 @@ var ValidValidationStatuses = []string{
 	ValidationStatusRunning,
 	ValidationStatusValid,
 	ValidationStatusInvalid,
-	ValidationStatusError}
+	ValidationStatusError,
+	ValidationStatusCancelled,
+	ValidationStatusTimeout}
 
 var ValidProcessingStatuses = []string{
 	ProcessingStatusNew,
 	ProcessingStatusRunning,
 	ProcessingStatusDone,
-	ProcessingStatusError}
+	ProcessingStatusError,
+	ProcessingStatusCancelled,
+	ProcessingStatusTimeout}
+
+var ValidJobs = []string{
+	JobValidation,
+	JobProcessing}
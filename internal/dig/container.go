@@ -6,22 +6,31 @@ import (
 	"fmt"
 	"upload-service-auto/internal/agent/agent"
 	"upload-service-auto/internal/api/v1/rest/handlers"
-	"upload-service-auto/internal/bus/amqp"
+	"upload-service-auto/internal/bus"
 	amqpHandlers "upload-service-auto/internal/bus/handlers"
 	cli2 "upload-service-auto/internal/cli"
 	"upload-service-auto/internal/command"
 	commandFile "upload-service-auto/internal/command/file"
 	commandHTTP "upload-service-auto/internal/command/http"
+	commandJobs "upload-service-auto/internal/command/jobs"
 	commandMessenger "upload-service-auto/internal/command/messenger"
+	commandS3 "upload-service-auto/internal/command/s3"
 	commandStorage "upload-service-auto/internal/command/storage"
 	commandUser "upload-service-auto/internal/command/user"
 	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/limiter"
 	"upload-service-auto/internal/logger"
+	"upload-service-auto/internal/outbox"
 	"upload-service-auto/internal/processor/v1/processor"
 	"upload-service-auto/internal/productmanager"
+	"upload-service-auto/internal/reaper"
+	"upload-service-auto/internal/reconciler"
+	"upload-service-auto/internal/runner"
+	"upload-service-auto/internal/s3/artifacts"
 	"upload-service-auto/internal/s3/s3"
-	"upload-service-auto/internal/storage/v1/psql"
+	"upload-service-auto/internal/storage"
 	"upload-service-auto/internal/syncutils"
+	"upload-service-auto/internal/workspace"
 
 	"go.uber.org/dig"
 )
@@ -33,23 +42,36 @@ var definitions = []interface{}{
 	commandHTTP.NewServeCommand,
 	commandStorage.NewMigrateCommand,
 	commandStorage.NewResetCommand,
+	commandStorage.NewRollbackCommand,
 	commandUser.NewResetCommand,
 	commandUser.NewDeleteCommand,
 	commandUser.NewInfoCommand,
 	commandUser.NewAllCommand,
+	commandUser.NewHistoryCommand,
 	commandMessenger.NewConsumeCommand,
 	commandMessenger.NewCreateCommand,
+	commandMessenger.NewDLQListCommand,
+	commandMessenger.NewDLQReplayCommand,
+	commandJobs.NewReapCommand,
+	commandS3.NewReconcileCommand,
 	config.NewConfig,
 	logger.NewLog,
 	processor.NewProcessor,
+	runner.NewRunner,
+	workspace.NewManager,
+	limiter.NewLimiter,
 	productmanager.NewProductManager,
 	s3.NewService,
-	psql.NewStorage,
+	artifacts.NewManifest,
+	storage.NewStorage,
 	cli2.NewApp,
 	syncutils.NewSyncUtils,
-	amqp.NewAMQP,
+	bus.NewBus,
 	amqpHandlers.NewAMQPHandler,
 	agent.NewAgent,
+	reaper.NewReaper,
+	reconciler.NewReconciler,
+	outbox.NewRelay,
 }
 
 func buildContainer() (*dig.Container, error) {
@@ -75,12 +97,18 @@ func commands(container *dig.Container) error {
 		fileProcessCommand *commandFile.ProcessCommand,
 		migrateCommand *commandStorage.MigrateCommand,
 		storageResetCommand *commandStorage.ResetCommand,
+		storageRollbackCommand *commandStorage.RollbackCommand,
 		userResetCommand *commandUser.ResetCommand,
 		userDeleteCommand *commandUser.DeleteCommand,
 		userInfoCommand *commandUser.InfoCommand,
 		userAllCommand *commandUser.AllCommand,
+		userHistoryCommand *commandUser.HistoryCommand,
 		consumeCommand *commandMessenger.ConsumeCommand,
 		createCommand *commandMessenger.CreateCommand,
+		dlqListCommand *commandMessenger.DLQListCommand,
+		dlqReplayCommand *commandMessenger.DLQReplayCommand,
+		jobsReapCommand *commandJobs.ReapCommand,
+		s3ReconcileCommand *commandS3.ReconcileCommand,
 
 	) []command.Command {
 		return []command.Command{
@@ -89,12 +117,18 @@ func commands(container *dig.Container) error {
 			fileProcessCommand,
 			migrateCommand,
 			storageResetCommand,
+			storageRollbackCommand,
 			userResetCommand,
 			userDeleteCommand,
 			userInfoCommand,
 			userAllCommand,
+			userHistoryCommand,
 			consumeCommand,
 			createCommand,
+			dlqListCommand,
+			dlqReplayCommand,
+			jobsReapCommand,
+			s3ReconcileCommand,
 		}
 	}); err != nil {
 		return fmt.Errorf("failed to define application: %w", err)
@@ -0,0 +1,8 @@
+// Package errors provides string codes for error instantiation.
+
+package errors
+
+const (
+	ResourcesAcquiringError = "could not acquire resources for a job"
+	InvalidJobKindError     = "no resources are configured for a job kind"
+)
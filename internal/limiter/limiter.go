@@ -0,0 +1,102 @@
+// Package limiter provides a limit of CPU and memory reserved by concurrently running pipeline jobs.
+
+package limiter
+
+import (
+	"context"
+	"runtime"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/constants"
+	"upload-service-auto/internal/limiter/errors"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/semaphore"
+)
+
+// Resources defines CPU and memory reserved by one job.
+type Resources struct {
+	CPUs     int
+	MemoryMB int
+}
+
+// Limiter defines an object and sets its attributes.
+type Limiter struct {
+	log         *zerolog.Logger
+	cfg         *config.Config
+	totalCPUs   int
+	totalMemory int
+	cpus        *semaphore.Weighted
+	memory      *semaphore.Weighted
+}
+
+// NewLimiter initializes a new Limiter instance, the number of CPUs of the host is used if the total is not set.
+func NewLimiter(cfg *config.Config, logger *zerolog.Logger) *Limiter {
+	logger.Debug().Msg("calling initializer of resource limiter")
+	totalCPUs := cfg.Jobs.TotalCPUs
+	if totalCPUs <= 0 {
+		totalCPUs = runtime.NumCPU()
+	}
+	totalMemory := cfg.Jobs.TotalMemoryMB
+	if totalMemory <= 0 {
+		totalMemory = 1
+	}
+	logger.Info().Int("cpus", totalCPUs).Int("memory_mb", totalMemory).Msg("job resources are limited")
+	return &Limiter{
+		log:         logger,
+		cfg:         cfg,
+		totalCPUs:   totalCPUs,
+		totalMemory: totalMemory,
+		cpus:        semaphore.NewWeighted(int64(totalCPUs)),
+		memory:      semaphore.NewWeighted(int64(totalMemory)),
+	}
+}
+
+// Resources returns resources configured for a job kind.
+func (l *Limiter) Resources(kind string) Resources {
+	switch kind {
+	case constants.JobValidation:
+		return Resources{CPUs: l.cfg.Jobs.ValidationCPUs, MemoryMB: l.cfg.Jobs.ValidationMemory}
+	case constants.JobProcessing:
+		return Resources{CPUs: l.cfg.Jobs.ProcessingCPUs, MemoryMB: l.cfg.Jobs.ProcessingMemory}
+	default:
+		l.log.Warn().Str("kind", kind).Msg(errors.InvalidJobKindError)
+		return Resources{CPUs: 1}
+	}
+}
+
+// clamp keeps a request within the totals so that a job larger than the host still runs, alone.
+func (l *Limiter) clamp(res Resources) Resources {
+	if res.CPUs < 1 {
+		res.CPUs = 1
+	}
+	if res.CPUs > l.totalCPUs {
+		res.CPUs = l.totalCPUs
+	}
+	if res.MemoryMB < 0 {
+		res.MemoryMB = 0
+	}
+	if res.MemoryMB > l.totalMemory {
+		res.MemoryMB = l.totalMemory
+	}
+	return res
+}
+
+// Acquire blocks until the resources are available or the context is done, the returned function releases them.
+func (l *Limiter) Acquire(ctx context.Context, res Resources) (func(), error) {
+	l.log.Debug().Msg("calling `Acquire` method")
+	res = l.clamp(res)
+	if err := l.cpus.Acquire(ctx, int64(res.CPUs)); err != nil {
+		l.log.Error().Err(err).Msg(errors.ResourcesAcquiringError)
+		return nil, err
+	}
+	if err := l.memory.Acquire(ctx, int64(res.MemoryMB)); err != nil {
+		l.cpus.Release(int64(res.CPUs))
+		l.log.Error().Err(err).Msg(errors.ResourcesAcquiringError)
+		return nil, err
+	}
+	l.log.Info().Int("cpus", res.CPUs).Int("memory_mb", res.MemoryMB).Msg("job resources acquired")
+	return func() {
+		l.memory.Release(int64(res.MemoryMB))
+		l.cpus.Release(int64(res.CPUs))
+	}, nil
+}
@@ -0,0 +1,8 @@
+// Package errors provides string codes for error instantiation.
+
+package errors
+
+const (
+	MetricsServerError   = "metrics server failed"
+	MetricsShutdownError = "metrics server shutdown failed"
+)
@@ -0,0 +1,58 @@
+// Package metrics provides counters of the service exposed in expvar format.
+
+package metrics
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"time"
+	"upload-service-auto/internal/metrics/errors"
+
+	"github.com/rs/zerolog"
+)
+
+// Path is the path metrics are served at.
+const Path = "/debug/vars"
+
+var (
+	// AMQPConnected is 1 while the AMQP connection is open and 0 while it is being recovered.
+	AMQPConnected = expvar.NewInt("amqp_connected")
+	// AMQPReconnectAttempts counts attempts to recover a lost AMQP connection.
+	AMQPReconnectAttempts = expvar.NewInt("amqp_reconnect_attempts")
+	// AMQPReconnects counts successfully recovered AMQP connections.
+	AMQPReconnects = expvar.NewInt("amqp_reconnects")
+	// AMQPConsumerRestarts counts queue consumers resumed after losing their channel.
+	AMQPConsumerRestarts = expvar.NewInt("amqp_consumer_restarts")
+)
+
+// Handler returns a handler serving all metrics.
+func Handler() http.Handler {
+	return expvar.Handler()
+}
+
+// Serve serves metrics at the address until the context is done.
+func Serve(ctx context.Context, addr string, logger *zerolog.Logger) {
+	logger.Debug().Msg("calling `Serve` method")
+	mux := http.NewServeMux()
+	mux.Handle(Path, Handler())
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		ctxTO, cancelTO := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelTO()
+		if err := srv.Shutdown(ctxTO); err != nil {
+			logger.Error().Err(err).Msg(errors.MetricsShutdownError)
+		}
+	}()
+
+	logger.Info().Str("address", addr).Msg("metrics server started")
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Error().Err(err).Msg(errors.MetricsServerError)
+	}
+}
@@ -0,0 +1,10 @@
+// Package errors provides string codes for error instantiation.
+
+package errors
+
+const (
+	GettingOutboxMessagesError = "could not find outbox messages in DB"
+	PublishingOutboxError      = "could not publish an outbox message"
+	DeletingOutboxMessageError = "could not delete a published outbox message"
+	RecordingOutboxError       = "could not record a failed outbox message"
+)
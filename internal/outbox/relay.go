@@ -0,0 +1,117 @@
+// Package outbox provides a relay publishing messages saved to the outbox along with the changes they report.
+
+package outbox
+
+import (
+	"context"
+	"time"
+	"upload-service-auto/internal/bus"
+	"upload-service-auto/internal/bus/modelbus"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/outbox/errors"
+	"upload-service-auto/internal/storage"
+
+	"github.com/rs/zerolog"
+)
+
+// relayTimeout limits the duration of relaying one batch of messages.
+const relayTimeout = 60 * time.Second
+
+// Relay defines an object and sets its attributes.
+type Relay struct {
+	log     *zerolog.Logger
+	cfg     *config.Config
+	storage storage.Storage
+	bus     bus.Bus
+}
+
+// NewRelay initializes a new Relay instance.
+func NewRelay(logger *zerolog.Logger, cfg *config.Config, storage storage.Storage, bus bus.Bus) *Relay {
+	logger.Debug().Msg("calling initializer of outbox relay")
+	return &Relay{
+		log:     logger,
+		cfg:     cfg,
+		storage: storage,
+		bus:     bus,
+	}
+}
+
+// Run relays the outbox periodically until the context is done, every run relays batches until the outbox is empty
+// or publishing fails.
+func (r *Relay) Run(ctx context.Context) {
+	r.log.Debug().Msg("calling `Run` method")
+	if r.cfg.Outbox.RelayInterval <= 0 {
+		r.log.Info().Msg("outbox relay is disabled")
+		return
+	}
+	ticker := time.NewTicker(r.cfg.Outbox.RelayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for ctx.Err() == nil {
+				ctxRelay, cancel := context.WithTimeout(ctx, relayTimeout)
+				relayed, err := r.Relay(ctxRelay)
+				cancel()
+				if err != nil {
+					r.log.Error().Err(err).Msg("relaying outbox failed")
+				}
+				if err != nil || relayed < r.cfg.Outbox.BatchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// Relay publishes one batch of messages from the outbox and returns the number of published messages. A message is
+// removed from the outbox once the broker confirms it, so it is published at least once. Publishing stops at the
+// first failure keeping the order of messages.
+func (r *Relay) Relay(ctx context.Context) (int, error) {
+	r.log.Debug().Msg("calling `Relay` method")
+	var (
+		relayed    int
+		publishErr error
+	)
+	err := r.storage.WithinTx(ctx, func(ctx context.Context) error {
+		messages, err := r.storage.GetOutboxMessages(ctx, r.cfg.Outbox.BatchSize)
+		if err != nil {
+			r.log.Error().Err(err).Msg(errors.GettingOutboxMessagesError)
+			return err
+		}
+		for _, msg := range messages {
+			headers := map[string]interface{}{}
+			for key, value := range msg.Headers {
+				headers[key] = value
+			}
+			publishErr = r.bus.Publish(msg.Exchange, modelbus.Message{
+				ContentType: msg.ContentType,
+				Headers:     headers,
+				Body:        msg.Payload,
+			})
+			if publishErr != nil {
+				// the failure is recorded and the transaction is committed to keep the published messages removed
+				r.log.Error().Err(publishErr).Int64("id", msg.ID).Msg(errors.PublishingOutboxError)
+				if err = r.storage.RecordOutboxFailure(ctx, msg.ID, publishErr.Error()); err != nil {
+					r.log.Error().Err(err).Int64("id", msg.ID).Msg(errors.RecordingOutboxError)
+				}
+				return nil
+			}
+			if err = r.storage.DeleteOutboxMessage(ctx, msg.ID); err != nil {
+				r.log.Error().Err(err).Int64("id", msg.ID).Msg(errors.DeletingOutboxMessageError)
+				return err
+			}
+			relayed++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if relayed > 0 {
+		r.log.Info().Int("count", relayed).Msg("outbox messages relayed")
+	}
+	return relayed, publishErr
+}
@@ -4,10 +4,12 @@ package errors
 
 const (
 	ValidationStatusUpdateError  = "could not update validation status"
-	ValidationSubprocessError    = "could not run validation shell command"
+	ValidationSubprocessError    = "could not run validation container"
 	ValidationDataUnmarshalError = "could not unmarshall validation data"
 	ProcessingStatusUpdateError  = "could not update processing status"
-	ProcessingSubprocessError    = "could not run processing shell command"
+	ProcessingSubprocessError    = "could not run processing container"
 	UploadRoutineError           = "could not execute S3 upload in a goroutine"
 	DownloadS3Error              = "could not download file from S3"
+	ProductCodeError             = "could not get product code"
+	ArtifactResolvingError       = "could not resolve artifacts to upload"
 )
@@ -6,74 +6,126 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
 	"io"
 	"os"
-	"os/exec"
+	"time"
 	"upload-service-auto/internal/config"
 	"upload-service-auto/internal/constants"
+	"upload-service-auto/internal/limiter"
 	"upload-service-auto/internal/processor/errors"
 	"upload-service-auto/internal/processor/v1/models"
+	"upload-service-auto/internal/runner"
+	"upload-service-auto/internal/s3/artifacts"
 	"upload-service-auto/internal/s3/s3"
-	"upload-service-auto/internal/storage/v1/psql"
+	s3Models "upload-service-auto/internal/s3/v1/models"
+	"upload-service-auto/internal/storage"
 	"upload-service-auto/internal/syncutils"
+	"upload-service-auto/internal/workspace"
 
 	"github.com/rs/zerolog"
 	"golang.org/x/sync/errgroup"
 )
 
+// statusTimeout limits the duration of saving the final status of a cancelled job.
+const statusTimeout = 5 * time.Second
+
 // Processor defines an object and sets its attributes.
 type Processor struct {
-	st        *psql.Storage
+	st        storage.Storage
 	cfg       *config.Config
 	log       *zerolog.Logger
 	s3        *s3.Service
+	manifest  *artifacts.Manifest
 	syncUtils *syncutils.SyncUtils
+	runner    runner.Runner
+	workspace *workspace.Manager
+	limiter   *limiter.Limiter
 }
 
 // NewProcessor initializes a new Processor instance.
-func NewProcessor(storage *psql.Storage, config *config.Config, logger *zerolog.Logger, s3 *s3.Service, syncUtils *syncutils.SyncUtils) *Processor {
+func NewProcessor(storage storage.Storage, config *config.Config, logger *zerolog.Logger, s3 *s3.Service, manifest *artifacts.Manifest, syncUtils *syncutils.SyncUtils, runner runner.Runner, workspace *workspace.Manager, limiter *limiter.Limiter) *Processor {
 	logger.Debug().Msg("calling initializer of processor service")
 	return &Processor{
 		st:        storage,
 		cfg:       config,
 		log:       logger,
 		s3:        s3,
+		manifest:  manifest,
 		syncUtils: syncUtils,
+		runner:    runner,
+		workspace: workspace,
+		limiter:   limiter,
 	}
 }
 
-// prepareCommand prepares shell comand for execution.
-func (p *Processor) prepareCommand(executable string, cliArgs []string, catcher io.Writer) *exec.Cmd {
-	p.log.Debug().Msg("calling `prepareCommand` method")
-	cmdGo := &exec.Cmd{
-		Path:   executable,
-		Args:   cliArgs,
-		Stdout: catcher,
-		Stderr: os.Stderr,
+// spec prepares a run of the pipeline image in a job workspace.
+func (p *Processor) spec(ws *workspace.Workspace, res limiter.Resources, args []string, stdout io.Writer) *runner.Spec {
+	p.log.Debug().Msg("calling `spec` method")
+	return &runner.Spec{
+		Name:     ws.ID,
+		Image:    p.cfg.Docker.DockerImageName,
+		Mounts:   p.workspace.Mounts(ws),
+		Args:     args,
+		Stdout:   stdout,
+		Stderr:   os.Stderr,
+		CPUs:     res.CPUs,
+		MemoryMB: res.MemoryMB,
 	}
-	return cmdGo
 }
 
-// RunValidation runs validation command and interacts with DB.
-func (p *Processor) RunValidation(ctx context.Context, fileName string, dryRun, fromQueue bool) (*models.ValidationData, error) {
-	p.log.Debug().Msg("calling `RunValidation` method")
+// run runs the pipeline image once resources of the job kind are available, waiting for them counts towards the job
+// timeout.
+func (p *Processor) run(ctx context.Context, kind string, ws *workspace.Workspace, args []string, stdout io.Writer) error {
+	p.log.Debug().Msg("calling `run` method")
+	res := p.limiter.Resources(kind)
+	release, err := p.limiter.Acquire(ctx, res)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return p.runner.Run(ctx, p.spec(ws, res, args, stdout))
+}
+
+// prepareWorkspace creates a job workspace and puts the source file into it.
+func (p *Processor) prepareWorkspace(kind, fileName string, fromQueue bool) (*workspace.Workspace, error) {
+	p.log.Debug().Msg("calling `prepareWorkspace` method")
+	ws, err := p.workspace.Create(kind, fileName)
+	if err != nil {
+		return nil, err
+	}
 	if fromQueue {
-		err := p.s3.DownloadFile(fileName)
+		err = p.s3.DownloadFile(fileName, ws.Path("source", fileName))
 		if err != nil {
 			p.log.Error().Err(err).Msg(errors.DownloadS3Error)
-			return nil, err
 		}
+	} else {
+		err = p.workspace.Import(ws, fileName)
+	}
+	if err != nil {
+		p.workspace.Release(ws, true)
+		return nil, err
 	}
+	return ws, nil
+}
+
+// RunValidation runs validation command tracking its progress in DB, the final result is saved by the caller.
+func (p *Processor) RunValidation(ctx context.Context, fileName string, dryRun, fromQueue bool) (*models.ValidationData, error) {
+	p.log.Debug().Msg("calling `RunValidation` method")
+	ws, err := p.prepareWorkspace(constants.JobValidation, fileName, fromQueue)
+	if err != nil {
+		return nil, err
+	}
+	failed := true
+	passed := false
+	defer func() {
+		// a source of a local upload is kept for processing once it has passed validation
+		if !fromQueue && !dryRun && passed {
+			p.workspace.Export(ws, fileName)
+		}
+		p.workspace.Release(ws, failed)
+	}()
 
-	executable := p.cfg.Docker.DockerExecutable
 	args := []string{
-		executable,
-		"run",
-		"--rm",
-		"-v",
-		fmt.Sprintf("%s:/mnt", p.cfg.Docker.MountDir),
-		p.cfg.Docker.DockerImageName,
 		"main.py",
 		"validate",
 		"--input",
@@ -81,24 +133,19 @@ func (p *Processor) RunValidation(ctx context.Context, fileName string, dryRun,
 	}
 
 	if !dryRun {
-		err := p.st.UpdateValidationStatus(ctx, fileName, constants.ValidationStatusRunning)
+		err = p.st.UpdateValidationStatus(ctx, fileName, constants.ValidationStatusRunning)
 		if err != nil {
 			p.log.Error().Err(err).Msg(errors.ValidationStatusUpdateError)
 			return nil, err
 		}
 	}
 	catcher := &bytes.Buffer{}
-	cmd := p.prepareCommand(executable, args, catcher)
-	p.log.Info().Msg(cmd.String())
-	err := cmd.Run()
+	err = p.run(ctx, constants.JobValidation, ws, args, catcher)
 	if err != nil {
 		p.log.Error().Err(err).Msg(errors.ValidationSubprocessError)
 		if !dryRun {
-			err := p.st.UpdateValidationStatus(ctx, fileName, constants.ValidationStatusError)
-			if err != nil {
-				p.log.Error().Err(err).Msg(errors.ValidationStatusUpdateError)
-				return nil, err
-			}
+			p.setValidationStatus(ctx, fileName, failureStatus(ctx, constants.ValidationStatusError,
+				constants.ValidationStatusCancelled, constants.ValidationStatusTimeout))
 		}
 		return nil, err
 	}
@@ -110,46 +157,34 @@ func (p *Processor) RunValidation(ctx context.Context, fileName string, dryRun,
 	err = json.Unmarshal(cmdStdout, &cmdOutput)
 	if err != nil {
 		p.log.Error().Err(err).Str("data", string(cmdStdout)).Msg(errors.ValidationDataUnmarshalError)
-		return nil, err
-	}
-
-	if !dryRun {
-		if cmdOutput.Passed {
-			err = p.st.UpdateValidationStatus(ctx, fileName, constants.ValidationStatusValid)
-			if err != nil {
-				p.log.Error().Err(err).Msg(errors.ValidationStatusUpdateError)
-				return nil, err
-			}
-		} else {
-			err = p.st.UpdateValidationStatus(ctx, fileName, constants.ValidationStatusInvalid)
-			if err != nil {
-				p.log.Error().Err(err).Msg(errors.ValidationStatusUpdateError)
-				return nil, err
-			}
+		if !dryRun {
+			p.setValidationStatus(ctx, fileName, constants.ValidationStatusError)
 		}
+		return nil, err
 	}
+	failed = false
+	passed = cmdOutput.Passed
 	return cmdOutput, nil
 }
 
-// RunProcessing runs processing command and interacts with DB.
-func (p *Processor) RunProcessing(ctx context.Context, fileName, barcode string, dryRun, fromQueue bool) error {
+// RunProcessing runs processing command and uploads its results tracking progress in DB, the final status is saved
+// by the caller. It returns the uploaded results.
+func (p *Processor) RunProcessing(ctx context.Context, userID, fileName, barcode string, dryRun, fromQueue bool) ([]s3Models.Object, error) {
 	p.log.Debug().Msg("calling `RunProcessing` method")
-	if fromQueue {
-		err := p.s3.DownloadFile(fileName)
-		if err != nil {
-			p.log.Error().Err(err).Msg(errors.DownloadS3Error)
-			return err
-		}
+	ws, err := p.prepareWorkspace(constants.JobProcessing, fileName, fromQueue)
+	if err != nil {
+		return nil, err
 	}
+	failed := true
+	defer func() {
+		// a source of a local upload is kept until it is processed, so that a dry or failed run can be repeated
+		if !fromQueue && (dryRun || failed) {
+			p.workspace.Export(ws, fileName)
+		}
+		p.workspace.Release(ws, failed)
+	}()
 
-	executable := p.cfg.Docker.DockerExecutable
 	args := []string{
-		executable,
-		"run",
-		"--rm",
-		"-v",
-		fmt.Sprintf("%s:/mnt", p.cfg.Docker.MountDir),
-		p.cfg.Docker.DockerImageName,
 		"main.py",
 		"process",
 		"--input",
@@ -158,61 +193,108 @@ func (p *Processor) RunProcessing(ctx context.Context, fileName, barcode string,
 		barcode,
 	}
 
-	err := p.st.UpdateProcessingStatus(ctx, fileName, constants.ProcessingStatusRunning)
+	err = p.st.UpdateProcessingStatus(ctx, fileName, constants.ProcessingStatusRunning)
 	if err != nil {
 		p.log.Error().Err(err).Msg(errors.ProcessingStatusUpdateError)
-		return err
+		return nil, err
 	}
 
-	cmd := p.prepareCommand(executable, args, os.Stdout)
-
-	err = cmd.Run()
+	err = p.run(ctx, constants.JobProcessing, ws, args, os.Stdout)
 	if err != nil {
 		p.log.Error().Err(err).Msg(errors.ProcessingSubprocessError)
-		err := p.st.UpdateProcessingStatus(ctx, fileName, constants.ProcessingStatusError)
-		if err != nil {
-			p.log.Error().Err(err).Msg(errors.ProcessingStatusUpdateError)
-			return err
-		}
-		return err
-	}
-	err = p.st.UpdateProcessingStatus(ctx, fileName, constants.ProcessingStatusDone)
-	if err != nil {
-		p.log.Error().Err(err).Msg(errors.ProcessingStatusUpdateError)
-		return err
+		p.setProcessingStatus(ctx, fileName, failureStatus(ctx, constants.ProcessingStatusError,
+			constants.ProcessingStatusCancelled, constants.ProcessingStatusTimeout))
+		return nil, err
 	}
+	var objects []s3Models.Object
 	if !dryRun {
-		err = p.uploadData(barcode)
+		objects, err = p.uploadData(ctx, ws, userID, barcode)
 		if err != nil {
 			p.log.Error().Err(err).Msg(errors.UploadRoutineError)
-			return err
+			p.setProcessingStatus(ctx, fileName, constants.ProcessingStatusError)
+			return nil, err
 		}
 	}
-	return nil
+	failed = false
+	return objects, nil
+}
+
+// failureStatus picks a status of a failed job telling a cancelled or timed out run from a failed one.
+func failureStatus(ctx context.Context, failed, cancelled, timeout string) string {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return timeout
+	case context.Canceled:
+		return cancelled
+	default:
+		return failed
+	}
+}
+
+// statusContext returns the job context or a new one if the job context is already done, so that the final status
+// of a cancelled job is still saved.
+func statusContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx.Err() == nil {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(context.Background(), statusTimeout)
+}
+
+// setValidationStatus updates validation status logging a failure since the status update is not the cause of
+// an error being returned.
+func (p *Processor) setValidationStatus(ctx context.Context, fileName, status string) {
+	p.log.Debug().Msg("calling `setValidationStatus` method")
+	ctx, cancel := statusContext(ctx)
+	defer cancel()
+	if err := p.st.UpdateValidationStatus(ctx, fileName, status); err != nil {
+		p.log.Error().Err(err).Msg(errors.ValidationStatusUpdateError)
+	}
 }
 
-// uploadData uploads data to S3.
-func (p *Processor) uploadData(barcode string) error {
+// setProcessingStatus updates processing status logging a failure since the status update is not the cause of
+// an error being returned.
+func (p *Processor) setProcessingStatus(ctx context.Context, fileName, status string) {
+	p.log.Debug().Msg("calling `setProcessingStatus` method")
+	ctx, cancel := statusContext(ctx)
+	defer cancel()
+	if err := p.st.UpdateProcessingStatus(ctx, fileName, status); err != nil {
+		p.log.Error().Err(err).Msg(errors.ProcessingStatusUpdateError)
+	}
+}
+
+// uploadData uploads artifacts of a job workspace to S3 and returns the uploaded objects sorted by key.
+func (p *Processor) uploadData(ctx context.Context, ws *workspace.Workspace, userID, barcode string) ([]s3Models.Object, error) {
 	p.log.Debug().Msg("calling `uploadData` method")
-	files := map[string][]string{
-		fmt.Sprintf("%s/raw_data/atlas_raw_data/%s.txt", p.cfg.Docker.MountDir, barcode):    {"internal_raw_data", fmt.Sprintf("%s.txt", barcode)},
-		fmt.Sprintf("%s/raw_data/external_raw_data/%s.txt", p.cfg.Docker.MountDir, barcode): {"external_raw_data", fmt.Sprintf("%s.txt", barcode)},
-		fmt.Sprintf("%s/raw_data/binary/%s.bed", p.cfg.Docker.MountDir, barcode):            {"binary_raw_data", fmt.Sprintf("%s.bed", barcode)},
-		fmt.Sprintf("%s/raw_data/binary/%s.bim", p.cfg.Docker.MountDir, barcode):            {"binary_raw_data", fmt.Sprintf("%s.bim", barcode)},
-		fmt.Sprintf("%s/raw_data/binary/%s.fam", p.cfg.Docker.MountDir, barcode):            {"binary_raw_data", fmt.Sprintf("%s.fam", barcode)},
+	productCode, err := p.st.GetProductCode(ctx, userID)
+	if err != nil {
+		p.log.Error().Err(err).Msg(errors.ProductCodeError)
+		return nil, err
+	}
+	if productCode == constants.NA {
+		productCode = ""
+	}
+	files, err := p.manifest.Resolve(ws.Dir, artifacts.NewData(barcode, userID, productCode, time.Now()))
+	if err != nil {
+		p.log.Error().Err(err).Msg(errors.ArtifactResolvingError)
+		return nil, err
 	}
 
 	g := &errgroup.Group{}
-	for path, meta := range files {
-		filePath := path
-		fileType := meta[0]
-		fileEndName := meta[1]
+	objects := make([]s3Models.Object, len(files))
+	for i, file := range files {
+		file := file
+		object := &objects[i]
 		g.Go(func() error {
-			return p.s3.UploadFile(filePath, fileType, fileEndName)
+			uploaded, err := p.s3.UploadFile(file.Path, file.Key, file.ContentType)
+			if err != nil {
+				return err
+			}
+			*object = *uploaded
+			return nil
 		})
 	}
 	if err := g.Wait(); err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return objects, nil
 }
@@ -0,0 +1,13 @@
+// Package errors provides string codes for error instantiation.
+
+package errors
+
+const (
+	GettingStaleJobsError   = "could not find stale jobs in DB"
+	GettingRunningJobsError = "could not find running jobs in DB"
+	ExpiringJobError        = "could not expire a stale job"
+	RequeueingJobError      = "could not requeue a stale job"
+	GettingCurrentFileError = "could not find the current upload of a stale job"
+	InvalidActionError      = "invalid reaping action"
+	JobAliveError           = "job lease expired but the job is still locked by a consumer"
+)
@@ -0,0 +1,234 @@
+// Package reaper provides functionality for expiring validation and processing jobs left running by crashed consumers.
+
+package reaper
+
+import (
+	"context"
+	goErrors "errors"
+	"fmt"
+	"time"
+	"upload-service-auto/internal/agent/agent"
+	"upload-service-auto/internal/bus"
+	"upload-service-auto/internal/bus/codec"
+	"upload-service-auto/internal/bus/modelbus"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/constants"
+	"upload-service-auto/internal/reaper/errors"
+	"upload-service-auto/internal/storage"
+	storageErrors "upload-service-auto/internal/storage/errors"
+	storageModels "upload-service-auto/internal/storage/v1/models"
+	"upload-service-auto/internal/workspace"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// ActionError marks stale jobs as failed.
+	ActionError = "error"
+	// ActionRequeue resets stale jobs and publishes them to their input exchange again. A stale validation job of a
+	// file which is no longer the current upload of its user is marked as failed, so that the newer upload is not
+	// replaced by the older one.
+	ActionRequeue = "requeue"
+
+	reapTimeout = 60 * time.Second
+)
+
+// Reaper defines an object and sets its attributes.
+type Reaper struct {
+	log       *zerolog.Logger
+	cfg       *config.Config
+	storage   storage.Storage
+	bus       bus.Bus
+	workspace *workspace.Manager
+}
+
+// NewReaper initializes a new Reaper instance.
+func NewReaper(logger *zerolog.Logger, cfg *config.Config, storage storage.Storage, bus bus.Bus, workspace *workspace.Manager) *Reaper {
+	logger.Debug().Msg("calling initializer of reaper service")
+	return &Reaper{
+		log:       logger,
+		cfg:       cfg,
+		storage:   storage,
+		bus:       bus,
+		workspace: workspace,
+	}
+}
+
+// Run reaps stale jobs and prunes expired workspaces of failed jobs periodically until the context is done.
+func (r *Reaper) Run(ctx context.Context) {
+	r.log.Debug().Msg("calling `Run` method")
+	if r.cfg.Jobs.ReapInterval <= 0 {
+		r.log.Info().Msg("reaper is disabled")
+		return
+	}
+	ticker := time.NewTicker(r.cfg.Jobs.ReapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ctxReap, cancel := context.WithTimeout(ctx, reapTimeout)
+			_, err := r.Reap(ctxReap, r.cfg.Jobs.ReapAction)
+			cancel()
+			if err != nil {
+				r.log.Error().Err(err).Msg("reaping stale jobs failed")
+			}
+			ctxPrune, cancel := context.WithTimeout(ctx, reapTimeout)
+			_, err = r.PruneWorkspaces(ctxPrune)
+			cancel()
+			if err != nil {
+				r.log.Error().Err(err).Msg("pruning workspaces failed")
+			}
+		}
+	}
+}
+
+// Reap expires jobs whose lease has run out applying the given action and returns the expired jobs.
+func (r *Reaper) Reap(ctx context.Context, action string) ([]storageModels.Job, error) {
+	r.log.Debug().Msg("calling `Reap` method")
+	if action != ActionError && action != ActionRequeue {
+		err := fmt.Errorf("%s: %s", errors.InvalidActionError, action)
+		r.log.Error().Err(err).Msg(errors.InvalidActionError)
+		return nil, err
+	}
+	before := time.Now().Add(-r.cfg.Jobs.LeaseDuration)
+
+	var expired []storageModels.Job
+	for _, kind := range constants.ValidJobs {
+		jobs, err := r.storage.GetStaleJobs(ctx, kind, before)
+		if err != nil {
+			r.log.Error().Err(err).Str("job", kind).Msg(errors.GettingStaleJobsError)
+			return expired, err
+		}
+		for _, job := range jobs {
+			ok, err := r.reapJob(ctx, job, action, before)
+			if err != nil {
+				return expired, err
+			}
+			if ok {
+				expired = append(expired, job)
+			}
+		}
+	}
+	r.log.Info().Int("count", len(expired)).Str("action", action).Msg("reaping stale jobs done")
+	return expired, nil
+}
+
+// PruneWorkspaces removes workspaces of failed jobs kept longer than the retention period and returns their number.
+// Workspaces of jobs still holding a lease are kept however long they run.
+func (r *Reaper) PruneWorkspaces(ctx context.Context) (int, error) {
+	r.log.Debug().Msg("calling `PruneWorkspaces` method")
+	leased, err := r.leasedJobs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return r.workspace.Prune(func(kind, fileName string) bool {
+		return leased[kind+"/"+fileName]
+	})
+}
+
+// leasedJobs returns running jobs whose lease has not run out keyed by their kind and file name.
+func (r *Reaper) leasedJobs(ctx context.Context) (map[string]bool, error) {
+	r.log.Debug().Msg("calling `leasedJobs` method")
+	now := time.Now()
+	expiry := now.Add(-r.cfg.Jobs.LeaseDuration)
+	leased := make(map[string]bool)
+	for _, kind := range constants.ValidJobs {
+		// all running jobs were last known to be alive before now
+		jobs, err := r.storage.GetStaleJobs(ctx, kind, now)
+		if err != nil {
+			r.log.Error().Err(err).Str("job", kind).Msg(errors.GettingRunningJobsError)
+			return nil, err
+		}
+		for _, job := range jobs {
+			if !job.HeartbeatAt.Before(expiry) {
+				leased[kind+"/"+job.FileName] = true
+			}
+		}
+	}
+	return leased, nil
+}
+
+// reapJob expires one stale job reporting whether it was expired.
+func (r *Reaper) reapJob(ctx context.Context, job storageModels.Job, action string, before time.Time) (bool, error) {
+	r.log.Debug().Msg("calling `reapJob` method")
+	status := constants.ValidationStatusError
+	requeue := false
+	unlock := func() {}
+	if job.Kind == constants.JobProcessing {
+		// a consumer holding the lock is alive even though it failed to extend the lease
+		var err error
+		unlock, err = r.storage.TryLock(ctx, agent.ProcessingLockKey(job.FileName))
+		var lockErr *storageErrors.LockNotAcquiredError
+		if goErrors.As(err, &lockErr) {
+			r.log.Warn().Str("fileName", job.FileName).Msg(errors.JobAliveError)
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		status = constants.ProcessingStatusError
+		if action == ActionRequeue {
+			status = constants.ProcessingStatusNew
+			requeue = true
+		}
+	} else if action == ActionRequeue {
+		current, err := r.storage.GetFileNameForUser(ctx, job.UserID)
+		var notFound *storageErrors.NotFoundError
+		if err != nil && !goErrors.As(err, &notFound) {
+			r.log.Error().Err(err).Str("fileName", job.FileName).Msg(errors.GettingCurrentFileError)
+			return false, err
+		}
+		if err == nil && current == job.FileName {
+			status = constants.ValidationStatusNew
+			requeue = true
+		}
+	}
+
+	// the lock is released before requeueing, so that a consumer can take the job at once
+	ok, err := r.storage.ExpireJob(ctx, job.Kind, job.FileName, status, before)
+	unlock()
+	if err != nil {
+		r.log.Error().Err(err).Str("job", job.Kind).Str("fileName", job.FileName).Msg(errors.ExpiringJobError)
+		return false, err
+	}
+	if !ok {
+		return false, nil
+	}
+	r.log.Warn().Str("job", job.Kind).Str("fileName", job.FileName).Str("userID", job.UserID).
+		Time("heartbeatAt", job.HeartbeatAt).Str("status", status).Msg("stale job expired")
+
+	if requeue {
+		if err = r.requeue(job); err != nil {
+			r.log.Error().Err(err).Str("fileName", job.FileName).Msg(errors.RequeueingJobError)
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// requeue publishes a job to the input exchange of its kind.
+func (r *Reaper) requeue(job storageModels.Job) error {
+	r.log.Debug().Msg("calling `requeue` method")
+	if job.Kind == constants.JobValidation {
+		publishing, err := codec.Message(codec.ContentTypeJSON, codec.NewEnvelope(""), modelbus.MsgValidate{
+			UserID:   job.UserID,
+			FileName: job.FileName,
+		})
+		if err != nil {
+			return err
+		}
+		return r.bus.Publish(r.cfg.AMQP.ValidationExchangeInputName, publishing)
+	}
+	publishing, err := codec.Message(codec.ContentTypeJSON, codec.NewEnvelope(""), modelbus.MsgProcess{
+		UserID:   job.UserID,
+		FileName: job.FileName,
+		Barcode:  job.Barcode,
+	})
+	if err != nil {
+		return err
+	}
+	return r.bus.Publish(r.cfg.AMQP.ProcessingExchangeInputName, publishing)
+}
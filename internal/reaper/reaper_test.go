@@ -0,0 +1,81 @@
+package reaper
+
+import (
+	"context"
+	"testing"
+	"time"
+	"upload-service-auto/internal/bus/codec"
+	"upload-service-auto/internal/bus/memory"
+	"upload-service-auto/internal/bus/modelbus"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/constants"
+	storageMemory "upload-service-auto/internal/storage/v1/memory"
+
+	"github.com/rs/zerolog"
+)
+
+func TestReapRequeuesValidationOfCurrentUpload(t *testing.T) {
+	logger := zerolog.Nop()
+	cfg := &config.Config{}
+	cfg.AMQP.ValidationExchangeInputName = "validation_exchange_input"
+	cfg.AMQP.ProcessingExchangeInputName = "processing_exchange_input"
+	cfg.AMQP.ValidationQueueName = "validation"
+	cfg.AMQP.ProcessingQueueName = "processing"
+	// every running job is stale
+	cfg.Jobs.LeaseDuration = -time.Minute
+	storage := storageMemory.NewStorage(&logger)
+	broker := memory.NewBroker(cfg, &logger)
+	r := NewReaper(&logger, cfg, storage, broker, nil)
+
+	ctx := context.Background()
+	for _, upload := range []struct{ userID, fileName string }{
+		{"user", "file.txt"},
+		{"other", "old.txt"},
+	} {
+		for _, err := range []error{
+			storage.AddNewUserID(ctx, upload.userID),
+			storage.AddNewUserFilePair(ctx, upload.userID, upload.fileName),
+			storage.AddNewValidationEntry(ctx, upload.fileName),
+			storage.UpdateValidationStatus(ctx, upload.fileName, constants.ValidationStatusRunning),
+		} {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := storage.AddNewUserFilePair(ctx, "other", "new.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := r.Reap(ctx, ActionRequeue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 2 {
+		t.Fatalf("expected 2 expired jobs, got %+v", expired)
+	}
+	for fileName, expected := range map[string]string{
+		"file.txt": constants.ValidationStatusNew,
+		"old.txt":  constants.ValidationStatusError,
+	} {
+		validation, err := storage.GetValidationResult(ctx, fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if validation.Status != expected {
+			t.Errorf("expected validation of %s to be %s, got %s", fileName, expected, validation.Status)
+		}
+	}
+
+	messages := broker.Messages(cfg.AMQP.ValidationQueueName)
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 requeued validation, got %d", len(messages))
+	}
+	msg := modelbus.MsgValidate{}
+	if _, err = codec.Decode(messages[0].ContentType, messages[0].Body, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.UserID != "user" || msg.FileName != "file.txt" {
+		t.Errorf("unexpected requeued validation %+v", msg)
+	}
+}
@@ -0,0 +1,12 @@
+// Package errors provides string codes for error instantiation.
+
+package errors
+
+const (
+	ListingObjectsError       = "could not list objects in S3"
+	GettingEntriesError       = "could not find processing entries in DB"
+	GettingArtifactsError     = "could not find artifacts in DB"
+	ResettingStatusError      = "could not reset processing status"
+	RemovingOrphanError       = "could not remove an orphaned object"
+	ProcessingInProgressError = "processing is running, the status is not reset"
+)
@@ -0,0 +1,313 @@
+// Package reconciler provides functionality for comparing processing results recorded in DB with the bucket contents.
+
+package reconciler
+
+import (
+	"context"
+	goErrors "errors"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"upload-service-auto/internal/agent/agent"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/constants"
+	"upload-service-auto/internal/reconciler/errors"
+	"upload-service-auto/internal/s3/artifacts"
+	"upload-service-auto/internal/s3/s3"
+	s3Models "upload-service-auto/internal/s3/v1/models"
+	"upload-service-auto/internal/storage"
+	storageErrors "upload-service-auto/internal/storage/errors"
+	storageModels "upload-service-auto/internal/storage/v1/models"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// ProblemMissing marks a result of a processed file that is not in the bucket.
+	ProblemMissing = "missing"
+	// ProblemOrphaned marks an object that does not belong to a processed file or a barcode in DB.
+	ProblemOrphaned = "orphaned"
+	// ProblemSizeMismatch marks an object whose size differs from the recorded one.
+	ProblemSizeMismatch = "size_mismatch"
+)
+
+// Problem defines a difference between DB and the bucket. Key is empty for a processed file without any results,
+// sizes are set for size mismatches only.
+type Problem struct {
+	Kind         string
+	UserID       string
+	FileName     string
+	Barcode      string
+	Key          string
+	ExpectedSize int64
+	ActualSize   int64
+	Fixed        bool
+}
+
+// Reconciler defines an object and sets its attributes.
+type Reconciler struct {
+	log      *zerolog.Logger
+	cfg      *config.Config
+	storage  storage.Storage
+	s3       *s3.Service
+	manifest *artifacts.Manifest
+}
+
+// NewReconciler initializes a new Reconciler instance.
+func NewReconciler(logger *zerolog.Logger, cfg *config.Config, storage storage.Storage, s3 *s3.Service, manifest *artifacts.Manifest) *Reconciler {
+	logger.Debug().Msg("calling initializer of reconciler service")
+	return &Reconciler{
+		log:      logger,
+		cfg:      cfg,
+		storage:  storage,
+		s3:       s3,
+		manifest: manifest,
+	}
+}
+
+// state defines DB records and bucket contents compared by the reconciler.
+type state struct {
+	objects   map[string]s3Models.Object
+	artifacts map[string]storageModels.Artifact
+	recorded  map[string][]storageModels.Artifact
+	entries   map[string][]storageModels.Processing
+	files     map[string]bool
+}
+
+// load lists the folders results are uploaded to and reads processing entries and artifacts of the bucket, only
+// recorded objects and objects matching a key of the manifest are kept.
+func (r *Reconciler) load(ctx context.Context) (*state, error) {
+	r.log.Debug().Msg("calling `load` method")
+	st := &state{
+		objects:   make(map[string]s3Models.Object),
+		artifacts: make(map[string]storageModels.Artifact),
+		recorded:  make(map[string][]storageModels.Artifact),
+		entries:   make(map[string][]storageModels.Processing),
+		files:     make(map[string]bool),
+	}
+	for _, prefix := range r.manifest.Prefixes() {
+		objects, err := r.s3.ListResults(prefix)
+		if err != nil {
+			r.log.Error().Err(err).Str("prefix", prefix).Msg(errors.ListingObjectsError)
+			return nil, err
+		}
+		for _, object := range objects {
+			st.objects[object.Key] = object
+		}
+	}
+
+	entries, err := r.storage.GetProcessingEntries(ctx)
+	if err != nil {
+		r.log.Error().Err(err).Msg(errors.GettingEntriesError)
+		return nil, err
+	}
+	for _, entry := range entries {
+		st.files[entry.FileName] = true
+		if entry.Barcode != "" {
+			st.entries[entry.Barcode] = append(st.entries[entry.Barcode], entry)
+		}
+	}
+
+	recorded, err := r.storage.GetAllArtifacts(ctx)
+	if err != nil {
+		r.log.Error().Err(err).Msg(errors.GettingArtifactsError)
+		return nil, err
+	}
+	for _, artifact := range recorded {
+		if artifact.Bucket != r.cfg.S3Storage.Bucket {
+			continue
+		}
+		st.artifacts[artifact.Key] = artifact
+		st.recorded[artifact.FileName] = append(st.recorded[artifact.FileName], artifact)
+	}
+
+	// objects neither recorded nor matching a key of the manifest are not results, e.g. if a listed folder is shared
+	// with other data or is the whole bucket
+	for key := range st.objects {
+		if _, ok := st.artifacts[key]; !ok && !r.manifest.Matches(key) {
+			delete(st.objects, key)
+		}
+	}
+	return st, nil
+}
+
+// barcode returns the barcode an object belongs to. Recorded objects belong to the barcode of their record, results
+// uploaded before artifacts were recorded belong to a barcode in DB matching a folder of the key or the file name
+// without extensions.
+func (st *state) barcode(key string) string {
+	if artifact, ok := st.artifacts[key]; ok {
+		return artifact.Barcode
+	}
+	segments := strings.Split(key, "/")
+	name := segments[len(segments)-1]
+	if i := strings.Index(name, "."); i > 0 {
+		segments = append(segments, name[:i])
+	}
+	for _, segment := range segments {
+		if _, ok := st.entries[segment]; ok {
+			return segment
+		}
+	}
+	return ""
+}
+
+// Reconcile compares processing entries and recorded artifacts with the folders results are uploaded to and returns
+// the problems found sorted by kind and key. With fix set, processing of files with missing or size-mismatched
+// results is reset, so that the files are processed again, and orphaned objects are removed.
+func (r *Reconciler) Reconcile(ctx context.Context, fix bool) ([]Problem, error) {
+	r.log.Debug().Msg("calling `Reconcile` method")
+	st, err := r.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []Problem
+	found := make(map[string]bool)
+	for key := range st.objects {
+		if barcode := st.barcode(key); barcode != "" {
+			found[barcode] = true
+		}
+	}
+	for barcode, entries := range st.entries {
+		for _, entry := range entries {
+			if entry.Status != constants.ProcessingStatusDone {
+				continue
+			}
+			recorded := st.recorded[entry.FileName]
+			if len(recorded) == 0 && !found[barcode] {
+				problems = append(problems, Problem{Kind: ProblemMissing, UserID: entry.UserID,
+					FileName: entry.FileName, Barcode: barcode})
+			}
+			for _, artifact := range recorded {
+				object, ok := st.objects[artifact.Key]
+				switch {
+				case !ok:
+					problems = append(problems, Problem{Kind: ProblemMissing, UserID: entry.UserID,
+						FileName: entry.FileName, Barcode: barcode, Key: artifact.Key})
+				case object.Size != artifact.Size:
+					problems = append(problems, Problem{Kind: ProblemSizeMismatch, UserID: entry.UserID,
+						FileName: entry.FileName, Barcode: barcode, Key: artifact.Key,
+						ExpectedSize: artifact.Size, ActualSize: object.Size})
+				}
+			}
+		}
+	}
+
+	// recent objects may belong to a job that has not recorded them yet
+	before := time.Now().Add(-r.cfg.Jobs.LeaseDuration)
+	for key, object := range st.objects {
+		if object.ModifiedAt.After(before) || r.isSource(key) {
+			continue
+		}
+		// a recorded object belongs to its file even if the file was reprocessed with another barcode, the processing
+		// entry keeps the barcode of the first run
+		artifact, recorded := st.artifacts[key]
+		if recorded && st.files[artifact.FileName] {
+			continue
+		}
+		barcode := st.barcode(key)
+		if _, ok := st.entries[barcode]; ok {
+			continue
+		}
+		problems = append(problems, Problem{Kind: ProblemOrphaned, UserID: artifact.UserID,
+			FileName: artifact.FileName, Barcode: barcode, Key: key})
+	}
+	sort.Slice(problems, func(i, j int) bool {
+		if problems[i].Kind != problems[j].Kind {
+			return problems[i].Kind < problems[j].Kind
+		}
+		if problems[i].Key != problems[j].Key {
+			return problems[i].Key < problems[j].Key
+		}
+		return problems[i].FileName < problems[j].FileName
+	})
+	r.log.Info().Int("count", len(problems)).Msg("reconciliation done")
+
+	if fix {
+		r.fix(ctx, problems)
+	}
+	return problems, nil
+}
+
+// isSource reports whether a key is a source file, which is never orphaned, in case results share the upload bucket.
+func (r *Reconciler) isSource(key string) bool {
+	return r.cfg.S3Storage.Bucket == r.cfg.S3Storage.BucketUpload &&
+		strings.HasPrefix(key, path.Clean(r.cfg.S3Storage.FolderUpload)+"/")
+}
+
+// fix fixes problems marking the fixed ones, a failed fix is logged and the rest are still fixed.
+func (r *Reconciler) fix(ctx context.Context, problems []Problem) {
+	r.log.Debug().Msg("calling `fix` method")
+	reset := make(map[string]bool)
+	for i := range problems {
+		problem := &problems[i]
+		switch problem.Kind {
+		case ProblemMissing, ProblemSizeMismatch:
+			// a file with several problems is reset once
+			if done, ok := reset[problem.FileName]; ok {
+				problem.Fixed = done
+				continue
+			}
+			err := r.resetProcessing(ctx, problem.FileName)
+			if err != nil {
+				r.log.Error().Err(err).Str("fileName", problem.FileName).Msg(errors.ResettingStatusError)
+			}
+			reset[problem.FileName] = err == nil
+			problem.Fixed = err == nil
+		case ProblemOrphaned:
+			if err := r.removeOrphan(ctx, problem); err != nil {
+				r.log.Error().Err(err).Str("key", problem.Key).Msg(errors.RemovingOrphanError)
+				continue
+			}
+			problem.Fixed = true
+		}
+	}
+}
+
+// resetProcessing resets processing of a file to the new status unless the file is being processed.
+func (r *Reconciler) resetProcessing(ctx context.Context, fileName string) error {
+	r.log.Debug().Msg("calling `resetProcessing` method")
+	unlock, err := r.storage.TryLock(ctx, agent.ProcessingLockKey(fileName))
+	var lockErr *storageErrors.LockNotAcquiredError
+	if goErrors.As(err, &lockErr) {
+		r.log.Warn().Str("fileName", fileName).Msg(errors.ProcessingInProgressError)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err = r.storage.UpdateProcessingStatus(ctx, fileName, constants.ProcessingStatusNew); err != nil {
+		return err
+	}
+	r.log.Warn().Str("fileName", fileName).Msg("processing reset")
+	return nil
+}
+
+// removeOrphan removes an orphaned object and its record if there is one, the removal is recorded in the deletion
+// audit.
+func (r *Reconciler) removeOrphan(ctx context.Context, problem *Problem) error {
+	r.log.Debug().Msg("calling `removeOrphan` method")
+	if err := r.s3.DeleteResult(problem.Key); err != nil {
+		return err
+	}
+	err := r.storage.WithinTx(ctx, func(ctx context.Context) error {
+		if err := r.storage.RemoveArtifact(ctx, r.cfg.S3Storage.Bucket, problem.Key); err != nil {
+			return err
+		}
+		return r.storage.AddDeletionAudit(ctx, &storageModels.DeletionAudit{
+			UserID: problem.UserID,
+			Kind:   constants.ObjectKindArtifact,
+			Bucket: r.cfg.S3Storage.Bucket,
+			Key:    problem.Key,
+			Reason: constants.DeletionReasonOrphaned,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	r.log.Warn().Str("key", problem.Key).Msg("orphaned object removed")
+	return nil
+}
@@ -0,0 +1,201 @@
+package reconciler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/constants"
+	"upload-service-auto/internal/s3/artifacts"
+	"upload-service-auto/internal/s3/blob"
+	"upload-service-auto/internal/s3/s3"
+	"upload-service-auto/internal/storage/v1/memory"
+	storageModels "upload-service-auto/internal/storage/v1/models"
+	"upload-service-auto/internal/syncutils"
+
+	"github.com/rs/zerolog"
+)
+
+// fixture defines a reconciler over the in-memory storage and the local blob store.
+type fixture struct {
+	cfg        *config.Config
+	storage    *memory.Storage
+	s3         *s3.Service
+	reconciler *Reconciler
+}
+
+// newFixture initializes a new fixture with the default artifact manifest.
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	logger := zerolog.Nop()
+	cfg := &config.Config{}
+	cfg.S3Storage.Backend = blob.BackendLocal
+	cfg.S3Storage.LocalDir = t.TempDir()
+	cfg.S3Storage.Bucket = "results"
+	cfg.S3Storage.BucketUpload = "uploads"
+	cfg.S3Storage.FolderUpload = "upload"
+	cfg.S3Storage.FolderInternal = "internal"
+	cfg.S3Storage.FolderExternal = "external"
+	cfg.S3Storage.FolderBinary = "binary"
+
+	manifest, err := artifacts.NewManifest(cfg, &logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, err := s3.NewService(cfg, &logger, syncutils.NewSyncUtils())
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := memory.NewStorage(&logger)
+	return &fixture{
+		cfg:        cfg,
+		storage:    storage,
+		s3:         service,
+		reconciler: NewReconciler(&logger, cfg, storage, service, manifest),
+	}
+}
+
+// processed adds a user with a processed file whose processing entry has the given barcode.
+func (f *fixture) processed(t *testing.T, userID, fileName, barcode string) {
+	t.Helper()
+	ctx := context.Background()
+	for _, err := range []error{
+		f.storage.AddNewUserID(ctx, userID),
+		f.storage.AddNewUserFilePair(ctx, userID, fileName),
+		f.storage.AddNewProcessingEntry(ctx, fileName, barcode),
+		f.storage.UpdateProcessingStatus(ctx, fileName, constants.ProcessingStatusDone),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// upload uploads a result and records it as an artifact of a file unless the file name is empty.
+func (f *fixture) upload(t *testing.T, userID, fileName, barcode, key string) {
+	t.Helper()
+	local := filepath.Join(t.TempDir(), filepath.Base(key))
+	if err := os.WriteFile(local, []byte(key), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	object, err := f.s3.UploadFile(local, key, "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileName == "" {
+		return
+	}
+	err = f.storage.AddArtifacts(context.Background(), []storageModels.Artifact{{
+		UserID:   userID,
+		FileName: fileName,
+		Barcode:  barcode,
+		Bucket:   f.cfg.S3Storage.Bucket,
+		Key:      object.Key,
+		Size:     object.Size,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// keys returns the keys of the results in the bucket.
+func (f *fixture) keys(t *testing.T) map[string]bool {
+	t.Helper()
+	objects, err := f.s3.ListResults("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		keys[object.Key] = true
+	}
+	return keys
+}
+
+func TestReconcileKeepsResultsOfFileReprocessedWithNewBarcode(t *testing.T) {
+	f := newFixture(t)
+	// the processing entry keeps the barcode of the first run, the results of the second run are recorded with the new
+	// one
+	f.processed(t, "user", "file.txt", "OLD")
+	f.upload(t, "user", "file.txt", "NEW", "internal/NEW.txt")
+	f.upload(t, "user", "file.txt", "NEW", "binary/NEW.bed")
+
+	problems, err := f.reconciler.Reconcile(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("expected no problems, got %+v", problems)
+	}
+	keys := f.keys(t)
+	for _, key := range []string{"internal/NEW.txt", "binary/NEW.bed"} {
+		if !keys[key] {
+			t.Errorf("%s was removed", key)
+		}
+	}
+}
+
+func TestReconcileRemovesOrphans(t *testing.T) {
+	f := newFixture(t)
+	f.processed(t, "user", "file.txt", "KEPT")
+	f.upload(t, "user", "file.txt", "KEPT", "internal/KEPT.txt")
+	f.upload(t, "", "", "", "internal/KEPT.bim")
+	f.upload(t, "", "", "", "internal/GONE.txt")
+	f.upload(t, "", "", "", "unrelated/GONE.txt")
+
+	problems, err := f.reconciler.Reconcile(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Kind != ProblemOrphaned || problems[0].Key != "internal/GONE.txt" ||
+		!problems[0].Fixed {
+		t.Fatalf("expected a fixed orphan internal/GONE.txt, got %+v", problems)
+	}
+	keys := f.keys(t)
+	if keys["internal/GONE.txt"] {
+		t.Error("orphan was not removed")
+	}
+	for _, key := range []string{"internal/KEPT.txt", "internal/KEPT.bim", "unrelated/GONE.txt"} {
+		if !keys[key] {
+			t.Errorf("%s was removed", key)
+		}
+	}
+}
+
+func TestReconcileReportsMissingResults(t *testing.T) {
+	f := newFixture(t)
+	f.processed(t, "user", "recorded.txt", "RECORDED")
+	f.processed(t, "user2", "unrecorded.txt", "UNRECORDED")
+	err := f.storage.AddArtifacts(context.Background(), []storageModels.Artifact{{
+		UserID:   "user",
+		FileName: "recorded.txt",
+		Barcode:  "RECORDED",
+		Bucket:   f.cfg.S3Storage.Bucket,
+		Key:      "internal/RECORDED.txt",
+		Size:     1,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := f.reconciler.Reconcile(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 2 {
+		t.Fatalf("expected 2 problems, got %+v", problems)
+	}
+	for _, problem := range problems {
+		if problem.Kind != ProblemMissing || !problem.Fixed {
+			t.Errorf("expected a fixed missing result, got %+v", problem)
+		}
+		status, err := f.storage.GetProcessingStatus(context.Background(), problem.FileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != constants.ProcessingStatusNew {
+			t.Errorf("processing of %s was not reset, status %s", problem.FileName, status)
+		}
+	}
+}
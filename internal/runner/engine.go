@@ -0,0 +1,237 @@
+// Package runner provides container runtimes executing the pipeline image.
+
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"upload-service-auto/internal/runner/errors"
+
+	"github.com/rs/zerolog"
+)
+
+// engineHost is a placeholder host of requests sent to the Docker Engine socket.
+const engineHost = "http://docker"
+
+// EngineRunner runs containers via the Docker Engine API over a unix socket.
+type EngineRunner struct {
+	log         *zerolog.Logger
+	client      *http.Client
+	stopTimeout time.Duration
+}
+
+// NewEngineRunner initializes a new EngineRunner instance.
+func NewEngineRunner(logger *zerolog.Logger, socket string, stopTimeout time.Duration) *EngineRunner {
+	return &EngineRunner{
+		log:         logger,
+		stopTimeout: stopTimeout,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// do sends a request to the Docker Engine API decoding a JSON response into out if it is not nil.
+func (r *EngineRunner) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		serialized, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(serialized)
+	}
+	endpoint := engineHost + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return &errors.EngineAPIError{StatusCode: resp.StatusCode, Message: apiErr.Message}
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+// create creates a container pulling its image if it is missing.
+func (r *EngineRunner) create(ctx context.Context, spec *Spec) (string, error) {
+	binds := make([]string, 0, len(spec.Mounts))
+	for _, mount := range spec.Mounts {
+		bind := fmt.Sprintf("%s:%s", mount.Source, mount.Target)
+		if mount.ReadOnly {
+			bind += ":ro"
+		}
+		binds = append(binds, bind)
+	}
+	hostConfig := map[string]interface{}{
+		"Binds": binds,
+	}
+	if spec.CPUs > 0 {
+		hostConfig["NanoCpus"] = int64(spec.CPUs) * 1e9
+	}
+	if spec.MemoryMB > 0 {
+		hostConfig["Memory"] = int64(spec.MemoryMB) << 20
+	}
+	config := map[string]interface{}{
+		"Image":        spec.Image,
+		"Cmd":          spec.Args,
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"HostConfig":   hostConfig,
+	}
+	query := url.Values{}
+	if spec.Name != "" {
+		query.Set("name", spec.Name)
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err := r.do(ctx, http.MethodPost, "/containers/create", query, config, &created)
+	if apiErr, ok := err.(*errors.EngineAPIError); ok && apiErr.StatusCode == http.StatusNotFound {
+		r.log.Info().Str("image", spec.Image).Msg("pulling image")
+		if err = r.do(ctx, http.MethodPost, "/images/create", url.Values{"fromImage": {spec.Image}}, nil, nil); err != nil {
+			r.log.Error().Err(err).Str("image", spec.Image).Msg(errors.ImagePullError)
+			return "", err
+		}
+		err = r.do(ctx, http.MethodPost, "/containers/create", query, config, &created)
+	}
+	if err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// streamLogs copies demultiplexed container output until the container exits.
+func (r *EngineRunner) streamLogs(ctx context.Context, id string, stdout, stderr io.Writer) error {
+	query := url.Values{"follow": {"1"}, "stdout": {"1"}, "stderr": {"1"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/containers/%s/logs?%s", engineHost, id, query.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return &errors.EngineAPIError{StatusCode: resp.StatusCode, Message: errors.ContainerLogsError}
+	}
+
+	// every frame starts with a header holding the stream type and the frame size
+	header := make([]byte, 8)
+	for {
+		if _, err = io.ReadFull(resp.Body, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		dst := stdout
+		if header[0] == 2 {
+			dst = stderr
+		}
+		if dst == nil {
+			dst = io.Discard
+		}
+		if _, err = io.CopyN(dst, resp.Body, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			return err
+		}
+	}
+}
+
+// stop stops a container giving it the stop timeout to exit, the engine kills the container once the timeout is over.
+func (r *EngineRunner) stop(id, name string) {
+	r.log.Debug().Msg("calling `stop` method")
+	ctx, cancel := context.WithTimeout(context.Background(), r.stopTimeout+stopGrace)
+	defer cancel()
+
+	query := url.Values{"t": {strconv.Itoa(int(r.stopTimeout.Seconds()))}}
+	if err := r.do(ctx, http.MethodPost, fmt.Sprintf("/containers/%s/stop", id), query, nil, nil); err != nil {
+		r.log.Error().Err(err).Str("name", name).Msg(errors.ContainerStopError)
+		return
+	}
+	r.log.Info().Str("name", name).Msg("container stopped")
+}
+
+// Run runs a container, waits for it to exit and removes it, the container is stopped if the context is done first.
+func (r *EngineRunner) Run(ctx context.Context, spec *Spec) error {
+	r.log.Debug().Msg("calling `Run` method")
+	id, err := r.create(ctx, spec)
+	if err != nil {
+		r.log.Error().Err(err).Str("name", spec.Name).Msg(errors.ContainerCreationError)
+		return err
+	}
+	defer func() {
+		err := r.do(context.Background(), http.MethodDelete, "/containers/"+id, url.Values{"force": {"1"}}, nil, nil)
+		if err != nil {
+			r.log.Error().Err(err).Str("name", spec.Name).Msg(errors.ContainerRemovalError)
+		}
+	}()
+
+	if err = r.do(ctx, http.MethodPost, fmt.Sprintf("/containers/%s/start", id), nil, nil, nil); err != nil {
+		r.log.Error().Err(err).Str("name", spec.Name).Msg(errors.ContainerStartError)
+		return err
+	}
+	r.log.Info().Str("name", spec.Name).Str("image", spec.Image).Msg("container started")
+
+	logsDone := make(chan error, 1)
+	go func() {
+		logsDone <- r.streamLogs(ctx, id, spec.Stdout, spec.Stderr)
+	}()
+
+	var waited struct {
+		StatusCode int64 `json:"StatusCode"`
+	}
+	if err = r.do(ctx, http.MethodPost, fmt.Sprintf("/containers/%s/wait", id), nil, nil, &waited); err != nil {
+		if ctx.Err() != nil {
+			r.log.Warn().Err(ctx.Err()).Str("name", spec.Name).Msg("stopping container")
+			r.stop(id, spec.Name)
+			<-logsDone
+			return ctx.Err()
+		}
+		r.log.Error().Err(err).Str("name", spec.Name).Msg(errors.ContainerWaitError)
+		return err
+	}
+	if err = <-logsDone; err != nil {
+		r.log.Error().Err(err).Str("name", spec.Name).Msg(errors.ContainerLogsError)
+		return err
+	}
+	if waited.StatusCode != 0 {
+		return &errors.ExitError{Name: spec.Name, Code: waited.StatusCode}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+// Package errors provides string codes for error instantiation.
+
+package errors
+
+import (
+	"fmt"
+)
+
+const (
+	ContainerCreationError = "could not create a container"
+	ContainerStartError    = "could not start a container"
+	ContainerWaitError     = "could not wait for a container"
+	ContainerLogsError     = "could not read container logs"
+	ContainerRemovalError  = "could not remove a container"
+	ContainerStopError     = "could not stop a container"
+	ContainerKillError     = "could not kill a container"
+	ImagePullError         = "could not pull an image"
+	InvalidRuntimeError    = "invalid container runtime"
+)
+
+type (
+	EngineAPIError struct {
+		StatusCode int
+		Message    string
+	}
+	ExitError struct {
+		Name string
+		Code int64
+	}
+)
+
+func (e *EngineAPIError) Error() string {
+	return fmt.Sprintf("%s: docker engine responded with status %d", e.Message, e.StatusCode)
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("%s: container exited with code %d", e.Name, e.Code)
+}
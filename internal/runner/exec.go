@@ -0,0 +1,110 @@
+// Package runner provides container runtimes executing the pipeline image.
+
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+	"upload-service-auto/internal/runner/errors"
+
+	"github.com/rs/zerolog"
+)
+
+// ExecRunner runs containers with a docker compatible CLI such as docker or podman.
+type ExecRunner struct {
+	log         *zerolog.Logger
+	executable  string
+	stopTimeout time.Duration
+}
+
+// NewExecRunner initializes a new ExecRunner instance.
+func NewExecRunner(logger *zerolog.Logger, executable string, stopTimeout time.Duration) *ExecRunner {
+	return &ExecRunner{
+		log:         logger,
+		executable:  executable,
+		stopTimeout: stopTimeout,
+	}
+}
+
+// args builds CLI arguments for running a container.
+func (r *ExecRunner) args(spec *Spec) []string {
+	args := []string{r.executable, "run", "--rm"}
+	if spec.Name != "" {
+		args = append(args, "--name", spec.Name)
+	}
+	for _, mount := range spec.Mounts {
+		volume := fmt.Sprintf("%s:%s", mount.Source, mount.Target)
+		if mount.ReadOnly {
+			volume += ":ro"
+		}
+		args = append(args, "-v", volume)
+	}
+	if spec.CPUs > 0 {
+		args = append(args, "--cpus", strconv.Itoa(spec.CPUs))
+	}
+	if spec.MemoryMB > 0 {
+		args = append(args, "--memory", fmt.Sprintf("%dm", spec.MemoryMB))
+	}
+	args = append(args, spec.Image)
+	return append(args, spec.Args...)
+}
+
+// stop stops a named container giving it the stop timeout to exit and kills it if stopping fails.
+func (r *ExecRunner) stop(name string) {
+	r.log.Debug().Msg("calling `stop` method")
+	ctx, cancel := context.WithTimeout(context.Background(), 2*r.stopTimeout+stopGrace)
+	defer cancel()
+
+	seconds := strconv.Itoa(int(r.stopTimeout.Seconds()))
+	err := exec.CommandContext(ctx, r.executable, "stop", "-t", seconds, name).Run()
+	if err == nil {
+		r.log.Info().Str("name", name).Msg("container stopped")
+		return
+	}
+	r.log.Error().Err(err).Str("name", name).Msg(errors.ContainerStopError)
+	if err = exec.CommandContext(ctx, r.executable, "kill", name).Run(); err != nil {
+		r.log.Error().Err(err).Str("name", name).Msg(errors.ContainerKillError)
+		return
+	}
+	r.log.Info().Str("name", name).Msg("container killed")
+}
+
+// Run runs a container and waits for it to exit, the container is stopped if the context is done first.
+func (r *ExecRunner) Run(ctx context.Context, spec *Spec) error {
+	r.log.Debug().Msg("calling `Run` method")
+	cmd := &exec.Cmd{
+		Path:   r.executable,
+		Args:   r.args(spec),
+		Stdout: spec.Stdout,
+		Stderr: spec.Stderr,
+	}
+	r.log.Info().Msg(cmd.String())
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		r.log.Warn().Err(ctx.Err()).Str("name", spec.Name).Msg("stopping container")
+		r.stop(spec.Name)
+	}
+
+	// the CLI exits as soon as the container is gone, it is killed if it hangs anyway
+	select {
+	case <-done:
+	case <-time.After(stopGrace):
+		_ = cmd.Process.Kill()
+		<-done
+	}
+	return ctx.Err()
+}
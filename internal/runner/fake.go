@@ -0,0 +1,65 @@
+// Package runner provides container runtimes executing the pipeline image.
+
+package runner
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// FakeRunner records runs without executing anything and writes a canned output, it is meant for tests and local
+// runs of the service logic.
+type FakeRunner struct {
+	mu     sync.Mutex
+	log    *zerolog.Logger
+	runs   []Spec
+	Output func(spec *Spec) ([]byte, error)
+}
+
+// NewFakeRunner initializes a new FakeRunner instance reporting every validated file as passed.
+func NewFakeRunner(logger *zerolog.Logger) *FakeRunner {
+	return &FakeRunner{
+		log: logger,
+		Output: func(spec *Spec) ([]byte, error) {
+			for _, arg := range spec.Args {
+				if arg == "validate" {
+					return []byte(`{"mode":"fake","sex":"NA","error":"","passed":true}`), nil
+				}
+			}
+			return nil, nil
+		},
+	}
+}
+
+// Run records a run writing the canned output.
+func (r *FakeRunner) Run(ctx context.Context, spec *Spec) error {
+	r.log.Debug().Msg("calling `Run` method")
+	r.mu.Lock()
+	r.runs = append(r.runs, *spec)
+	r.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	output, err := r.Output(spec)
+	if err != nil {
+		return err
+	}
+	if spec.Stdout != nil && len(output) > 0 {
+		if _, err = spec.Stdout.Write(output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Runs retrieves all recorded runs.
+func (r *FakeRunner) Runs() []Spec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runs := make([]Spec, len(r.runs))
+	copy(runs, r.runs)
+	return runs
+}
@@ -0,0 +1,98 @@
+// Package runner provides container runtimes executing the pipeline image.
+
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// LocalRunner runs the pipeline as a plain local process without a container runtime. The image is ignored, the
+// arguments are passed to the executable started in the pipeline source directory.
+type LocalRunner struct {
+	log         *zerolog.Logger
+	executable  string
+	dir         string
+	stopTimeout time.Duration
+}
+
+// NewLocalRunner initializes a new LocalRunner instance.
+func NewLocalRunner(logger *zerolog.Logger, executable, dir string, stopTimeout time.Duration) *LocalRunner {
+	return &LocalRunner{
+		log:         logger,
+		executable:  executable,
+		dir:         dir,
+		stopTimeout: stopTimeout,
+	}
+}
+
+// mountEnv returns an environment variable exposing a mount, e.g. `MOUNT_MNT=/srv/data` for a mount targeting `/mnt`.
+func (r *LocalRunner) mountEnv(mount Mount) string {
+	name := strings.ToUpper(strings.Trim(strings.ReplaceAll(mount.Target, "/", "_"), "_"))
+	return fmt.Sprintf("MOUNT_%s=%s", name, mount.Source)
+}
+
+// hostPath replaces a container path prefix in an argument with the directory mounted there.
+func (r *LocalRunner) hostPath(arg string, mounts []Mount) string {
+	for _, mount := range mounts {
+		if arg == mount.Target || strings.HasPrefix(arg, strings.TrimSuffix(mount.Target, "/")+"/") {
+			return mount.Source + strings.TrimPrefix(arg, mount.Target)
+		}
+	}
+	return arg
+}
+
+// Run runs the pipeline process and waits for it to exit, the process is terminated if the context is done first.
+func (r *LocalRunner) Run(ctx context.Context, spec *Spec) error {
+	r.log.Debug().Msg("calling `Run` method")
+	args := []string{r.executable}
+	for _, arg := range spec.Args {
+		args = append(args, r.hostPath(arg, spec.Mounts))
+	}
+	env := os.Environ()
+	for _, mount := range spec.Mounts {
+		env = append(env, r.mountEnv(mount))
+	}
+
+	cmd := &exec.Cmd{
+		Path:   r.executable,
+		Args:   args,
+		Dir:    r.dir,
+		Env:    env,
+		Stdout: spec.Stdout,
+		Stderr: spec.Stderr,
+	}
+	r.log.Info().Msg(cmd.String())
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		r.log.Warn().Err(ctx.Err()).Str("name", spec.Name).Msg("terminating process")
+		_ = cmd.Process.Signal(syscall.SIGTERM)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(r.stopTimeout):
+		r.log.Warn().Str("name", spec.Name).Msg("killing process")
+		_ = cmd.Process.Kill()
+		<-done
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,68 @@
+// Package runner provides container runtimes executing the pipeline image.
+
+package runner
+
+import (
+	"context"
+	"io"
+	"time"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/runner/errors"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	RuntimeDockerCLI    = "docker-cli"
+	RuntimePodman       = "podman"
+	RuntimeDockerEngine = "docker-engine"
+	RuntimeLocal        = "local"
+	RuntimeFake         = "fake"
+
+	// stopGrace limits the time the runtime itself takes to react once a run is stopped.
+	stopGrace = 5 * time.Second
+)
+
+// Mount defines a host directory mounted into a container.
+type Mount struct {
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+// Spec defines one run of the pipeline image, the name identifies the container when the run has to be stopped.
+// CPUs and memory limit the container if they are set.
+type Spec struct {
+	Name     string
+	Image    string
+	Mounts   []Mount
+	Args     []string
+	Stdout   io.Writer
+	Stderr   io.Writer
+	CPUs     int
+	MemoryMB int
+}
+
+// Runner defines methods for running the pipeline image to completion. Once the context is done the run is stopped
+// and the context error is returned.
+type Runner interface {
+	Run(ctx context.Context, spec *Spec) error
+}
+
+// NewRunner initializes a runner implementation selected by configuration.
+func NewRunner(cfg *config.Config, logger *zerolog.Logger) Runner {
+	logger.Debug().Msg("calling initializer of container runner")
+	switch cfg.Docker.Runtime {
+	case RuntimeDockerCLI, RuntimePodman:
+		return NewExecRunner(logger, cfg.Docker.DockerExecutable, cfg.Docker.StopTimeout)
+	case RuntimeDockerEngine:
+		return NewEngineRunner(logger, cfg.Docker.EngineSocket, cfg.Docker.StopTimeout)
+	case RuntimeLocal:
+		return NewLocalRunner(logger, cfg.Docker.LocalExecutable, cfg.Docker.LocalDir, cfg.Docker.StopTimeout)
+	case RuntimeFake:
+		return NewFakeRunner(logger)
+	default:
+		logger.Fatal().Str("runtime", cfg.Docker.Runtime).Msg(errors.InvalidRuntimeError)
+		return nil
+	}
+}
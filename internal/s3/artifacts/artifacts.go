@@ -0,0 +1,306 @@
+// Package artifacts provides the manifest of processing results uploaded to S3.
+
+package artifacts
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/s3/errors"
+
+	"github.com/rs/zerolog"
+)
+
+// Artifact defines an entry of the manifest. Glob is a slash-separated pattern relative to the job workspace, Key is
+// the key of the uploaded object, both are templates executed with Data.
+type Artifact struct {
+	Glob        string `json:"glob"`
+	Key         string `json:"key"`
+	ContentType string `json:"content_type"`
+	Required    bool   `json:"required"`
+}
+
+// Data defines values available in templates of an artifact, Name is the base name of a matched file and is set for
+// key templates only.
+type Data struct {
+	Barcode     string
+	UserID      string
+	ProductCode string
+	Date        string
+	Time        time.Time
+	Name        string
+}
+
+// NewData initializes a new Data instance of a processing job finished at the given time.
+func NewData(barcode, userID, productCode string, now time.Time) Data {
+	now = now.UTC()
+	return Data{
+		Barcode:     barcode,
+		UserID:      userID,
+		ProductCode: productCode,
+		Date:        now.Format("2006-01-02"),
+		Time:        now,
+	}
+}
+
+// File defines a local file of an artifact and the object it is uploaded to.
+type File struct {
+	Path        string
+	Key         string
+	ContentType string
+}
+
+// entry defines an artifact with its parsed templates and the pattern of keys produced by the key template.
+type entry struct {
+	Artifact
+	glob    *template.Template
+	key     *template.Template
+	pattern *regexp.Regexp
+}
+
+// Manifest defines artifacts uploaded after processing.
+type Manifest struct {
+	log     *zerolog.Logger
+	entries []entry
+}
+
+// defaults returns the manifest used if no manifest file is configured, it keeps results in the configured folders.
+func defaults(cfg *config.Config) []Artifact {
+	return []Artifact{
+		{Glob: "raw_data/atlas_raw_data/{{.Barcode}}.txt", Key: cfg.S3Storage.FolderInternal + "/{{.Barcode}}.txt",
+			ContentType: "text/plain", Required: true},
+		{Glob: "raw_data/external_raw_data/{{.Barcode}}.txt", Key: cfg.S3Storage.FolderExternal + "/{{.Barcode}}.txt",
+			ContentType: "text/plain", Required: true},
+		{Glob: "raw_data/binary/{{.Barcode}}.bed", Key: cfg.S3Storage.FolderBinary + "/{{.Barcode}}.bed",
+			ContentType: "application/octet-stream", Required: true},
+		{Glob: "raw_data/binary/{{.Barcode}}.bim", Key: cfg.S3Storage.FolderBinary + "/{{.Barcode}}.bim",
+			ContentType: "text/plain", Required: true},
+		{Glob: "raw_data/binary/{{.Barcode}}.fam", Key: cfg.S3Storage.FolderBinary + "/{{.Barcode}}.fam",
+			ContentType: "text/plain", Required: true},
+	}
+}
+
+// NewManifest initializes a new Manifest instance reading the manifest file if it is configured, templates are parsed
+// at once, so that an invalid manifest is reported on start.
+func NewManifest(cfg *config.Config, logger *zerolog.Logger) (*Manifest, error) {
+	logger.Debug().Msg("calling initializer of artifact manifest")
+	list := defaults(cfg)
+	if file := cfg.S3Storage.ArtifactManifest; file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			logger.Error().Err(err).Str("file", file).Msg(errors.ManifestReadingError)
+			return nil, err
+		}
+		list = nil
+		if err = json.Unmarshal(data, &list); err != nil {
+			logger.Error().Err(err).Str("file", file).Msg(errors.ManifestReadingError)
+			return nil, err
+		}
+	}
+
+	m := &Manifest{log: logger}
+	for i, artifact := range list {
+		glob, err := template.New("glob").Option("missingkey=error").Parse(artifact.Glob)
+		if err == nil && (artifact.Glob == "" || path.IsAbs(artifact.Glob) || strings.Contains(artifact.Glob, "..")) {
+			err = &errors.InvalidArtifactError{Index: i, Reason: "glob must be a relative path inside the workspace"}
+		}
+		if err != nil {
+			logger.Error().Err(err).Int("artifact", i).Msg(errors.ManifestReadingError)
+			return nil, err
+		}
+		key, err := template.New("key").Option("missingkey=error").Parse(artifact.Key)
+		if err == nil && artifact.Key == "" {
+			err = &errors.InvalidArtifactError{Index: i, Reason: "key is empty"}
+		}
+		if err != nil {
+			logger.Error().Err(err).Int("artifact", i).Msg(errors.ManifestReadingError)
+			return nil, err
+		}
+		// templates referring to unknown fields fail only once executed
+		if _, err = execute(glob, Data{}); err == nil {
+			_, err = execute(key, Data{})
+		}
+		if err != nil {
+			logger.Error().Err(err).Int("artifact", i).Msg(errors.ManifestReadingError)
+			return nil, err
+		}
+		pattern, _ := keyPattern(key, nil)
+		m.entries = append(m.entries, entry{Artifact: artifact, glob: glob, key: key, pattern: pattern})
+	}
+	return m, nil
+}
+
+// keyPattern returns the pattern of keys a key template produces and whether it tells keys of users apart. The text
+// of the template is matched literally, actions printing a field with a value are matched literally as well and other
+// actions match any text.
+func keyPattern(t *template.Template, values map[string]string) (*regexp.Regexp, bool) {
+	var b strings.Builder
+	identified := false
+	b.WriteString("^")
+	for i, node := range t.Tree.Root.Nodes {
+		if text, ok := node.(*parse.TextNode); ok {
+			literal := string(text.Text)
+			// keys are uploaded without the leading slash
+			if i == 0 {
+				literal = strings.TrimLeft(literal, "/")
+			}
+			b.WriteString(regexp.QuoteMeta(literal))
+			continue
+		}
+		field := fieldOf(node)
+		if value := values[field]; value != "" {
+			b.WriteString(regexp.QuoteMeta(value))
+			identified = identified || field == "Barcode" || field == "UserID"
+			continue
+		}
+		b.WriteString(".*")
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String()), identified
+}
+
+// fieldOf returns the name of the field printed by an action, it is empty for other nodes.
+func fieldOf(node parse.Node) string {
+	action, ok := node.(*parse.ActionNode)
+	if !ok || len(action.Pipe.Decl) > 0 || len(action.Pipe.Cmds) != 1 || len(action.Pipe.Cmds[0].Args) != 1 {
+		return ""
+	}
+	field, ok := action.Pipe.Cmds[0].Args[0].(*parse.FieldNode)
+	if !ok || len(field.Ident) != 1 {
+		return ""
+	}
+	return field.Ident[0]
+}
+
+// execute executes a template.
+func execute(t *template.Template, data Data) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Resolve returns files of a job workspace to be uploaded sorted by key. Resolving fails if a required artifact has no
+// files or if different files get the same key.
+func (m *Manifest) Resolve(dir string, data Data) ([]File, error) {
+	m.log.Debug().Msg("calling `Resolve` method")
+	var files []File
+	paths := make(map[string]string)
+	for _, e := range m.entries {
+		pattern, err := execute(e.glob, data)
+		if err != nil {
+			return nil, err
+		}
+		matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			if e.Required {
+				return nil, &errors.ArtifactMissingError{Glob: pattern}
+			}
+			m.log.Info().Str("glob", pattern).Msg("optional artifact is missing")
+			continue
+		}
+		for _, match := range matches {
+			if info, err := os.Stat(match); err != nil || info.IsDir() {
+				continue
+			}
+			keyData := data
+			keyData.Name = filepath.Base(match)
+			key, err := execute(e.key, keyData)
+			if err != nil {
+				return nil, err
+			}
+			key = strings.TrimPrefix(path.Clean("/"+key), "/")
+			if other, ok := paths[key]; ok && other != match {
+				return nil, &errors.ArtifactKeyConflictError{Key: key, Paths: []string{other, match}}
+			}
+			if _, ok := paths[key]; ok {
+				continue
+			}
+			paths[key] = match
+			files = append(files, File{Path: match, Key: key, ContentType: e.ContentType})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Key < files[j].Key
+	})
+	return files, nil
+}
+
+// Prefixes returns the folders of the bucket results are uploaded to, i.e. the fixed parts of key templates up to the
+// last slash before the first action. Folders inside other folders are left out, an empty prefix stands for the whole
+// bucket.
+func (m *Manifest) Prefixes() []string {
+	m.log.Debug().Msg("calling `Prefixes` method")
+	var prefixes []string
+	for _, e := range m.entries {
+		prefix := e.Key
+		if i := strings.Index(prefix, "{{"); i >= 0 {
+			prefix = prefix[:i]
+		}
+		prefix = strings.TrimPrefix(prefix[:strings.LastIndex(prefix, "/")+1], "/")
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	// a prefix sorts right after the prefixes it is covered by
+	var folders []string
+	for _, prefix := range prefixes {
+		if len(folders) > 0 && strings.HasPrefix(prefix, folders[len(folders)-1]) {
+			continue
+		}
+		folders = append(folders, prefix)
+	}
+	return folders
+}
+
+// Matches reports whether a key may have been produced by one of the key templates.
+func (m *Manifest) Matches(key string) bool {
+	for _, e := range m.entries {
+		if e.pattern.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyMatcher returns a function reporting whether a key may have been produced by one of the key templates for the
+// barcode, the user ID and the product code of data, other fields match any text. Keys produced by a template that
+// prints neither the barcode nor the user ID cannot be told apart between users, so such a manifest is reported with
+// InvalidArtifactError.
+func (m *Manifest) KeyMatcher(data Data) (func(key string) bool, error) {
+	m.log.Debug().Msg("calling `KeyMatcher` method")
+	values := map[string]string{
+		"Barcode":     data.Barcode,
+		"UserID":      data.UserID,
+		"ProductCode": data.ProductCode,
+	}
+	patterns := make([]*regexp.Regexp, 0, len(m.entries))
+	for i, e := range m.entries {
+		pattern, identified := keyPattern(e.key, values)
+		if !identified {
+			return nil, &errors.InvalidArtifactError{Index: i, Reason: "key prints neither the barcode nor the user ID"}
+		}
+		patterns = append(patterns, pattern)
+	}
+	return func(key string) bool {
+		for _, pattern := range patterns {
+			if pattern.MatchString(key) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
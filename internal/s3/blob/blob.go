@@ -0,0 +1,42 @@
+// Package blob provides a blob store interface and selects its implementation.
+
+package blob
+
+import (
+	"context"
+	"io"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/s3/v1/local"
+	"upload-service-auto/internal/s3/v1/models"
+	"upload-service-auto/internal/s3/v1/s3"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	BackendS3    = "s3"
+	BackendLocal = "local"
+)
+
+// Store defines methods for reading and writing objects of one bucket. Missing objects are reported with
+// ObjectNotFoundError.
+type Store interface {
+	Get(ctx context.Context, key string) (io.ReadCloser, *models.Object, error)
+	Put(ctx context.Context, object *models.Object, body io.Reader) error
+	Head(ctx context.Context, key string) (*models.Object, error)
+	List(ctx context.Context, prefix string) ([]models.Object, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// NewStore initializes a store of a bucket selected by configuration, the credentials are used by the S3 backend only.
+func NewStore(cfg *config.Config, logger *zerolog.Logger, bucket, accessKeyID, secretAccessKey string) Store {
+	switch cfg.S3Storage.Backend {
+	case BackendLocal:
+		return local.NewStore(cfg.S3Storage.LocalDir, bucket, logger)
+	case BackendS3:
+		return s3.NewStore(cfg, logger, bucket, accessKeyID, secretAccessKey)
+	default:
+		logger.Fatal().Str("backend", cfg.S3Storage.Backend).Msg("invalid blob store backend")
+		return nil
+	}
+}
@@ -2,9 +2,70 @@
 
 package errors
 
+import (
+	"fmt"
+	"strings"
+)
+
 const (
-	FileOpeningError  = "failed to open file"
-	FileUploadError   = "failed to upload file"
-	FileDownloadError = "failed to download file"
-	FileSavingError   = "failed to save file locally"
+	FileOpeningError     = "failed to open file"
+	FileUploadError      = "failed to upload file"
+	FileDownloadError    = "failed to download file"
+	FileSavingError      = "failed to save file locally"
+	FileHashingError     = "failed to compute file checksums"
+	ObjectDeletionError  = "failed to delete object"
+	ObjectListingError   = "failed to list objects"
+	ManifestReadingError = "failed to read artifact manifest"
 )
+
+type (
+	ObjectNotFoundError struct {
+		Bucket string
+		Key    string
+	}
+	InvalidKeyError struct {
+		Key string
+	}
+	ChecksumMismatchError struct {
+		Bucket   string
+		Key      string
+		Checksum string
+		Expected string
+		Actual   string
+	}
+	InvalidArtifactError struct {
+		Index  int
+		Reason string
+	}
+	ArtifactMissingError struct {
+		Glob string
+	}
+	ArtifactKeyConflictError struct {
+		Key   string
+		Paths []string
+	}
+)
+
+func (e *ObjectNotFoundError) Error() string {
+	return fmt.Sprintf("%s/%s: object not found", e.Bucket, e.Key)
+}
+
+func (e *InvalidKeyError) Error() string {
+	return fmt.Sprintf("%s: invalid object key", e.Key)
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("%s/%s: %s mismatch: expected %s, got %s", e.Bucket, e.Key, e.Checksum, e.Expected, e.Actual)
+}
+
+func (e *InvalidArtifactError) Error() string {
+	return fmt.Sprintf("artifact %d: %s", e.Index, e.Reason)
+}
+
+func (e *ArtifactMissingError) Error() string {
+	return fmt.Sprintf("%s: required artifact is missing", e.Glob)
+}
+
+func (e *ArtifactKeyConflictError) Error() string {
+	return fmt.Sprintf("%s: object key is shared by %s", e.Key, strings.Join(e.Paths, ", "))
+}
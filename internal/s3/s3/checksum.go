@@ -0,0 +1,129 @@
+// Package s3 provides data operation service for S3 storage.
+
+package s3
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+	"upload-service-auto/internal/s3/errors"
+	"upload-service-auto/internal/s3/v1/models"
+)
+
+// Metadata keys of object checksums, the values are hex-encoded digests of the object body.
+const (
+	MetadataSHA256 = "sha256"
+	MetadataMD5    = "md5"
+)
+
+// digest defines a writer computing checksums and the size of the data written to it. With a part size set, the MD5
+// digests of parts are computed as well, so that the ETag of an object uploaded in parts can be checked.
+type digest struct {
+	sha256   hash.Hash
+	md5      hash.Hash
+	size     int64
+	partSize int64
+	part     hash.Hash
+	partLen  int64
+	parts    []byte
+}
+
+// newDigest initializes a new digest instance, a part size of 0 skips digests of parts.
+func newDigest(partSize int64) *digest {
+	return &digest{
+		sha256:   sha256.New(),
+		md5:      md5.New(),
+		partSize: partSize,
+		part:     md5.New(),
+	}
+}
+
+// Write adds data to the checksums.
+func (d *digest) Write(p []byte) (int, error) {
+	d.sha256.Write(p)
+	d.md5.Write(p)
+	d.size += int64(len(p))
+	for rest := p; d.partSize > 0 && len(rest) > 0; {
+		n := len(rest)
+		if left := d.partSize - d.partLen; int64(n) > left {
+			n = int(left)
+		}
+		d.part.Write(rest[:n])
+		d.partLen += int64(n)
+		rest = rest[n:]
+		if d.partLen == d.partSize {
+			d.parts = d.part.Sum(d.parts)
+			d.part.Reset()
+			d.partLen = 0
+		}
+	}
+	return len(p), nil
+}
+
+// multipartETag returns the ETag of the data uploaded in parts.
+func (d *digest) multipartETag() string {
+	parts := d.parts
+	if d.partLen > 0 {
+		parts = d.part.Sum(parts)
+	}
+	sum := md5.Sum(parts)
+	return hex.EncodeToString(sum[:]) + "-" + strconv.Itoa(len(parts)/md5.Size)
+}
+
+// metadata returns the checksums as object metadata.
+func (d *digest) metadata() map[string]string {
+	return map[string]string{
+		MetadataSHA256: hex.EncodeToString(d.sha256.Sum(nil)),
+		MetadataMD5:    hex.EncodeToString(d.md5.Sum(nil)),
+	}
+}
+
+// digestOf computes the checksums of a reader.
+func digestOf(r io.Reader, partSize int64) (*digest, error) {
+	d := newDigest(partSize)
+	if _, err := io.Copy(d, r); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// verify compares the checksums with the ones of an object. The size and the ETag are always compared, the ETag is the
+// MD5 digest unless the object was uploaded in parts, then it is compared only if the part size is known. Checksums
+// missing in the object metadata are skipped, so that objects put by other clients can still be read.
+func (d *digest) verify(bucket string, object *models.Object) error {
+	sums := d.metadata()
+	mismatch := func(checksum, expected, actual string) error {
+		return &errors.ChecksumMismatchError{
+			Bucket:   bucket,
+			Key:      object.Key,
+			Checksum: checksum,
+			Expected: expected,
+			Actual:   actual,
+		}
+	}
+
+	if object.Size != d.size {
+		return mismatch("size", strconv.FormatInt(object.Size, 10), strconv.FormatInt(d.size, 10))
+	}
+	for _, key := range []string{MetadataSHA256, MetadataMD5} {
+		if expected, ok := object.Metadata[key]; ok && !strings.EqualFold(expected, sums[key]) {
+			return mismatch(key, expected, sums[key])
+		}
+	}
+	switch {
+	case object.ETag == "":
+	case !strings.Contains(object.ETag, "-"):
+		if !strings.EqualFold(object.ETag, sums[MetadataMD5]) {
+			return mismatch("etag", object.ETag, sums[MetadataMD5])
+		}
+	case d.partSize > 0:
+		if expected := d.multipartETag(); !strings.EqualFold(object.ETag, expected) {
+			return mismatch("etag", object.ETag, expected)
+		}
+	}
+	return nil
+}
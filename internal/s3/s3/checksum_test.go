@@ -0,0 +1,156 @@
+package s3
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	goErrors "errors"
+	"strconv"
+	"testing"
+	"upload-service-auto/internal/s3/errors"
+	"upload-service-auto/internal/s3/v1/models"
+)
+
+// sample returns data of the given size which differs from part to part.
+func sample(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7 / 3)
+	}
+	return data
+}
+
+// expectedETag computes the ETag of data uploaded in parts of the given size the way S3 does.
+func expectedETag(data []byte, partSize int) string {
+	var sums []byte
+	for start := 0; start < len(data); start += partSize {
+		end := start + partSize
+		if end > len(data) {
+			end = len(data)
+		}
+		sum := md5.Sum(data[start:end])
+		sums = append(sums, sum[:]...)
+	}
+	sum := md5.Sum(sums)
+	return hex.EncodeToString(sum[:]) + "-" + strconv.Itoa(len(sums)/md5.Size)
+}
+
+func TestMultipartETag(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		size  int
+		parts int
+	}{
+		{name: "single part", size: 1024, parts: 1},
+		{name: "exact multiple of part size", size: 2 * models.PartSize, parts: 2},
+		{name: "trailing partial part", size: 2*models.PartSize + 1, parts: 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data := sample(tc.size)
+			expected := expectedETag(data, models.PartSize)
+			if suffix := "-" + strconv.Itoa(tc.parts); expected[len(expected)-len(suffix):] != suffix {
+				t.Fatalf("expected %d parts, got ETag %s", tc.parts, expected)
+			}
+
+			// writes of any size give the same digests as the parts are split on their boundaries
+			for _, chunk := range []int{tc.size, models.PartSize, models.PartSize - 1, 1_000_003} {
+				d := newDigest(models.PartSize)
+				for start := 0; start < len(data); start += chunk {
+					end := start + chunk
+					if end > len(data) {
+						end = len(data)
+					}
+					if _, err := d.Write(data[start:end]); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if etag := d.multipartETag(); etag != expected {
+					t.Errorf("writes of %d bytes: expected %s, got %s", chunk, expected, etag)
+				}
+				if d.size != int64(tc.size) {
+					t.Errorf("writes of %d bytes: expected size %d, got %d", chunk, tc.size, d.size)
+				}
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	data := sample(3*models.PartSize + 10)
+	sha := sha256.Sum256(data)
+	md := md5.Sum(data)
+	shaHex, mdHex := hex.EncodeToString(sha[:]), hex.EncodeToString(md[:])
+
+	for _, tc := range []struct {
+		name     string
+		partSize int64
+		object   models.Object
+		checksum string
+	}{
+		{
+			name:   "matching object",
+			object: models.Object{Size: int64(len(data)), ETag: mdHex, Metadata: map[string]string{MetadataSHA256: shaHex}},
+		},
+		{
+			name:   "object without checksums",
+			object: models.Object{Size: int64(len(data))},
+		},
+		{
+			name:     "size mismatch",
+			object:   models.Object{Size: int64(len(data)) - 1, ETag: mdHex},
+			checksum: "size",
+		},
+		{
+			name:     "sha256 mismatch",
+			object:   models.Object{Size: int64(len(data)), ETag: mdHex, Metadata: map[string]string{MetadataSHA256: mdHex}},
+			checksum: MetadataSHA256,
+		},
+		{
+			name:     "md5 mismatch",
+			object:   models.Object{Size: int64(len(data)), Metadata: map[string]string{MetadataMD5: shaHex}},
+			checksum: MetadataMD5,
+		},
+		{
+			name:     "etag mismatch",
+			object:   models.Object{Size: int64(len(data)), ETag: shaHex},
+			checksum: "etag",
+		},
+		{
+			name:     "matching multipart etag",
+			partSize: models.PartSize,
+			object:   models.Object{Size: int64(len(data)), ETag: expectedETag(data, models.PartSize)},
+		},
+		{
+			name:     "multipart etag of other part size",
+			partSize: models.PartSize,
+			object:   models.Object{Size: int64(len(data)), ETag: expectedETag(data, models.PartSize/2)},
+			checksum: "etag",
+		},
+		{
+			name:   "multipart etag of unknown part size",
+			object: models.Object{Size: int64(len(data)), ETag: expectedETag(data, models.PartSize/2)},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := newDigest(tc.partSize)
+			if _, err := d.Write(data); err != nil {
+				t.Fatal(err)
+			}
+			tc.object.Key = "key"
+			err := d.verify("bucket", &tc.object)
+			if tc.checksum == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			var mismatch *errors.ChecksumMismatchError
+			if !goErrors.As(err, &mismatch) {
+				t.Fatalf("expected ChecksumMismatchError, got %v", err)
+			}
+			if mismatch.Checksum != tc.checksum || mismatch.Bucket != "bucket" || mismatch.Key != "key" {
+				t.Errorf("expected a %s mismatch of bucket/key, got %+v", tc.checksum, mismatch)
+			}
+		})
+	}
+}
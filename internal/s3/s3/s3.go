@@ -8,127 +8,146 @@ import (
 	"os"
 	"path"
 	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/s3/blob"
 	"upload-service-auto/internal/s3/errors"
+	"upload-service-auto/internal/s3/v1/models"
 	"upload-service-auto/internal/syncutils"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/rs/zerolog"
 )
 
 // Service defines a new S3 service and sets its attributes.
 type Service struct {
-	s3up      *s3manager.Uploader
-	s3down    *s3.S3
+	internal  blob.Store
+	upload    blob.Store
 	cfg       *config.Config
 	log       *zerolog.Logger
 	syncUtils *syncutils.SyncUtils
 }
 
-// NewService initializes a new S3 service.
+// NewService initializes a new S3 service. Results are uploaded to the internal bucket, source files are downloaded
+// from the upload bucket, each of them is accessed with its own credentials.
 func NewService(config *config.Config, logger *zerolog.Logger, syncUtils *syncutils.SyncUtils) (*Service, error) {
 	logger.Debug().Msg("calling initializer of S3 service")
-	sessUp := session.Must(session.NewSession(&aws.Config{
-		Credentials: credentials.NewStaticCredentials(
-			config.S3Storage.AccessKeyID,
-			config.S3Storage.SecretAccessKey,
-			"",
-		),
-		Region:   &config.S3Storage.Region,
-		Endpoint: &config.S3Storage.Endpoint,
-	}))
-	uploader := s3manager.NewUploader(sessUp)
-
-	sessDown := session.Must(session.NewSession(&aws.Config{
-		Credentials: credentials.NewStaticCredentials(
-			config.S3Storage.AccessKeyIDUpload,
-			config.S3Storage.SecretAccessKeyUpload,
-			"",
-		),
-		Region:   &config.S3Storage.Region,
-		Endpoint: &config.S3Storage.Endpoint,
-	}))
-	downloader := s3.New(sessDown)
-
 	return &Service{
-		s3down:    downloader,
-		s3up:      uploader,
+		internal: blob.NewStore(config, logger, config.S3Storage.Bucket,
+			config.S3Storage.AccessKeyID, config.S3Storage.SecretAccessKey),
+		upload: blob.NewStore(config, logger, config.S3Storage.BucketUpload,
+			config.S3Storage.AccessKeyIDUpload, config.S3Storage.SecretAccessKeyUpload),
 		cfg:       config,
 		log:       logger,
 		syncUtils: syncUtils,
 	}, nil
 }
 
-// UploadFile performs data upload to S3.
-func (s *Service) UploadFile(filePath, fileType, fileEndName string) error {
+// UploadFile performs data upload of a local file to S3 and returns the uploaded object.
+func (s *Service) UploadFile(filePath, key, contentType string) (*models.Object, error) {
 	s.log.Debug().Msg("calling `UploadFile` method")
-	s.log.Info().Msg(fmt.Sprintf("uploading file %s of type %s to %s", filePath, fileType, fileEndName))
+	s.log.Info().Msg(fmt.Sprintf("uploading file %s to %s", filePath, key))
 	f, err := os.Open(filePath)
 	if err != nil {
 		s.log.Error().Err(err).Msg(errors.FileOpeningError)
-		return err
+		return nil, err
 	}
 	defer f.Close()
 
-	result, err := s.s3up.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(s.cfg.S3Storage.Bucket),
-		Key:    aws.String(s.path(fileType, fileEndName)),
-		Body:   f,
-	})
+	// checksums are sent as metadata before the body, so the file is read twice
+	sums, err := digestOf(f, models.PartSize)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		s.log.Error().Err(err).Msg(errors.FileHashingError)
+		return nil, err
+	}
+
+	object := &models.Object{Key: key, ContentType: contentType, Metadata: sums.metadata()}
+	if err = s.internal.Put(s.syncUtils.Ctx, object, f); err != nil {
+		s.log.Error().Err(err).Msg(errors.FileUploadError)
+		return nil, err
+	}
+	// the stored object is compared with the file, so that a truncated or corrupted object is not left in the bucket
+	stored, err := s.internal.Head(s.syncUtils.Ctx, object.Key)
+	if err == nil {
+		err = sums.verify(s.cfg.S3Storage.Bucket, stored)
+	}
 	if err != nil {
 		s.log.Error().Err(err).Msg(errors.FileUploadError)
+		if err := s.internal.Delete(s.syncUtils.Ctx, object.Key); err != nil {
+			s.log.Error().Err(err).Str("key", object.Key).Msg(errors.ObjectDeletionError)
+		}
+		return nil, err
+	}
+	s.log.Info().Str("bucket", s.cfg.S3Storage.Bucket).Str("key", object.Key).Int64("size", object.Size).
+		Msg("file uploaded")
+	return object, nil
+}
+
+// SourceKey returns the key of a source file in the upload bucket.
+func (s *Service) SourceKey(fileName string) string {
+	return path.Join(s.cfg.S3Storage.FolderUpload, fileName)
+}
+
+// DeleteSource removes a source file from the upload bucket, removing a missing file is not an error.
+func (s *Service) DeleteSource(fileName string) error {
+	s.log.Debug().Msg("calling `DeleteSource` method")
+	if err := s.upload.Delete(s.syncUtils.Ctx, s.SourceKey(fileName)); err != nil {
+		s.log.Error().Err(err).Str("fileName", fileName).Msg(errors.ObjectDeletionError)
 		return err
 	}
-	s.log.Info().Msg(fmt.Sprintf("file uploaded to, %s\\n", result.Location))
 	return nil
 }
 
-// path derives correct in-bucket path for a file given its type.
-func (s *Service) path(fileType, fileEndName string) string {
-	s.log.Debug().Msg("calling `path` method")
-	switch fileType {
-	case "internal_raw_data":
-		return s.cfg.S3Storage.FolderInternal + "/" + fileEndName
-	case "external_raw_data":
-		return s.cfg.S3Storage.FolderExternal + "/" + fileEndName
-	case "binary_raw_data":
-		return s.cfg.S3Storage.FolderBinary + "/" + fileEndName
-	default:
-		s.log.Warn().Msg(fmt.Sprintf("invalid file type for upload: %s", fileType))
-		return "temp/" + fileEndName
+// DeleteResult removes an object from the internal bucket, removing a missing object is not an error.
+func (s *Service) DeleteResult(key string) error {
+	s.log.Debug().Msg("calling `DeleteResult` method")
+	if err := s.internal.Delete(s.syncUtils.Ctx, key); err != nil {
+		s.log.Error().Err(err).Str("key", key).Msg(errors.ObjectDeletionError)
+		return err
 	}
+	return nil
 }
 
-// DownloadFile performs data download from S3.
-func (s *Service) DownloadFile(fileName string) error {
+// ListResults returns objects of the internal bucket whose keys start with a prefix.
+func (s *Service) ListResults(prefix string) ([]models.Object, error) {
+	s.log.Debug().Msg("calling `ListResults` method")
+	objects, err := s.internal.List(s.syncUtils.Ctx, prefix)
+	if err != nil {
+		s.log.Error().Err(err).Str("prefix", prefix).Msg(errors.ObjectListingError)
+		return nil, err
+	}
+	return objects, nil
+}
+
+// DownloadFile performs data download from S3 into a local file verifying its checksums, the local file is removed if
+// they do not match.
+func (s *Service) DownloadFile(fileName, localPath string) error {
 	s.log.Debug().Msg("calling `DownloadFile` method")
-	res, err := s.s3down.GetObjectWithContext(s.syncUtils.Ctx, &s3.GetObjectInput{
-		Bucket: aws.String(s.cfg.S3Storage.BucketUpload),
-		Key:    aws.String(path.Join(s.cfg.S3Storage.FolderUpload, fileName)),
-	})
+	body, object, err := s.upload.Get(s.syncUtils.Ctx, s.SourceKey(fileName))
 	if err != nil {
 		s.log.Error().Err(err).Msg(errors.FileDownloadError)
 		return err
 	}
+	defer body.Close()
 
-	localFile, err := os.Create(s.cfg.Docker.MountDir + "/source/" + fileName)
+	localFile, err := os.Create(localPath)
 	if err != nil {
 		s.log.Error().Err(err).Msg(errors.FileOpeningError)
 		return err
 	}
-	defer func(localFile *os.File) {
-		err := localFile.Close()
-		if err != nil {
-			panic(err)
-		}
-	}(localFile)
-	_, err = io.Copy(localFile, res.Body)
+	sums := newDigest(0)
+	_, err = io.Copy(io.MultiWriter(localFile, sums), body)
+	if closeErr := localFile.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
 		s.log.Error().Err(err).Msg(errors.FileSavingError)
 		return err
 	}
+	if err = sums.verify(s.cfg.S3Storage.BucketUpload, object); err != nil {
+		s.log.Error().Err(err).Msg(errors.FileDownloadError)
+		_ = os.Remove(localPath)
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,158 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	goErrors "errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/s3/blob"
+	"upload-service-auto/internal/s3/errors"
+	"upload-service-auto/internal/s3/v1/models"
+	"upload-service-auto/internal/syncutils"
+
+	"github.com/rs/zerolog"
+)
+
+// truncatingStore defines a store losing the last byte of every object put into it.
+type truncatingStore struct {
+	blob.Store
+}
+
+// Put writes an object without its last byte.
+func (s *truncatingStore) Put(ctx context.Context, object *models.Object, body io.Reader) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		data = data[:len(data)-1]
+	}
+	return s.Store.Put(ctx, object, bytes.NewReader(data))
+}
+
+// newTestService initializes a new Service over the local blob store.
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	logger := zerolog.Nop()
+	cfg := &config.Config{}
+	cfg.S3Storage.Backend = blob.BackendLocal
+	cfg.S3Storage.LocalDir = t.TempDir()
+	cfg.S3Storage.Bucket = "results"
+	cfg.S3Storage.BucketUpload = "uploads"
+	cfg.S3Storage.FolderUpload = "upload"
+	service, err := NewService(cfg, &logger, syncutils.NewSyncUtils())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+// localFile writes data to a new local file.
+func localFile(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUploadFile(t *testing.T) {
+	s := newTestService(t)
+	data := sample(1024)
+
+	object, err := s.UploadFile(localFile(t, data), "internal/B1.txt", "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := s.internal.Head(context.Background(), "internal/B1.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Size != int64(len(data)) || object.Size != stored.Size || object.ETag != stored.ETag {
+		t.Errorf("returned object %+v does not match the stored one %+v", object, stored)
+	}
+	sums, err := digestOf(bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, expected := range sums.metadata() {
+		if stored.Metadata[key] != expected {
+			t.Errorf("expected %s %s to be stored, got %s", key, expected, stored.Metadata[key])
+		}
+	}
+}
+
+func TestUploadFileRemovesCorruptedObject(t *testing.T) {
+	s := newTestService(t)
+	s.internal = &truncatingStore{Store: s.internal}
+
+	_, err := s.UploadFile(localFile(t, sample(1024)), "internal/B1.txt", "text/plain")
+	var mismatch *errors.ChecksumMismatchError
+	if !goErrors.As(err, &mismatch) {
+		t.Fatalf("expected ChecksumMismatchError, got %v", err)
+	}
+	if mismatch.Checksum != "size" || mismatch.Key != "internal/B1.txt" {
+		t.Errorf("expected a size mismatch of internal/B1.txt, got %+v", mismatch)
+	}
+	var notFound *errors.ObjectNotFoundError
+	if _, err = s.internal.Head(context.Background(), "internal/B1.txt"); !goErrors.As(err, &notFound) {
+		t.Errorf("expected the corrupted object to be removed, got %v", err)
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	data := sample(1024)
+	sums, err := digestOf(bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted := sums.metadata()
+	corrupted[MetadataSHA256] = corrupted[MetadataMD5]
+
+	for _, tc := range []struct {
+		name     string
+		metadata map[string]string
+		checksum string
+	}{
+		{name: "source with checksums", metadata: sums.metadata()},
+		{name: "source put by another client"},
+		{name: "corrupted source", metadata: corrupted, checksum: MetadataSHA256},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestService(t)
+			object := &models.Object{Key: s.SourceKey("file.txt"), Metadata: tc.metadata}
+			if err := s.upload.Put(context.Background(), object, bytes.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+			localPath := filepath.Join(t.TempDir(), "file.txt")
+
+			err := s.DownloadFile("file.txt", localPath)
+			if tc.checksum == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				downloaded, err := os.ReadFile(localPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(downloaded, data) {
+					t.Error("downloaded file differs from the source")
+				}
+				return
+			}
+			var mismatch *errors.ChecksumMismatchError
+			if !goErrors.As(err, &mismatch) || mismatch.Checksum != tc.checksum {
+				t.Fatalf("expected a %s mismatch, got %v", tc.checksum, err)
+			}
+			if _, err = os.Stat(localPath); !goErrors.Is(err, fs.ErrNotExist) {
+				t.Errorf("expected the local file to be removed, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+// Package local provides blob store kept in a local directory for offline runs.
+
+package local
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	s3Errors "upload-service-auto/internal/s3/errors"
+	"upload-service-auto/internal/s3/v1/models"
+
+	"github.com/rs/zerolog"
+)
+
+// metaDir defines a directory of the root keeping object attributes, it is not a valid bucket name.
+const metaDir = ".meta"
+
+// attributes defines object attributes kept next to the object.
+type attributes struct {
+	ETag        string            `json:"etag"`
+	ContentType string            `json:"content_type,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// Store defines a blob store of a bucket kept in a directory and sets its attributes. Objects are kept in
+// <root>/<bucket>/<key> mirroring the bucket layout, their attributes in <root>/.meta/<bucket>/<key>.json.
+type Store struct {
+	root   string
+	bucket string
+	log    *zerolog.Logger
+}
+
+// NewStore initializes a new Store instance of a bucket kept in the root directory.
+func NewStore(root, bucket string, logger *zerolog.Logger) *Store {
+	logger.Debug().Msg("calling initializer of local blob store")
+	return &Store{
+		root:   root,
+		bucket: bucket,
+		log:    logger,
+	}
+}
+
+// paths returns the paths of an object and its attributes, keys escaping the bucket directory are rejected.
+func (s *Store) paths(key string) (string, string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != key {
+		return "", "", &s3Errors.InvalidKeyError{Key: key}
+	}
+	name := filepath.FromSlash(cleaned)
+	return filepath.Join(s.root, s.bucket, name), filepath.Join(s.root, metaDir, s.bucket, name+".json"), nil
+}
+
+// attributes reads the attributes of an object, objects put into the directory by hand have none.
+func (s *Store) attributes(metaPath string) (*attributes, error) {
+	attrs := &attributes{}
+	data, err := os.ReadFile(metaPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return attrs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, attrs); err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
+
+// object returns an object of a file and its attributes.
+func (s *Store) object(key string, info fs.FileInfo, attrs *attributes) *models.Object {
+	metadata := make(map[string]string, len(attrs.Metadata))
+	for name, value := range attrs.Metadata {
+		metadata[strings.ToLower(name)] = value
+	}
+	return &models.Object{
+		Key:         key,
+		Size:        info.Size(),
+		ETag:        attrs.ETag,
+		ContentType: attrs.ContentType,
+		Metadata:    metadata,
+		ModifiedAt:  info.ModTime().UTC(),
+	}
+}
+
+// Get returns the body and attributes of an object, the caller has to close the body.
+func (s *Store) Get(_ context.Context, key string) (io.ReadCloser, *models.Object, error) {
+	s.log.Debug().Msg("calling `Get` method")
+	objectPath, metaPath, err := s.paths(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(objectPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, &s3Errors.ObjectNotFoundError{Bucket: s.bucket, Key: key}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err == nil && info.IsDir() {
+		err = &s3Errors.ObjectNotFoundError{Bucket: s.bucket, Key: key}
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	attrs, err := s.attributes(metaPath)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, s.object(key, info, attrs), nil
+}
+
+// Put writes an object setting its ETag and size, the ETag is the MD5 digest of the body as for S3 single-part
+// uploads. The object is written to a temporary file first, so that readers never see a partial object.
+func (s *Store) Put(ctx context.Context, object *models.Object, body io.Reader) error {
+	s.log.Debug().Msg("calling `Put` method")
+	objectPath, metaPath, err := s.paths(object.Key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(objectPath), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(objectPath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := md5.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+
+	attrs := attributes{
+		ETag:        hex.EncodeToString(hash.Sum(nil)),
+		ContentType: object.ContentType,
+		Metadata:    object.Metadata,
+	}
+	data, err := json.Marshal(attrs)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(metaPath), 0o755); err != nil {
+		return err
+	}
+	if err = os.WriteFile(metaPath, data, 0o644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), objectPath); err != nil {
+		return err
+	}
+	object.ETag = attrs.ETag
+	object.Size = size
+	return nil
+}
+
+// Head returns the attributes of an object.
+func (s *Store) Head(_ context.Context, key string) (*models.Object, error) {
+	s.log.Debug().Msg("calling `Head` method")
+	objectPath, metaPath, err := s.paths(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(objectPath)
+	if errors.Is(err, fs.ErrNotExist) || err == nil && info.IsDir() {
+		return nil, &s3Errors.ObjectNotFoundError{Bucket: s.bucket, Key: key}
+	}
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := s.attributes(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	return s.object(key, info, attrs), nil
+}
+
+// List returns the objects whose keys start with a prefix sorted by key, content types and metadata are not set as
+// for S3 listings.
+func (s *Store) List(ctx context.Context, prefix string) ([]models.Object, error) {
+	s.log.Debug().Msg("calling `List` method")
+	bucketDir := filepath.Join(s.root, s.bucket)
+	var objects []models.Object
+	err := filepath.WalkDir(bucketDir, func(name string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && name == bucketDir {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(bucketDir, name)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		_, metaPath, err := s.paths(key)
+		if err != nil {
+			return err
+		}
+		attrs, err := s.attributes(metaPath)
+		if err != nil {
+			return err
+		}
+		object := s.object(key, info, &attributes{ETag: attrs.ETag})
+		objects = append(objects, *object)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, nil
+}
+
+// Delete removes an object, removing a missing object is not an error.
+func (s *Store) Delete(_ context.Context, key string) error {
+	s.log.Debug().Msg("calling `Delete` method")
+	objectPath, metaPath, err := s.paths(key)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(objectPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err = os.Remove(metaPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+// Package models provides data types and models used in blob store packages.
+
+package models
+
+import "time"
+
+// PartSize defines the size of parts of multipart uploads. The ETag of an object uploaded in parts is the MD5 digest of
+// the digests of its parts followed by the number of parts, so it is known only along with the part size.
+const PartSize = 5 * 1024 * 1024
+
+// Object defines an object of a bucket. Key, ContentType and Metadata are set by the caller on upload, the rest is set
+// by the store. Metadata keys are lower-case.
+type Object struct {
+	Key         string
+	Size        int64
+	ETag        string
+	ContentType string
+	Metadata    map[string]string
+	ModifiedAt  time.Time
+}
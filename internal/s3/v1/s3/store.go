@@ -0,0 +1,185 @@
+// Package s3 provides blob store backed by an S3 bucket.
+
+package s3
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"upload-service-auto/internal/config"
+	s3Errors "upload-service-auto/internal/s3/errors"
+	"upload-service-auto/internal/s3/v1/models"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/rs/zerolog"
+)
+
+// Store defines a blob store of an S3 bucket and sets its attributes.
+type Store struct {
+	client   *s3.S3
+	uploader *s3manager.Uploader
+	bucket   string
+	log      *zerolog.Logger
+}
+
+// NewStore initializes a new Store instance accessing a bucket with the given credentials.
+func NewStore(cfg *config.Config, logger *zerolog.Logger, bucket, accessKeyID, secretAccessKey string) *Store {
+	logger.Debug().Msg("calling initializer of S3 blob store")
+	// every uploaded part carries the Content-MD5 header, so S3 rejects a part corrupted in transit
+	sess := session.Must(session.NewSession(&aws.Config{
+		Credentials:                   credentials.NewStaticCredentials(accessKeyID, secretAccessKey, ""),
+		Region:                        aws.String(cfg.S3Storage.Region),
+		Endpoint:                      aws.String(cfg.S3Storage.Endpoint),
+		S3DisableContentMD5Validation: aws.Bool(false),
+	}))
+	// the part size is fixed, so that ETags of objects uploaded in parts can be checked
+	uploader := s3manager.NewUploader(sess, func(u *s3manager.Uploader) {
+		u.PartSize = models.PartSize
+	})
+	return &Store{
+		client:   s3.New(sess),
+		uploader: uploader,
+		bucket:   bucket,
+		log:      logger,
+	}
+}
+
+// counter defines a reader counting the bytes read, the uploader does not report the size of a streamed body.
+type counter struct {
+	reader io.Reader
+	size   int64
+}
+
+// Read reads from the underlying reader.
+func (c *counter) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.size += int64(n)
+	return n, err
+}
+
+// notFound maps an error reporting a missing object to ObjectNotFoundError.
+func (s *Store) notFound(err error, key string) error {
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusNotFound {
+		return &s3Errors.ObjectNotFoundError{Bucket: s.bucket, Key: key}
+	}
+	if awsErr, ok := err.(awserr.Error); ok && (awsErr.Code() == s3.ErrCodeNoSuchKey || awsErr.Code() == "NotFound") {
+		return &s3Errors.ObjectNotFoundError{Bucket: s.bucket, Key: key}
+	}
+	return err
+}
+
+// metadata returns object metadata with lower-case keys, S3 returns them canonicalized.
+func metadata(meta map[string]*string) map[string]string {
+	normalized := make(map[string]string, len(meta))
+	for key, value := range meta {
+		normalized[strings.ToLower(key)] = aws.StringValue(value)
+	}
+	return normalized
+}
+
+// etag returns an ETag without quotes.
+func etag(value *string) string {
+	return strings.Trim(aws.StringValue(value), `"`)
+}
+
+// Get returns the body and attributes of an object, the caller has to close the body.
+func (s *Store) Get(ctx context.Context, key string) (io.ReadCloser, *models.Object, error) {
+	s.log.Debug().Msg("calling `Get` method")
+	res, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, nil, s.notFound(err, key)
+	}
+	return res.Body, &models.Object{
+		Key:         key,
+		Size:        aws.Int64Value(res.ContentLength),
+		ETag:        etag(res.ETag),
+		ContentType: aws.StringValue(res.ContentType),
+		Metadata:    metadata(res.Metadata),
+		ModifiedAt:  aws.TimeValue(res.LastModified),
+	}, nil
+}
+
+// Put uploads an object setting its ETag and size.
+func (s *Store) Put(ctx context.Context, object *models.Object, body io.Reader) error {
+	s.log.Debug().Msg("calling `Put` method")
+	counted := &counter{reader: body}
+	input := &s3manager.UploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(object.Key),
+		Body:     counted,
+		Metadata: aws.StringMap(object.Metadata),
+	}
+	if object.ContentType != "" {
+		input.ContentType = aws.String(object.ContentType)
+	}
+	res, err := s.uploader.UploadWithContext(ctx, input)
+	if err != nil {
+		return err
+	}
+	object.ETag = etag(res.ETag)
+	object.Size = counted.size
+	return nil
+}
+
+// Head returns the attributes of an object.
+func (s *Store) Head(ctx context.Context, key string) (*models.Object, error) {
+	s.log.Debug().Msg("calling `Head` method")
+	res, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s.notFound(err, key)
+	}
+	return &models.Object{
+		Key:         key,
+		Size:        aws.Int64Value(res.ContentLength),
+		ETag:        etag(res.ETag),
+		ContentType: aws.StringValue(res.ContentType),
+		Metadata:    metadata(res.Metadata),
+		ModifiedAt:  aws.TimeValue(res.LastModified),
+	}, nil
+}
+
+// List returns the objects whose keys start with a prefix sorted by key, content types and metadata are not set.
+func (s *Store) List(ctx context.Context, prefix string) ([]models.Object, error) {
+	s.log.Debug().Msg("calling `List` method")
+	var objects []models.Object
+	err := s.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, item := range page.Contents {
+			objects = append(objects, models.Object{
+				Key:        aws.StringValue(item.Key),
+				Size:       aws.Int64Value(item.Size),
+				ETag:       etag(item.ETag),
+				ModifiedAt: aws.TimeValue(item.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// Delete removes an object, removing a missing object is not an error.
+func (s *Store) Delete(ctx context.Context, key string) error {
+	s.log.Debug().Msg("calling `Delete` method")
+	_, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
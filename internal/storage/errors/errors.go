@@ -30,6 +30,17 @@ type (
 	ScanningPSQLError struct {
 		Err error
 	}
+	TransactionPSQLError struct {
+		Err error
+	}
+	MigrationError struct {
+		Err     error
+		Version int64
+	}
+	LockNotAcquiredError struct {
+		Err error
+		Key string
+	}
 )
 
 func (e *StatementPSQLError) Error() string {
@@ -59,3 +70,15 @@ func (e *NotFoundError) Error() string {
 func (e *ScanningPSQLError) Error() string {
 	return fmt.Sprintf("%s: could not scan rows", e.Err.Error())
 }
+
+func (e *TransactionPSQLError) Error() string {
+	return fmt.Sprintf("%s: could not complete transaction", e.Err.Error())
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("%s: could not migrate version %d", e.Err.Error(), e.Version)
+}
+
+func (e *LockNotAcquiredError) Error() string {
+	return fmt.Sprintf("%s: could not acquire lock %s", e.Err.Error(), e.Key)
+}
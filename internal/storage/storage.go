@@ -0,0 +1,76 @@
+// Package storage provides a storage interface and selects its implementation.
+
+package storage
+
+import (
+	"context"
+	"time"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/storage/v1/memory"
+	"upload-service-auto/internal/storage/v1/models"
+	"upload-service-auto/internal/storage/v1/psql"
+	"upload-service-auto/internal/syncutils"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	BackendPSQL   = "psql"
+	BackendMemory = "memory"
+)
+
+// Storage defines methods for persisting users, their uploads, validation and processing data.
+type Storage interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+	TryLock(ctx context.Context, key string) (func(), error)
+	SchemaVersion() (int64, error)
+	Migrate(to int64) error
+	Rollback(to int64) error
+	DropAll() error
+	RemoveUserData(ctx context.Context, userID string) error
+	GetAllUserIDs(ctx context.Context) ([]string, error)
+	AddNewUserID(ctx context.Context, userID string) error
+	CheckUserID(ctx context.Context, userID string) error
+	AddNewUserFilePair(ctx context.Context, userID, fileName string) error
+	GetFileNameForUser(ctx context.Context, userID string) (string, error)
+	GetUserUploads(ctx context.Context, userID string) ([]models.Upload, error)
+	AddNewValidationEntry(ctx context.Context, fileName string) error
+	UpdateValidationStatus(ctx context.Context, fileName, status string) error
+	UpdateValidationResult(ctx context.Context, validation *models.Validation) error
+	GetValidationResult(ctx context.Context, fileName string) (*models.Validation, error)
+	CheckIsValid(ctx context.Context, fileName string) error
+	AddNewProcessingEntry(ctx context.Context, fileName, barcode string) error
+	UpdateProcessingStatus(ctx context.Context, fileName, status string) error
+	GetProcessingStatus(ctx context.Context, fileName string) (string, error)
+	GetProcessingEntries(ctx context.Context) ([]models.Processing, error)
+	AddNewProductCode(ctx context.Context, userID, productCode string) error
+	UpdateProductCode(ctx context.Context, userID, productCode string) error
+	GetProductCode(ctx context.Context, userID string) (string, error)
+	Heartbeat(ctx context.Context, kind, fileName string) error
+	GetStaleJobs(ctx context.Context, kind string, before time.Time) ([]models.Job, error)
+	ExpireJob(ctx context.Context, kind, fileName, status string, before time.Time) (bool, error)
+	AddOutboxMessage(ctx context.Context, msg *models.OutboxMessage) error
+	GetOutboxMessages(ctx context.Context, limit int) ([]models.OutboxMessage, error)
+	DeleteOutboxMessage(ctx context.Context, id int64) error
+	RecordOutboxFailure(ctx context.Context, id int64, reason string) error
+	AddProcessedMessage(ctx context.Context, msg *models.ProcessedMessage) error
+	GetProcessedMessage(ctx context.Context, messageID string) (*models.ProcessedMessage, error)
+	AddArtifacts(ctx context.Context, artifacts []models.Artifact) error
+	GetArtifacts(ctx context.Context, userID string) ([]models.Artifact, error)
+	GetAllArtifacts(ctx context.Context) ([]models.Artifact, error)
+	RemoveArtifact(ctx context.Context, bucket, key string) error
+	AddDeletionAudit(ctx context.Context, audit *models.DeletionAudit) error
+}
+
+// NewStorage initializes a storage implementation selected by configuration.
+func NewStorage(cfg *config.Config, logger *zerolog.Logger, syncUtils *syncutils.SyncUtils) Storage {
+	switch cfg.DB.Backend {
+	case BackendMemory:
+		return memory.NewStorage(logger)
+	case BackendPSQL:
+		return psql.NewStorage(cfg, logger, syncUtils)
+	default:
+		logger.Fatal().Str("backend", cfg.DB.Backend).Msg("invalid storage backend")
+		return nil
+	}
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	goErrors "errors"
+	"os"
+	"testing"
+	"upload-service-auto/internal/config"
+	storageErrors "upload-service-auto/internal/storage/errors"
+	"upload-service-auto/internal/storage/v1/memory"
+	"upload-service-auto/internal/storage/v1/psql"
+	"upload-service-auto/internal/syncutils"
+
+	"github.com/rs/zerolog"
+)
+
+// testDSNKey defines an environment variable with a DSN of a DB the PSQL storage is tested against, the tests drop all
+// tables of the DB.
+const testDSNKey = "TEST_DATABASE_DSN"
+
+// backends returns the storage implementations tested by the same scenarios, each call returns empty storages. The
+// PSQL storage is skipped unless a test DB is given.
+func backends() map[string]func(t *testing.T) Storage {
+	return map[string]func(t *testing.T) Storage{
+		BackendMemory: func(t *testing.T) Storage {
+			logger := zerolog.Nop()
+			return memory.NewStorage(&logger)
+		},
+		BackendPSQL: func(t *testing.T) Storage {
+			dsn := os.Getenv(testDSNKey)
+			if dsn == "" {
+				t.Skipf("%s is not set", testDSNKey)
+			}
+			logger := zerolog.Nop()
+			cfg := &config.Config{}
+			cfg.DB.DatabaseDSN = dsn
+			syncUtils := syncutils.NewSyncUtils()
+			st := psql.NewStorage(cfg, &logger, syncUtils)
+			t.Cleanup(func() {
+				if err := st.DropAll(); err != nil {
+					t.Error(err)
+				}
+				syncUtils.SyncCancel()
+				syncUtils.Wg.Wait()
+			})
+			if err := st.DropAll(); err != nil {
+				t.Fatal(err)
+			}
+			if err := st.Migrate(0); err != nil {
+				t.Fatal(err)
+			}
+			return st
+		},
+	}
+}
+
+// run runs a scenario against every storage implementation.
+func run(t *testing.T, scenario func(t *testing.T, st Storage)) {
+	for name, newStorage := range backends() {
+		newStorage := newStorage
+		t.Run(name, func(t *testing.T) {
+			scenario(t, newStorage(t))
+		})
+	}
+}
+
+// must fails the test on the first error.
+func must(t *testing.T, errs ...error) {
+	t.Helper()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	run(t, func(t *testing.T, st Storage) {
+		ctx := context.Background()
+		must(t, st.AddNewUserID(ctx, "user"))
+
+		var notFound *storageErrors.NotFoundError
+		if err := st.CheckUserID(ctx, "missing"); !goErrors.As(err, &notFound) {
+			t.Errorf("expected NotFoundError for a missing user, got %v", err)
+		}
+		if _, err := st.GetFileNameForUser(ctx, "user"); !goErrors.As(err, &notFound) {
+			t.Errorf("expected NotFoundError for a user without uploads, got %v", err)
+		}
+		if _, err := st.GetProcessedMessage(ctx, "missing"); !goErrors.As(err, &notFound) {
+			t.Errorf("expected NotFoundError for a message not processed, got %v", err)
+		}
+		must(t, st.AddNewUserFilePair(ctx, "user", "file.txt"), st.AddNewValidationEntry(ctx, "file.txt"))
+		if err := st.CheckIsValid(ctx, "file.txt"); !goErrors.As(err, &notFound) {
+			t.Errorf("expected NotFoundError for a file not validated, got %v", err)
+		}
+	})
+}
+
+func TestAlreadyExists(t *testing.T) {
+	run(t, func(t *testing.T, st Storage) {
+		ctx := context.Background()
+		must(t,
+			st.AddNewUserID(ctx, "user"),
+			st.AddNewUserID(ctx, "other"),
+			st.AddNewUserFilePair(ctx, "user", "file.txt"),
+			st.AddNewUserFilePair(ctx, "other", "other.txt"),
+			st.AddNewProcessingEntry(ctx, "file.txt", "B1"),
+			st.AddNewProductCode(ctx, "user", "P1"),
+		)
+
+		var exists *storageErrors.AlreadyExistsError
+		if err := st.AddNewUserID(ctx, "user"); !goErrors.As(err, &exists) {
+			t.Errorf("expected AlreadyExistsError for a user, got %v", err)
+		}
+		if err := st.AddNewProcessingEntry(ctx, "file.txt", "B2"); !goErrors.As(err, &exists) {
+			t.Errorf("expected AlreadyExistsError for a processing entry, got %v", err)
+		}
+		if err := st.AddNewProductCode(ctx, "user", "P2"); !goErrors.As(err, &exists) {
+			t.Errorf("expected AlreadyExistsError for a product code, got %v", err)
+		}
+
+		// a file of another user is refused leaving the current uploads of both users as they are
+		if err := st.AddNewUserFilePair(ctx, "other", "file.txt"); !goErrors.As(err, &exists) {
+			t.Errorf("expected AlreadyExistsError for a file of another user, got %v", err)
+		}
+		for userID, expected := range map[string]string{"user": "file.txt", "other": "other.txt"} {
+			fileName, err := st.GetFileNameForUser(ctx, userID)
+			must(t, err)
+			if fileName != expected {
+				t.Errorf("expected %s to be the current upload of %s, got %s", expected, userID, fileName)
+			}
+		}
+	})
+}
+
+func TestWithinTxRollsBack(t *testing.T) {
+	run(t, func(t *testing.T, st Storage) {
+		ctx := context.Background()
+		must(t, st.AddNewUserID(ctx, "user"))
+
+		failure := goErrors.New("failure")
+		err := st.WithinTx(ctx, func(ctx context.Context) error {
+			if err := st.AddNewUserID(ctx, "new"); err != nil {
+				return err
+			}
+			if err := st.AddNewUserFilePair(ctx, "user", "file.txt"); err != nil {
+				return err
+			}
+			return failure
+		})
+		if !goErrors.Is(err, failure) {
+			t.Fatalf("expected the error of fn, got %v", err)
+		}
+		var notFound *storageErrors.NotFoundError
+		if err = st.CheckUserID(ctx, "new"); !goErrors.As(err, &notFound) {
+			t.Errorf("expected the user to be rolled back, got %v", err)
+		}
+		if _, err = st.GetFileNameForUser(ctx, "user"); !goErrors.As(err, &notFound) {
+			t.Errorf("expected the upload to be rolled back, got %v", err)
+		}
+
+		// a failed statement rolls back the statements before it as well
+		err = st.WithinTx(ctx, func(ctx context.Context) error {
+			if err := st.AddNewUserFilePair(ctx, "user", "file.txt"); err != nil {
+				return err
+			}
+			return st.AddNewUserID(ctx, "user")
+		})
+		var exists *storageErrors.AlreadyExistsError
+		if !goErrors.As(err, &exists) {
+			t.Fatalf("expected AlreadyExistsError, got %v", err)
+		}
+		if _, err = st.GetFileNameForUser(ctx, "user"); !goErrors.As(err, &notFound) {
+			t.Errorf("expected the upload to be rolled back, got %v", err)
+		}
+
+		must(t, st.WithinTx(ctx, func(ctx context.Context) error {
+			return st.AddNewUserFilePair(ctx, "user", "file.txt")
+		}))
+		fileName, err := st.GetFileNameForUser(ctx, "user")
+		must(t, err)
+		if fileName != "file.txt" {
+			t.Errorf("expected the upload to be committed, got %s", fileName)
+		}
+	})
+}
+
+func TestTryLockContention(t *testing.T) {
+	run(t, func(t *testing.T, st Storage) {
+		ctx := context.Background()
+		unlock, err := st.TryLock(ctx, "key")
+		must(t, err)
+
+		var locked *storageErrors.LockNotAcquiredError
+		if _, err = st.TryLock(ctx, "key"); !goErrors.As(err, &locked) {
+			t.Fatalf("expected LockNotAcquiredError for a held lock, got %v", err)
+		}
+		other, err := st.TryLock(ctx, "other")
+		must(t, err)
+		other()
+
+		unlock()
+		unlock, err = st.TryLock(ctx, "key")
+		must(t, err)
+		unlock()
+	})
+}
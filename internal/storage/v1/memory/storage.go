@@ -0,0 +1,942 @@
+// Package memory provides in-memory storage service for tests and local runs.
+
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"upload-service-auto/internal/constants"
+	storageErrors "upload-service-auto/internal/storage/errors"
+	"upload-service-auto/internal/storage/v1/models"
+
+	"github.com/rs/zerolog"
+)
+
+// jobStatusRunning defines a status shared by running validation and processing jobs.
+const jobStatusRunning = constants.ValidationStatusRunning
+
+// txKey defines a context key marking an ongoing unit of work.
+type txKey struct{}
+
+// file defines a stored user-file entry.
+type file struct {
+	id        int64
+	userID    string
+	fileName  string
+	isCurrent bool
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+// processing defines a stored processing entry.
+type processing struct {
+	barcode   string
+	status    string
+	updatedAt time.Time
+}
+
+// state defines all data kept by the storage.
+type state struct {
+	users      map[string]time.Time
+	files      []file
+	products   map[string]string
+	validation map[string]models.Validation
+	processing map[string]processing
+	heartbeats map[string]time.Time
+	outbox     []models.OutboxMessage
+	messages   map[string]models.ProcessedMessage
+	artifacts  map[string]models.Artifact
+	audit      []models.DeletionAudit
+	lastFileID int64
+	lastMsgID  int64
+}
+
+// clone makes a deep copy of the state.
+func (st *state) clone() *state {
+	cloned := &state{
+		users:      make(map[string]time.Time, len(st.users)),
+		files:      make([]file, len(st.files)),
+		products:   make(map[string]string, len(st.products)),
+		validation: make(map[string]models.Validation, len(st.validation)),
+		processing: make(map[string]processing, len(st.processing)),
+		heartbeats: make(map[string]time.Time, len(st.heartbeats)),
+		outbox:     make([]models.OutboxMessage, len(st.outbox)),
+		messages:   make(map[string]models.ProcessedMessage, len(st.messages)),
+		artifacts:  make(map[string]models.Artifact, len(st.artifacts)),
+		audit:      make([]models.DeletionAudit, len(st.audit)),
+		lastFileID: st.lastFileID,
+		lastMsgID:  st.lastMsgID,
+	}
+	for k, v := range st.users {
+		cloned.users[k] = v
+	}
+	copy(cloned.files, st.files)
+	copy(cloned.outbox, st.outbox)
+	copy(cloned.audit, st.audit)
+	for k, v := range st.products {
+		cloned.products[k] = v
+	}
+	for k, v := range st.validation {
+		cloned.validation[k] = v
+	}
+	for k, v := range st.processing {
+		cloned.processing[k] = v
+	}
+	for k, v := range st.heartbeats {
+		cloned.heartbeats[k] = v
+	}
+	for k, v := range st.messages {
+		cloned.messages[k] = v
+	}
+	for k, v := range st.artifacts {
+		cloned.artifacts[k] = v
+	}
+	return cloned
+}
+
+// newState initializes an empty state.
+func newState() *state {
+	return &state{
+		users:      make(map[string]time.Time),
+		products:   make(map[string]string),
+		validation: make(map[string]models.Validation),
+		processing: make(map[string]processing),
+		heartbeats: make(map[string]time.Time),
+		messages:   make(map[string]models.ProcessedMessage),
+		artifacts:  make(map[string]models.Artifact),
+	}
+}
+
+// Storage defines a new object and sets its attributes.
+type Storage struct {
+	mu    sync.RWMutex
+	locks sync.Map
+	log   *zerolog.Logger
+	state *state
+}
+
+// NewStorage initializes a new Storage instance.
+func NewStorage(logger *zerolog.Logger) *Storage {
+	logger.Debug().Msg("calling initializer of in-memory storage service")
+	return &Storage{
+		log:   logger,
+		state: newState(),
+	}
+}
+
+// checkInSlice checks that a string is contained within a slice.
+func (s *Storage) checkInSlice(slice []string, value string) bool {
+	for _, x := range slice {
+		if x == value {
+			return true
+		}
+	}
+	return false
+}
+
+// checkContext returns an error if the context is already done.
+func (s *Storage) checkContext(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	}
+	return nil
+}
+
+// WithinTx runs fn as a single unit of work restoring the state if fn fails. The storage is locked until fn returns,
+// so concurrent callers wait for the unit of work instead of having their changes lost on rollback. Nested calls
+// join the outer unit of work, fn must not use the storage with a context other than the one it is given.
+func (s *Storage) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	s.log.Debug().Msg("calling `WithinTx` method")
+	if ctx.Value(txKey{}) != nil {
+		return fn(ctx)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := s.state.clone()
+	if err := fn(context.WithValue(ctx, txKey{}, true)); err != nil {
+		s.log.Warn().Err(err).Msg("transaction rolled back")
+		s.state = snapshot
+		return err
+	}
+	return nil
+}
+
+// lock takes the write lock unless the context belongs to a unit of work already holding it, the lock is released by
+// calling the returned function.
+func (s *Storage) lock(ctx context.Context) func() {
+	if ctx.Value(txKey{}) != nil {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// rlock takes the read lock unless the context belongs to a unit of work already holding the write lock, the lock is
+// released by calling the returned function.
+func (s *Storage) rlock(ctx context.Context) func() {
+	if ctx.Value(txKey{}) != nil {
+		return func() {}
+	}
+	s.mu.RLock()
+	return s.mu.RUnlock
+}
+
+// TryLock takes a lock shared by all callers using this storage without waiting for it. The lock is released by
+// calling the returned function.
+func (s *Storage) TryLock(ctx context.Context, key string) (func(), error) {
+	s.log.Debug().Msg("calling `TryLock` method")
+	if err := s.checkContext(ctx); err != nil {
+		return nil, err
+	}
+	if _, held := s.locks.LoadOrStore(key, struct{}{}); held {
+		s.log.Warn().Str("key", key).Msg("lock is held by another caller")
+		return nil, &storageErrors.LockNotAcquiredError{Err: errors.New("lock is held by another caller"), Key: key}
+	}
+	return func() {
+		s.locks.Delete(key)
+	}, nil
+}
+
+// SchemaVersion always reports 0 since the state is not versioned by migrations.
+func (s *Storage) SchemaVersion() (int64, error) {
+	s.log.Debug().Msg("calling `SchemaVersion` method")
+	return 0, nil
+}
+
+// Migrate does nothing since the state needs no migrations.
+func (s *Storage) Migrate(to int64) error {
+	s.log.Debug().Msg("calling `Migrate` method")
+	return nil
+}
+
+// Rollback does nothing since the state needs no migrations.
+func (s *Storage) Rollback(to int64) error {
+	s.log.Debug().Msg("calling `Rollback` method")
+	return nil
+}
+
+// DropAll removes all stored data.
+func (s *Storage) DropAll() error {
+	s.log.Debug().Msg("calling `DropAll` method")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = newState()
+	return nil
+}
+
+// RemoveUserData removes all data for one user including all of their uploads and records of their artifacts, the
+// deletion audit is kept.
+func (s *Storage) RemoveUserData(ctx context.Context, userID string) error {
+	s.log.Debug().Msg("calling `RemoveUserData` method")
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+
+	files := s.state.files[:0]
+	for _, f := range s.state.files {
+		if f.userID == userID {
+			delete(s.state.validation, f.fileName)
+			delete(s.state.processing, f.fileName)
+			delete(s.state.heartbeats, heartbeatKey(constants.JobValidation, f.fileName))
+			delete(s.state.heartbeats, heartbeatKey(constants.JobProcessing, f.fileName))
+			continue
+		}
+		files = append(files, f)
+	}
+	s.state.files = files
+	for messageID, msg := range s.state.messages {
+		if msg.UserID == userID {
+			delete(s.state.messages, messageID)
+		}
+	}
+	for key, artifact := range s.state.artifacts {
+		if artifact.UserID == userID {
+			delete(s.state.artifacts, key)
+		}
+	}
+	delete(s.state.products, userID)
+	delete(s.state.users, userID)
+	s.log.Info().Str("userID", userID).Msg("removing user done")
+	return nil
+}
+
+// GetAllUserIDs retrieves all user identifiers currently stored.
+func (s *Storage) GetAllUserIDs(ctx context.Context) ([]string, error) {
+	s.log.Debug().Msg("calling `GetAllUserIDs` method")
+	if err := s.checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer s.rlock(ctx)()
+
+	var userIDs []string
+	for userID := range s.state.users {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+	return userIDs, nil
+}
+
+// AddNewUserID adds a new user.
+func (s *Storage) AddNewUserID(ctx context.Context, userID string) error {
+	s.log.Debug().Msg("calling `AddNewUserID` method")
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+
+	if _, ok := s.state.users[userID]; ok {
+		return &storageErrors.AlreadyExistsError{Err: errors.New("user already exists"), ID: userID}
+	}
+	s.state.users[userID] = time.Now()
+	s.log.Info().Str("userID", userID).Msg("adding new user done")
+	return nil
+}
+
+// CheckUserID checks that a user is stored.
+func (s *Storage) CheckUserID(ctx context.Context, userID string) error {
+	s.log.Debug().Msg("calling `CheckUserID` method")
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.rlock(ctx)()
+
+	if _, ok := s.state.users[userID]; !ok {
+		return &storageErrors.NotFoundError{Err: errors.New("user was not found")}
+	}
+	return nil
+}
+
+// AddNewUserFilePair creates a new user-file entry and marks it as the current upload of the user, previous
+// uploads are kept in history. A file uploaded by the user already becomes the current upload again, a file of
+// another user is reported with AlreadyExistsError.
+func (s *Storage) AddNewUserFilePair(ctx context.Context, userID, fileName string) error {
+	s.log.Debug().Msg("calling `AddNewUserFilePair` method")
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+
+	existing := -1
+	for i, f := range s.state.files {
+		if f.fileName != fileName {
+			continue
+		}
+		if f.userID != userID {
+			return &storageErrors.AlreadyExistsError{Err: errors.New("file belongs to another user"), ID: fileName}
+		}
+		existing = i
+	}
+	now := time.Now()
+	for i := range s.state.files {
+		if s.state.files[i].userID == userID && s.state.files[i].isCurrent {
+			s.state.files[i].isCurrent = false
+			s.state.files[i].updatedAt = now
+		}
+	}
+	if existing >= 0 {
+		s.state.files[existing].isCurrent = true
+		s.state.files[existing].updatedAt = now
+		s.log.Info().Str("userID", userID).Msg("restoring existing file done")
+		return nil
+	}
+	s.state.lastFileID++
+	s.state.files = append(s.state.files, file{
+		id:        s.state.lastFileID,
+		userID:    userID,
+		fileName:  fileName,
+		isCurrent: true,
+		createdAt: now,
+		updatedAt: now,
+	})
+	s.log.Info().Str("userID", userID).Msg("adding new file done")
+	return nil
+}
+
+// GetFileNameForUser retrieves the current filename for a user.
+func (s *Storage) GetFileNameForUser(ctx context.Context, userID string) (string, error) {
+	s.log.Debug().Msg("calling `GetFileNameForUser` method")
+	if err := s.checkContext(ctx); err != nil {
+		return "", err
+	}
+	defer s.rlock(ctx)()
+
+	for _, f := range s.state.files {
+		if f.userID == userID && f.isCurrent {
+			return f.fileName, nil
+		}
+	}
+	return "", &storageErrors.NotFoundError{Err: errors.New("file was not found")}
+}
+
+// GetUserUploads retrieves all uploads of a user along with their validation and processing statuses in time order.
+func (s *Storage) GetUserUploads(ctx context.Context, userID string) ([]models.Upload, error) {
+	s.log.Debug().Msg("calling `GetUserUploads` method")
+	if err := s.checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer s.rlock(ctx)()
+
+	var uploads []models.Upload
+	for _, f := range s.state.files {
+		if f.userID != userID {
+			continue
+		}
+		upload := models.Upload{
+			FileName:         f.fileName,
+			IsCurrent:        f.isCurrent,
+			CreatedAt:        f.createdAt,
+			ValidationStatus: constants.NA,
+			ProcessingStatus: constants.NA,
+		}
+		if v, ok := s.state.validation[f.fileName]; ok {
+			upload.ValidationStatus = v.Status
+		}
+		if p, ok := s.state.processing[f.fileName]; ok {
+			upload.Barcode = p.barcode
+			upload.ProcessingStatus = p.status
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, nil
+}
+
+// AddNewValidationEntry adds new validation data, an existing entry of the file is reset to the new status.
+func (s *Storage) AddNewValidationEntry(ctx context.Context, fileName string) error {
+	s.log.Debug().Msg("calling `AddNewValidationEntry` method")
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+
+	s.state.validation[fileName] = models.Validation{
+		FileName:  fileName,
+		Status:    constants.ValidationStatusNew,
+		UpdatedAt: time.Now(),
+	}
+	return nil
+}
+
+// UpdateValidationStatus updates validation status for a file.
+func (s *Storage) UpdateValidationStatus(ctx context.Context, fileName, status string) error {
+	s.log.Debug().Msg("calling `UpdateValidationStatus` method")
+	if !s.checkInSlice(constants.ValidValidationStatuses, status) {
+		err := errors.New("invalid status")
+		s.log.Error().Err(err).Str("fileName", fileName).Msg(fmt.Sprintf("status %s is invalid", status))
+		return err
+	}
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+
+	if v, ok := s.state.validation[fileName]; ok {
+		v.Status = status
+		v.UpdatedAt = time.Now()
+		s.state.validation[fileName] = v
+	}
+	return nil
+}
+
+// UpdateValidationResult updates validation status for a file along with the result reported by the validator.
+func (s *Storage) UpdateValidationResult(ctx context.Context, validation *models.Validation) error {
+	s.log.Debug().Msg("calling `UpdateValidationResult` method")
+	if !s.checkInSlice(constants.ValidValidationStatuses, validation.Status) {
+		err := errors.New("invalid status")
+		s.log.Error().Err(err).Str("fileName", validation.FileName).Msg(fmt.Sprintf("status %s is invalid", validation.Status))
+		return err
+	}
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+
+	if _, ok := s.state.validation[validation.FileName]; ok {
+		updated := *validation
+		updated.UpdatedAt = time.Now()
+		s.state.validation[validation.FileName] = updated
+	}
+	return nil
+}
+
+// GetValidationResult retrieves validation status and result for a file.
+func (s *Storage) GetValidationResult(ctx context.Context, fileName string) (*models.Validation, error) {
+	s.log.Debug().Msg("calling `GetValidationResult` method")
+	if err := s.checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer s.rlock(ctx)()
+
+	v, ok := s.state.validation[fileName]
+	if !ok {
+		return nil, &storageErrors.NotFoundError{Err: errors.New("validation entry was not found")}
+	}
+	return &v, nil
+}
+
+// CheckIsValid checks that validation is completed and the file is valid for further processing.
+func (s *Storage) CheckIsValid(ctx context.Context, fileName string) error {
+	s.log.Debug().Msg("calling `CheckIsValid` method")
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.rlock(ctx)()
+
+	if v, ok := s.state.validation[fileName]; !ok || v.Status != constants.ValidationStatusValid {
+		return &storageErrors.NotFoundError{Err: errors.New("file is not valid")}
+	}
+	return nil
+}
+
+// AddNewProcessingEntry adds new processing entry.
+func (s *Storage) AddNewProcessingEntry(ctx context.Context, fileName, barcode string) error {
+	s.log.Debug().Msg("calling `AddNewProcessingEntry` method")
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+
+	if _, ok := s.state.processing[fileName]; ok {
+		return &storageErrors.AlreadyExistsError{Err: errors.New("processing entry already exists"), ID: fileName}
+	}
+	s.state.processing[fileName] = processing{
+		barcode:   barcode,
+		status:    constants.ProcessingStatusNew,
+		updatedAt: time.Now(),
+	}
+	return nil
+}
+
+// UpdateProcessingStatus updates processing status of a file.
+func (s *Storage) UpdateProcessingStatus(ctx context.Context, fileName, status string) error {
+	s.log.Debug().Msg("calling `UpdateProcessingStatus` method")
+	if !s.checkInSlice(constants.ValidProcessingStatuses, status) {
+		err := errors.New("invalid status")
+		s.log.Error().Err(err).Str("fileName", fileName).Msg(fmt.Sprintf("status %s is invalid", status))
+		return err
+	}
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+
+	if p, ok := s.state.processing[fileName]; ok {
+		p.status = status
+		p.updatedAt = time.Now()
+		s.state.processing[fileName] = p
+	}
+	return nil
+}
+
+// GetProcessingStatus retrieves processing status for a file.
+func (s *Storage) GetProcessingStatus(ctx context.Context, fileName string) (string, error) {
+	s.log.Debug().Msg("calling `GetProcessingStatus` method")
+	if err := s.checkContext(ctx); err != nil {
+		return "", err
+	}
+	defer s.rlock(ctx)()
+
+	p, ok := s.state.processing[fileName]
+	if !ok {
+		return constants.NA, nil
+	}
+	return p.status, nil
+}
+
+// GetProcessingEntries retrieves processing records of all files along with the users who uploaded them.
+func (s *Storage) GetProcessingEntries(ctx context.Context) ([]models.Processing, error) {
+	s.log.Debug().Msg("calling `GetProcessingEntries` method")
+	if err := s.checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer s.rlock(ctx)()
+
+	users := make(map[string]string, len(s.state.files))
+	for _, f := range s.state.files {
+		users[f.fileName] = f.userID
+	}
+	entries := make([]models.Processing, 0, len(s.state.processing))
+	for fileName, p := range s.state.processing {
+		entries = append(entries, models.Processing{
+			FileName:  fileName,
+			UserID:    users[fileName],
+			Barcode:   p.barcode,
+			Status:    p.status,
+			UpdatedAt: p.updatedAt,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].FileName < entries[j].FileName
+	})
+	return entries, nil
+}
+
+// AddNewProductCode adds a new product code for a user.
+func (s *Storage) AddNewProductCode(ctx context.Context, userID, productCode string) error {
+	s.log.Debug().Msg("calling `AddNewProductCode` method")
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+
+	if _, ok := s.state.products[userID]; ok {
+		return &storageErrors.AlreadyExistsError{Err: errors.New("product code already exists"), ID: userID}
+	}
+	s.state.products[userID] = productCode
+	return nil
+}
+
+// UpdateProductCode updates a product code for a user.
+func (s *Storage) UpdateProductCode(ctx context.Context, userID, productCode string) error {
+	s.log.Debug().Msg("calling `UpdateProductCode` method")
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+
+	if _, ok := s.state.products[userID]; ok {
+		s.state.products[userID] = productCode
+	}
+	return nil
+}
+
+// GetProductCode retrieves a product code for a user.
+func (s *Storage) GetProductCode(ctx context.Context, userID string) (string, error) {
+	s.log.Debug().Msg("calling `GetProductCode` method")
+	if err := s.checkContext(ctx); err != nil {
+		return "", err
+	}
+	defer s.rlock(ctx)()
+
+	productCode, ok := s.state.products[userID]
+	if !ok {
+		return constants.NA, nil
+	}
+	return productCode, nil
+}
+
+// heartbeatKey returns a key under which a heartbeat of a job is kept.
+func heartbeatKey(kind, fileName string) string {
+	return fmt.Sprintf("%s:%s", kind, fileName)
+}
+
+// job retrieves status of a job along with the time it was last known to be alive.
+func (s *Storage) job(kind, fileName string) (string, time.Time, bool) {
+	var (
+		status    string
+		updatedAt time.Time
+	)
+	switch kind {
+	case constants.JobValidation:
+		v, ok := s.state.validation[fileName]
+		if !ok {
+			return "", time.Time{}, false
+		}
+		status, updatedAt = v.Status, v.UpdatedAt
+	case constants.JobProcessing:
+		p, ok := s.state.processing[fileName]
+		if !ok {
+			return "", time.Time{}, false
+		}
+		status, updatedAt = p.status, p.updatedAt
+	}
+	if heartbeatAt, ok := s.state.heartbeats[heartbeatKey(kind, fileName)]; ok && heartbeatAt.After(updatedAt) {
+		updatedAt = heartbeatAt
+	}
+	return status, updatedAt, true
+}
+
+// checkJob checks that a job kind is valid.
+func (s *Storage) checkJob(kind string) error {
+	if !s.checkInSlice(constants.ValidJobs, kind) {
+		err := errors.New("invalid job kind")
+		s.log.Error().Err(err).Msg(fmt.Sprintf("job kind %s is invalid", kind))
+		return err
+	}
+	return nil
+}
+
+// Heartbeat extends the lease of a running job of a file.
+func (s *Storage) Heartbeat(ctx context.Context, kind, fileName string) error {
+	s.log.Debug().Msg("calling `Heartbeat` method")
+	if err := s.checkJob(kind); err != nil {
+		return err
+	}
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+
+	if status, _, ok := s.job(kind, fileName); ok && status == jobStatusRunning {
+		s.state.heartbeats[heartbeatKey(kind, fileName)] = time.Now()
+	}
+	return nil
+}
+
+// GetStaleJobs retrieves running jobs of a kind which were last known to be alive before the given time.
+func (s *Storage) GetStaleJobs(ctx context.Context, kind string, before time.Time) ([]models.Job, error) {
+	s.log.Debug().Msg("calling `GetStaleJobs` method")
+	if err := s.checkJob(kind); err != nil {
+		return nil, err
+	}
+	if err := s.checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer s.rlock(ctx)()
+
+	var jobs []models.Job
+	for _, f := range s.state.files {
+		status, aliveAt, ok := s.job(kind, f.fileName)
+		if !ok || status != jobStatusRunning || !aliveAt.Before(before) {
+			continue
+		}
+		job := models.Job{
+			Kind:        kind,
+			UserID:      f.userID,
+			FileName:    f.fileName,
+			HeartbeatAt: aliveAt,
+		}
+		if kind == constants.JobProcessing {
+			job.Barcode = s.state.processing[f.fileName].barcode
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].HeartbeatAt.Before(jobs[j].HeartbeatAt) })
+	return jobs, nil
+}
+
+// ExpireJob sets a new status for a running job of a file unless it has sent a heartbeat since the given time,
+// reporting whether the job was expired.
+func (s *Storage) ExpireJob(ctx context.Context, kind, fileName, status string, before time.Time) (bool, error) {
+	s.log.Debug().Msg("calling `ExpireJob` method")
+	if err := s.checkJob(kind); err != nil {
+		return false, err
+	}
+	validStatuses := constants.ValidValidationStatuses
+	if kind == constants.JobProcessing {
+		validStatuses = constants.ValidProcessingStatuses
+	}
+	if !s.checkInSlice(validStatuses, status) {
+		err := errors.New("invalid status")
+		s.log.Error().Err(err).Str("fileName", fileName).Msg(fmt.Sprintf("status %s is invalid", status))
+		return false, err
+	}
+	if err := s.checkContext(ctx); err != nil {
+		return false, err
+	}
+	defer s.lock(ctx)()
+
+	current, aliveAt, ok := s.job(kind, fileName)
+	if !ok || current != jobStatusRunning || !aliveAt.Before(before) {
+		return false, nil
+	}
+	now := time.Now()
+	if kind == constants.JobValidation {
+		v := s.state.validation[fileName]
+		v.Status = status
+		v.UpdatedAt = now
+		s.state.validation[fileName] = v
+	} else {
+		p := s.state.processing[fileName]
+		p.status = status
+		p.updatedAt = now
+		s.state.processing[fileName] = p
+	}
+	return true, nil
+}
+
+// AddOutboxMessage saves a message to be published.
+func (s *Storage) AddOutboxMessage(ctx context.Context, msg *models.OutboxMessage) error {
+	s.log.Debug().Msg("calling `AddOutboxMessage` method")
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+
+	s.state.lastMsgID++
+	s.state.outbox = append(s.state.outbox, models.OutboxMessage{
+		ID:          s.state.lastMsgID,
+		Exchange:    msg.Exchange,
+		ContentType: msg.ContentType,
+		Headers:     msg.Headers,
+		Payload:     msg.Payload,
+		CreatedAt:   time.Now(),
+	})
+	return nil
+}
+
+// GetOutboxMessages retrieves up to limit oldest messages to be published. Messages are not locked, so the outbox
+// has to be relayed by a single relay.
+func (s *Storage) GetOutboxMessages(ctx context.Context, limit int) ([]models.OutboxMessage, error) {
+	s.log.Debug().Msg("calling `GetOutboxMessages` method")
+	if err := s.checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer s.rlock(ctx)()
+
+	if limit > len(s.state.outbox) {
+		limit = len(s.state.outbox)
+	}
+	messages := make([]models.OutboxMessage, limit)
+	copy(messages, s.state.outbox)
+	return messages, nil
+}
+
+// DeleteOutboxMessage removes a published message.
+func (s *Storage) DeleteOutboxMessage(ctx context.Context, id int64) error {
+	s.log.Debug().Msg("calling `DeleteOutboxMessage` method")
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+
+	for i, msg := range s.state.outbox {
+		if msg.ID == id {
+			s.state.outbox = append(s.state.outbox[:i:i], s.state.outbox[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+// RecordOutboxFailure counts a failed attempt to publish a message keeping its error.
+func (s *Storage) RecordOutboxFailure(ctx context.Context, id int64, reason string) error {
+	s.log.Debug().Msg("calling `RecordOutboxFailure` method")
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+
+	for i := range s.state.outbox {
+		if s.state.outbox[i].ID == id {
+			s.state.outbox[i].Attempts++
+			s.state.outbox[i].LastError = reason
+			return nil
+		}
+	}
+	return nil
+}
+
+// AddProcessedMessage records a task message whose job is completed, a message recorded already is left as it is.
+func (s *Storage) AddProcessedMessage(ctx context.Context, msg *models.ProcessedMessage) error {
+	s.log.Debug().Msg("calling `AddProcessedMessage` method")
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+
+	if _, ok := s.state.messages[msg.MessageID]; ok {
+		return nil
+	}
+	recorded := *msg
+	recorded.ProcessedAt = time.Now()
+	s.state.messages[msg.MessageID] = recorded
+	return nil
+}
+
+// GetProcessedMessage retrieves a recorded task message.
+func (s *Storage) GetProcessedMessage(ctx context.Context, messageID string) (*models.ProcessedMessage, error) {
+	s.log.Debug().Msg("calling `GetProcessedMessage` method")
+	if err := s.checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer s.rlock(ctx)()
+
+	msg, ok := s.state.messages[messageID]
+	if !ok {
+		return nil, &storageErrors.NotFoundError{Err: errors.New("message was not processed")}
+	}
+	return &msg, nil
+}
+
+// artifactKey returns a key under which an artifact is kept.
+func artifactKey(bucket, key string) string {
+	return bucket + "/" + key
+}
+
+// AddArtifacts records objects uploaded as processing results, an object recorded already is assigned to the new
+// upload.
+func (s *Storage) AddArtifacts(ctx context.Context, artifacts []models.Artifact) error {
+	s.log.Debug().Msg("calling `AddArtifacts` method")
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+
+	uploadedAt := time.Now()
+	for _, artifact := range artifacts {
+		artifact.UploadedAt = uploadedAt
+		s.state.artifacts[artifactKey(artifact.Bucket, artifact.Key)] = artifact
+	}
+	return nil
+}
+
+// GetArtifacts retrieves objects uploaded as processing results of all uploads of a user.
+func (s *Storage) GetArtifacts(ctx context.Context, userID string) ([]models.Artifact, error) {
+	s.log.Debug().Msg("calling `GetArtifacts` method")
+	if err := s.checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer s.rlock(ctx)()
+
+	var artifacts []models.Artifact
+	for _, artifact := range s.state.artifacts {
+		if artifact.UserID == userID {
+			artifacts = append(artifacts, artifact)
+		}
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifactKey(artifacts[i].Bucket, artifacts[i].Key) < artifactKey(artifacts[j].Bucket, artifacts[j].Key)
+	})
+	return artifacts, nil
+}
+
+// GetAllArtifacts retrieves objects uploaded as processing results of all users.
+func (s *Storage) GetAllArtifacts(ctx context.Context) ([]models.Artifact, error) {
+	s.log.Debug().Msg("calling `GetAllArtifacts` method")
+	if err := s.checkContext(ctx); err != nil {
+		return nil, err
+	}
+	defer s.rlock(ctx)()
+
+	artifacts := make([]models.Artifact, 0, len(s.state.artifacts))
+	for _, artifact := range s.state.artifacts {
+		artifacts = append(artifacts, artifact)
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifactKey(artifacts[i].Bucket, artifacts[i].Key) < artifactKey(artifacts[j].Bucket, artifacts[j].Key)
+	})
+	return artifacts, nil
+}
+
+// RemoveArtifact removes a record of an object uploaded as a processing result.
+func (s *Storage) RemoveArtifact(ctx context.Context, bucket, key string) error {
+	s.log.Debug().Msg("calling `RemoveArtifact` method")
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+
+	delete(s.state.artifacts, artifactKey(bucket, key))
+	return nil
+}
+
+// AddDeletionAudit records a removed object, the record is kept after the user data is removed.
+func (s *Storage) AddDeletionAudit(ctx context.Context, audit *models.DeletionAudit) error {
+	s.log.Debug().Msg("calling `AddDeletionAudit` method")
+	if err := s.checkContext(ctx); err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+
+	recorded := *audit
+	recorded.ID = int64(len(s.state.audit) + 1)
+	recorded.DeletedAt = time.Now()
+	s.state.audit = append(s.state.audit, recorded)
+	return nil
+}
@@ -0,0 +1,93 @@
+// Package models provides data types and models used in storage packages.
+
+package models
+
+import "time"
+
+// Upload defines one file uploaded by a user along with its validation and processing state.
+type Upload struct {
+	FileName         string
+	IsCurrent        bool
+	CreatedAt        time.Time
+	ValidationStatus string
+	Barcode          string
+	ProcessingStatus string
+}
+
+// Processing defines a processing record of a file along with the user who uploaded it.
+type Processing struct {
+	FileName  string
+	UserID    string
+	Barcode   string
+	Status    string
+	UpdatedAt time.Time
+}
+
+// Validation defines a validation record of a file including the result reported by the validator.
+type Validation struct {
+	FileName  string
+	Status    string
+	Mode      string
+	Sex       string
+	Err       string
+	Passed    bool
+	UpdatedAt time.Time
+}
+
+// Job defines a running validation or processing job of a file along with the time it was last known to be alive.
+type Job struct {
+	Kind        string
+	UserID      string
+	FileName    string
+	Barcode     string
+	HeartbeatAt time.Time
+}
+
+// OutboxMessage defines a message saved along with the change it reports and waiting to be published to an exchange.
+type OutboxMessage struct {
+	ID          int64
+	Exchange    string
+	ContentType string
+	Headers     map[string]string
+	Payload     []byte
+	Attempts    int
+	LastError   string
+	CreatedAt   time.Time
+}
+
+// ProcessedMessage defines a task message whose job is completed along with the response sent for it, so that the
+// response is sent again for duplicates of the message instead of running the job again.
+type ProcessedMessage struct {
+	MessageID   string
+	Kind        string
+	UserID      string
+	FileName    string
+	ContentType string
+	Headers     map[string]string
+	Response    []byte
+	ProcessedAt time.Time
+}
+
+// Artifact defines an object uploaded to S3 as a processing result of a file, so that it can be removed along with
+// the user data.
+type Artifact struct {
+	UserID     string
+	FileName   string
+	Barcode    string
+	Bucket     string
+	Key        string
+	Size       int64
+	SHA256     string
+	UploadedAt time.Time
+}
+
+// DeletionAudit defines a record of an S3 object removed along with user data or replaced by reprocessing.
+type DeletionAudit struct {
+	ID        int64
+	UserID    string
+	Kind      string
+	Bucket    string
+	Key       string
+	Reason    string
+	DeletedAt time.Time
+}
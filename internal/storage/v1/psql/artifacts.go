@@ -0,0 +1,193 @@
+// Package psql provides PSQL storage service.
+
+package psql
+
+import (
+	"context"
+	"time"
+	storageErrors "upload-service-auto/internal/storage/errors"
+	"upload-service-auto/internal/storage/v1/models"
+)
+
+// AddArtifacts records objects uploaded as processing results, an object recorded already is assigned to the new
+// upload.
+func (s *Storage) AddArtifacts(ctx context.Context, artifacts []models.Artifact) error {
+	s.log.Debug().Msg("calling `AddArtifacts` method")
+	addArtifactStmt, err := s.conn(ctx).PrepareContext(ctx, `INSERT INTO artifacts (user_id, file_name, barcode, bucket,
+		key, size, sha256, uploaded_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (bucket, key) DO UPDATE SET user_id = EXCLUDED.user_id, file_name = EXCLUDED.file_name,
+		barcode = EXCLUDED.barcode, size = EXCLUDED.size, sha256 = EXCLUDED.sha256, uploaded_at = EXCLUDED.uploaded_at`)
+	if err != nil {
+		s.log.Error().Err(err).Msg("could not prepare statement")
+		return &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer addArtifactStmt.Close()
+	chanOk := make(chan bool)
+	chanEr := make(chan error)
+	go func() {
+		uploadedAt := time.Now().Format(time.RFC3339)
+		for _, artifact := range artifacts {
+			_, err := addArtifactStmt.ExecContext(ctx, artifact.UserID, artifact.FileName, artifact.Barcode,
+				artifact.Bucket, artifact.Key, artifact.Size, artifact.SHA256, uploadedAt)
+			if err != nil {
+				chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+				return
+			}
+		}
+		chanOk <- true
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.log.Error().Err(ctx.Err()).Msg("adding artifacts failed")
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case methodErr := <-chanEr:
+		s.log.Error().Err(methodErr).Msg("adding artifacts failed")
+		return methodErr
+	case <-chanOk:
+		s.log.Debug().Int("count", len(artifacts)).Msg("adding artifacts done")
+		return nil
+	}
+}
+
+// queryArtifacts retrieves artifacts selected by a query of their user_id, file_name, barcode, bucket, key, size,
+// sha256 and uploaded_at columns.
+func (s *Storage) queryArtifacts(ctx context.Context, query string, args ...interface{}) ([]models.Artifact, error) {
+	getArtifactsStmt, err := s.conn(ctx).PrepareContext(ctx, query)
+	if err != nil {
+		s.log.Error().Err(err).Msg("could not prepare statement")
+		return nil, &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer getArtifactsStmt.Close()
+
+	chanOk := make(chan []models.Artifact)
+	chanEr := make(chan error)
+	go func() {
+		rows, err := getArtifactsStmt.QueryContext(ctx, args...)
+		if err != nil {
+			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+
+		var queryOutput []models.Artifact
+		for rows.Next() {
+			var queryOutputRow models.Artifact
+			err = rows.Scan(
+				&queryOutputRow.UserID,
+				&queryOutputRow.FileName,
+				&queryOutputRow.Barcode,
+				&queryOutputRow.Bucket,
+				&queryOutputRow.Key,
+				&queryOutputRow.Size,
+				&queryOutputRow.SHA256,
+				&queryOutputRow.UploadedAt,
+			)
+			if err != nil {
+				chanEr <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			queryOutput = append(queryOutput, queryOutputRow)
+		}
+		err = rows.Err()
+		if err != nil {
+			chanEr <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		chanOk <- queryOutput
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.log.Error().Err(ctx.Err()).Msg("getting artifacts failed")
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case methodErr := <-chanEr:
+		s.log.Error().Err(methodErr).Msg("getting artifacts failed")
+		return nil, methodErr
+	case result := <-chanOk:
+		s.log.Debug().Int("count", len(result)).Msg("getting artifacts done")
+		return result, nil
+	}
+}
+
+// GetArtifacts retrieves objects uploaded as processing results of all uploads of a user.
+func (s *Storage) GetArtifacts(ctx context.Context, userID string) ([]models.Artifact, error) {
+	s.log.Debug().Msg("calling `GetArtifacts` method")
+	return s.queryArtifacts(ctx, `SELECT user_id, file_name, barcode, bucket, key, size, sha256, uploaded_at
+		FROM artifacts WHERE user_id = $1 ORDER BY bucket, key`, userID)
+}
+
+// GetAllArtifacts retrieves objects uploaded as processing results of all users.
+func (s *Storage) GetAllArtifacts(ctx context.Context) ([]models.Artifact, error) {
+	s.log.Debug().Msg("calling `GetAllArtifacts` method")
+	return s.queryArtifacts(ctx, `SELECT user_id, file_name, barcode, bucket, key, size, sha256, uploaded_at
+		FROM artifacts ORDER BY bucket, key`)
+}
+
+// RemoveArtifact removes a record of an object uploaded as a processing result.
+func (s *Storage) RemoveArtifact(ctx context.Context, bucket, key string) error {
+	s.log.Debug().Msg("calling `RemoveArtifact` method")
+	removeArtifactStmt, err := s.conn(ctx).PrepareContext(ctx, "DELETE FROM artifacts WHERE bucket = $1 AND key = $2")
+	if err != nil {
+		s.log.Error().Err(err).Str("key", key).Msg("could not prepare statement")
+		return &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer removeArtifactStmt.Close()
+	chanOk := make(chan bool)
+	chanEr := make(chan error)
+	go func() {
+		_, err := removeArtifactStmt.ExecContext(ctx, bucket, key)
+		if err != nil {
+			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		chanOk <- true
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.log.Error().Err(ctx.Err()).Str("key", key).Msg("removing artifact failed")
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case methodErr := <-chanEr:
+		s.log.Error().Err(methodErr).Str("key", key).Msg("removing artifact failed")
+		return methodErr
+	case <-chanOk:
+		s.log.Debug().Str("key", key).Msg("removing artifact done")
+		return nil
+	}
+}
+
+// AddDeletionAudit records a removed object, the record is kept after the user data is removed.
+func (s *Storage) AddDeletionAudit(ctx context.Context, audit *models.DeletionAudit) error {
+	s.log.Debug().Msg("calling `AddDeletionAudit` method")
+	addAuditStmt, err := s.conn(ctx).PrepareContext(ctx, `INSERT INTO deletion_audit (user_id, kind, bucket, key, reason,
+		deleted_at) VALUES ($1, $2, $3, $4, $5, $6)`)
+	if err != nil {
+		s.log.Error().Err(err).Str("userID", audit.UserID).Msg("could not prepare statement")
+		return &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer addAuditStmt.Close()
+	chanOk := make(chan bool)
+	chanEr := make(chan error)
+	go func() {
+		_, err := addAuditStmt.ExecContext(ctx, audit.UserID, audit.Kind, audit.Bucket, audit.Key, audit.Reason,
+			time.Now().Format(time.RFC3339))
+		if err != nil {
+			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		chanOk <- true
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.log.Error().Err(ctx.Err()).Str("userID", audit.UserID).Msg("adding deletion audit failed")
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case methodErr := <-chanEr:
+		s.log.Error().Err(methodErr).Str("userID", audit.UserID).Msg("adding deletion audit failed")
+		return methodErr
+	case <-chanOk:
+		s.log.Debug().Str("userID", audit.UserID).Str("key", audit.Key).Msg("adding deletion audit done")
+		return nil
+	}
+}
@@ -0,0 +1,203 @@
+// Package psql provides PSQL storage service.
+
+package psql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"upload-service-auto/internal/constants"
+	storageErrors "upload-service-auto/internal/storage/errors"
+	"upload-service-auto/internal/storage/v1/models"
+)
+
+// jobTable defines a table keeping jobs of one kind, an expression selecting their barcode and their statuses.
+type jobTable struct {
+	name     string
+	barcode  string
+	running  string
+	statuses []string
+}
+
+// jobTables maps job kinds to their tables, table names are never taken from the input.
+var jobTables = map[string]jobTable{
+	constants.JobValidation: {
+		name:     "validation",
+		barcode:  "''",
+		running:  constants.ValidationStatusRunning,
+		statuses: constants.ValidValidationStatuses,
+	},
+	constants.JobProcessing: {
+		name:     "processing",
+		barcode:  "COALESCE(j.barcode, '')",
+		running:  constants.ProcessingStatusRunning,
+		statuses: constants.ValidProcessingStatuses,
+	},
+}
+
+// jobTable retrieves a table for a job kind.
+func (s *Storage) jobTable(kind string) (jobTable, error) {
+	table, ok := jobTables[kind]
+	if !ok {
+		err := errors.New("invalid job kind")
+		s.log.Error().Err(err).Msg(fmt.Sprintf("job kind %s is invalid", kind))
+		return jobTable{}, err
+	}
+	return table, nil
+}
+
+// Heartbeat extends the lease of a running job of a file.
+func (s *Storage) Heartbeat(ctx context.Context, kind, fileName string) error {
+	s.log.Debug().Msg("calling `Heartbeat` method")
+	table, err := s.jobTable(kind)
+	if err != nil {
+		return err
+	}
+
+	heartbeatStmt, err := s.conn(ctx).PrepareContext(ctx, fmt.Sprintf("UPDATE %s SET heartbeat_at = $1 WHERE file_name = $2 AND status = $3", table.name))
+	if err != nil {
+		s.log.Error().Err(err).Str("fileName", fileName).Msg("could not prepare statement")
+		return &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer heartbeatStmt.Close()
+	chanOk := make(chan bool)
+	chanEr := make(chan error)
+	go func() {
+		_, err := heartbeatStmt.ExecContext(ctx, time.Now().Format(time.RFC3339), fileName, table.running)
+		if err != nil {
+			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		chanOk <- true
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.log.Error().Err(ctx.Err()).Str("fileName", fileName).Str("job", kind).Msg("sending heartbeat failed")
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case methodErr := <-chanEr:
+		s.log.Error().Err(methodErr).Str("fileName", fileName).Str("job", kind).Msg("sending heartbeat failed")
+		return methodErr
+	case <-chanOk:
+		s.log.Debug().Str("fileName", fileName).Str("job", kind).Msg("sending heartbeat done")
+		return nil
+	}
+}
+
+// GetStaleJobs retrieves running jobs of a kind which were last known to be alive before the given time.
+func (s *Storage) GetStaleJobs(ctx context.Context, kind string, before time.Time) ([]models.Job, error) {
+	s.log.Debug().Msg("calling `GetStaleJobs` method")
+	table, err := s.jobTable(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	getJobsStmt, err := s.conn(ctx).PrepareContext(ctx, fmt.Sprintf(`SELECT f.user_id, j.file_name, %s,
+		GREATEST(j.heartbeat_at, j.updated_at) AS alive_at
+		FROM %s j
+		JOIN files f ON f.file_name = j.file_name
+		WHERE j.status = $1 AND GREATEST(j.heartbeat_at, j.updated_at) < $2
+		ORDER BY alive_at`, table.barcode, table.name))
+	if err != nil {
+		s.log.Error().Err(err).Str("job", kind).Msg("could not prepare statement")
+		return nil, &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer getJobsStmt.Close()
+
+	chanOk := make(chan []models.Job)
+	chanEr := make(chan error)
+	go func() {
+		rows, err := getJobsStmt.QueryContext(ctx, table.running, before.Format(time.RFC3339))
+		if err != nil {
+			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+
+		var queryOutput []models.Job
+		for rows.Next() {
+			queryOutputRow := models.Job{Kind: kind}
+			err = rows.Scan(
+				&queryOutputRow.UserID,
+				&queryOutputRow.FileName,
+				&queryOutputRow.Barcode,
+				&queryOutputRow.HeartbeatAt,
+			)
+			if err != nil {
+				chanEr <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			queryOutput = append(queryOutput, queryOutputRow)
+		}
+		err = rows.Err()
+		if err != nil {
+			chanEr <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		chanOk <- queryOutput
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.log.Error().Err(ctx.Err()).Str("job", kind).Msg("getting stale jobs failed")
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case methodErr := <-chanEr:
+		s.log.Error().Err(methodErr).Str("job", kind).Msg("getting stale jobs failed")
+		return nil, methodErr
+	case result := <-chanOk:
+		s.log.Info().Str("job", kind).Int("count", len(result)).Msg("getting stale jobs done")
+		return result, nil
+	}
+}
+
+// ExpireJob sets a new status for a running job of a file unless it has sent a heartbeat since the given time,
+// reporting whether the job was expired.
+func (s *Storage) ExpireJob(ctx context.Context, kind, fileName, status string, before time.Time) (bool, error) {
+	s.log.Debug().Msg("calling `ExpireJob` method")
+	table, err := s.jobTable(kind)
+	if err != nil {
+		return false, err
+	}
+	if !s.checkInSlice(table.statuses, status) {
+		err := errors.New("invalid status")
+		s.log.Error().Err(err).Str("fileName", fileName).Msg(fmt.Sprintf("status %s is invalid", status))
+		return false, err
+	}
+
+	expireStmt, err := s.conn(ctx).PrepareContext(ctx, fmt.Sprintf(`UPDATE %s SET (status, updated_at) = ($1, $2)
+		WHERE file_name = $3 AND status = $4 AND GREATEST(heartbeat_at, updated_at) < $5`, table.name))
+	if err != nil {
+		s.log.Error().Err(err).Str("fileName", fileName).Msg("could not prepare statement")
+		return false, &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer expireStmt.Close()
+	chanOk := make(chan bool)
+	chanEr := make(chan error)
+	go func() {
+		result, err := expireStmt.ExecContext(ctx, status, time.Now().Format(time.RFC3339), fileName,
+			table.running, before.Format(time.RFC3339))
+		if err != nil {
+			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		chanOk <- affected > 0
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.log.Error().Err(ctx.Err()).Str("fileName", fileName).Str("job", kind).Msg("expiring job failed")
+		return false, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case methodErr := <-chanEr:
+		s.log.Error().Err(methodErr).Str("fileName", fileName).Str("job", kind).Msg("expiring job failed")
+		return false, methodErr
+	case expired := <-chanOk:
+		s.log.Info().Str("fileName", fileName).Str("job", kind).Bool("expired", expired).Msg("expiring job done")
+		return expired, nil
+	}
+}
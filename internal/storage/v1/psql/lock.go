@@ -0,0 +1,70 @@
+// Package psql provides PSQL storage service.
+
+package psql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"time"
+	storageErrors "upload-service-auto/internal/storage/errors"
+)
+
+// unlockTimeout limits the duration of releasing an advisory lock.
+const unlockTimeout = 5 * time.Second
+
+// migrationLockKey defines an advisory lock key preventing concurrent schema changes.
+const migrationLockKey = "schema_migrations"
+
+// lock takes a session level advisory lock on a dedicated connection, so that the lock is held until the returned
+// function is called or the connection is lost. If wait is false and the lock is held by another session
+// LockNotAcquiredError is returned.
+func (s *Storage) lock(ctx context.Context, key string, wait bool) (func(), error) {
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		s.log.Error().Err(err).Str("key", key).Msg("could not get a DB connection")
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+
+	if wait {
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtextextended($1, 0))", key)
+	} else {
+		var acquired bool
+		err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtextextended($1, 0))", key).Scan(&acquired)
+		if err == nil && !acquired {
+			_ = conn.Close()
+			s.log.Warn().Str("key", key).Msg("lock is held by another session")
+			return nil, &storageErrors.LockNotAcquiredError{Err: errors.New("lock is held by another session"), Key: key}
+		}
+	}
+	if err != nil {
+		_ = conn.Close()
+		s.log.Error().Err(err).Str("key", key).Msg("could not acquire lock")
+		if ctx.Err() != nil {
+			return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		}
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	s.log.Debug().Str("key", key).Msg("lock acquired")
+
+	return func() {
+		// the caller context may already be cancelled, the lock must be released anyway
+		ctx, cancel := context.WithTimeout(context.Background(), unlockTimeout)
+		defer cancel()
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtextextended($1, 0))", key)
+		if err != nil {
+			s.log.Error().Err(err).Str("key", key).Msg("could not release lock")
+			// discarding the connection ends the session and releases its locks
+			_ = conn.Raw(func(driverConn interface{}) error { return driver.ErrBadConn })
+		}
+		_ = conn.Close()
+		s.log.Debug().Str("key", key).Msg("lock released")
+	}, nil
+}
+
+// TryLock takes an advisory lock shared by all service instances using the same DB without waiting for it. The
+// lock is released by calling the returned function.
+func (s *Storage) TryLock(ctx context.Context, key string) (func(), error) {
+	s.log.Debug().Msg("calling `TryLock` method")
+	return s.lock(ctx, key, false)
+}
@@ -0,0 +1,108 @@
+// Package psql provides PSQL storage service.
+
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+	storageErrors "upload-service-auto/internal/storage/errors"
+	"upload-service-auto/internal/storage/v1/models"
+)
+
+// AddProcessedMessage records a task message whose job is completed, it is meant to be called within the transaction
+// saving the result of the job. A message recorded already is left as it is.
+func (s *Storage) AddProcessedMessage(ctx context.Context, msg *models.ProcessedMessage) error {
+	s.log.Debug().Msg("calling `AddProcessedMessage` method")
+	headers, err := json.Marshal(msg.Headers)
+	if err != nil {
+		s.log.Error().Err(err).Str("messageID", msg.MessageID).Msg("could not serialize headers")
+		return err
+	}
+
+	addMessageStmt, err := s.conn(ctx).PrepareContext(ctx, `INSERT INTO processed_messages (message_id, kind, user_id,
+		file_name, content_type, headers, response, processed_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (message_id) DO NOTHING`)
+	if err != nil {
+		s.log.Error().Err(err).Str("messageID", msg.MessageID).Msg("could not prepare statement")
+		return &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer addMessageStmt.Close()
+	chanOk := make(chan bool)
+	chanEr := make(chan error)
+	go func() {
+		_, err := addMessageStmt.ExecContext(ctx, msg.MessageID, msg.Kind, msg.UserID, msg.FileName, msg.ContentType,
+			headers, msg.Response, time.Now().Format(time.RFC3339))
+		if err != nil {
+			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		chanOk <- true
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.log.Error().Err(ctx.Err()).Str("messageID", msg.MessageID).Msg("adding processed message failed")
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case methodErr := <-chanEr:
+		s.log.Error().Err(methodErr).Str("messageID", msg.MessageID).Msg("adding processed message failed")
+		return methodErr
+	case <-chanOk:
+		s.log.Debug().Str("messageID", msg.MessageID).Msg("adding processed message done")
+		return nil
+	}
+}
+
+// GetProcessedMessage retrieves a recorded task message, NotFoundError is returned for a message that has not been
+// processed yet.
+func (s *Storage) GetProcessedMessage(ctx context.Context, messageID string) (*models.ProcessedMessage, error) {
+	s.log.Debug().Msg("calling `GetProcessedMessage` method")
+	getMessageStmt, err := s.conn(ctx).PrepareContext(ctx, `SELECT kind, user_id, file_name, content_type, headers,
+		response, processed_at FROM processed_messages WHERE message_id = $1`)
+	if err != nil {
+		s.log.Error().Err(err).Str("messageID", messageID).Msg("could not prepare statement")
+		return nil, &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer getMessageStmt.Close()
+	chanOk := make(chan *models.ProcessedMessage)
+	chanEr := make(chan error)
+	go func() {
+		var headers []byte
+		msg := models.ProcessedMessage{MessageID: messageID}
+		err := getMessageStmt.QueryRowContext(ctx, messageID).Scan(
+			&msg.Kind,
+			&msg.UserID,
+			&msg.FileName,
+			&msg.ContentType,
+			&headers,
+			&msg.Response,
+			&msg.ProcessedAt,
+		)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				chanEr <- &storageErrors.NotFoundError{Err: err}
+				return
+			}
+			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		if err = json.Unmarshal(headers, &msg.Headers); err != nil {
+			chanEr <- err
+			return
+		}
+		chanOk <- &msg
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.log.Error().Err(ctx.Err()).Str("messageID", messageID).Msg("getting processed message failed")
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case methodErr := <-chanEr:
+		s.log.Debug().Err(methodErr).Str("messageID", messageID).Msg("getting processed message failed")
+		return nil, methodErr
+	case result := <-chanOk:
+		s.log.Debug().Str("messageID", messageID).Msg("getting processed message done")
+		return result, nil
+	}
+}
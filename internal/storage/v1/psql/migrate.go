@@ -0,0 +1,274 @@
+// Package psql provides PSQL storage service.
+
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	storageErrors "upload-service-auto/internal/storage/errors"
+)
+
+// migrationTimeout limits the overall duration of a single migration run.
+const migrationTimeout = 60 * time.Second
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration defines one versioned schema change with its up and down scripts.
+type migration struct {
+	version int64
+	name    string
+	up      string
+	down    string
+}
+
+// loadMigrations parses embedded migration files named as `<version>_<name>.<up|down>.sql`.
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		base := strings.TrimSuffix(fileName, ".sql")
+		direction := path.Ext(base)
+		base = strings.TrimSuffix(base, direction)
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 || (direction != ".up" && direction != ".down") {
+			return nil, fmt.Errorf("invalid migration file name %s", fileName)
+		}
+		version, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", fileName, err)
+		}
+		body, err := migrationFiles.ReadFile(path.Join("migrations", fileName))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: parts[1]}
+			byVersion[version] = m
+		}
+		if direction == ".up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d must have both up and down scripts", m.version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// ensureMigrationsTable creates a table keeping track of applied migrations.
+func (s *Storage) ensureMigrationsTable(ctx context.Context) error {
+	query := `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version      BIGINT      NOT NULL PRIMARY KEY,
+		name         TEXT        NOT NULL,
+		applied_at   TIMESTAMPTZ NOT NULL
+	);`
+	_, err := s.DB.ExecContext(ctx, query)
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	return nil
+}
+
+// appliedVersions retrieves versions of all applied migrations.
+func (s *Storage) appliedVersions(ctx context.Context) (map[int64]bool, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return nil, &storageErrors.ScanningPSQLError{Err: err}
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &storageErrors.ScanningPSQLError{Err: err}
+	}
+	return applied, nil
+}
+
+// runMigrationStep executes a migration script and records the change in a single transaction.
+func (s *Storage) runMigrationStep(ctx context.Context, script, record string, args ...interface{}) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SchemaVersion retrieves the version of the latest applied migration, 0 meaning no migrations were applied.
+func (s *Storage) SchemaVersion() (int64, error) {
+	s.log.Debug().Msg("calling `SchemaVersion` method")
+	ctx, cancel := context.WithTimeout(s.syncUtils.Ctx, migrationTimeout)
+	defer cancel()
+
+	if err := s.ensureMigrationsTable(ctx); err != nil {
+		return 0, err
+	}
+	var version int64
+	err := s.DB.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		return 0, &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	return version, nil
+}
+
+// Migrate applies all pending migrations up to and including the given version, 0 meaning the latest one.
+func (s *Storage) Migrate(to int64) error {
+	s.log.Debug().Msg("calling `Migrate` method")
+	ctx, cancel := context.WithTimeout(s.syncUtils.Ctx, migrationTimeout)
+	defer cancel()
+	unlock, err := s.lock(ctx, migrationLockKey, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if err = s.ensureMigrationsTable(ctx); err != nil {
+		return err
+	}
+	applied, err := s.appliedVersions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if to > 0 && m.version > to {
+			break
+		}
+		if applied[m.version] {
+			continue
+		}
+		err = s.runMigrationStep(ctx, m.up,
+			"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+			m.version, m.name, time.Now().Format(time.RFC3339))
+		if err != nil {
+			s.log.Error().Err(err).Int64("version", m.version).Str("name", m.name).Msg("applying migration failed")
+			return &storageErrors.MigrationError{Err: err, Version: m.version}
+		}
+		s.log.Info().Int64("version", m.version).Str("name", m.name).Msg("migration applied")
+	}
+	return nil
+}
+
+// Rollback reverts applied migrations down to the given version exclusively, a negative value meaning that only
+// the latest applied migration is reverted.
+func (s *Storage) Rollback(to int64) error {
+	s.log.Debug().Msg("calling `Rollback` method")
+	ctx, cancel := context.WithTimeout(s.syncUtils.Ctx, migrationTimeout)
+	defer cancel()
+	unlock, err := s.lock(ctx, migrationLockKey, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	return s.rollback(ctx, migrations, to)
+}
+
+// rollback reverts applied migrations in a descending order.
+func (s *Storage) rollback(ctx context.Context, migrations []migration, to int64) error {
+	if err := s.ensureMigrationsTable(ctx); err != nil {
+		return err
+	}
+	applied, err := s.appliedVersions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if !applied[m.version] {
+			continue
+		}
+		if to >= 0 && m.version <= to {
+			break
+		}
+		err = s.runMigrationStep(ctx, m.down, "DELETE FROM schema_migrations WHERE version = $1", m.version)
+		if err != nil {
+			s.log.Error().Err(err).Int64("version", m.version).Str("name", m.name).Msg("reverting migration failed")
+			return &storageErrors.MigrationError{Err: err, Version: m.version}
+		}
+		s.log.Info().Int64("version", m.version).Str("name", m.name).Msg("migration reverted")
+		if to < 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// DropAll drops the DB tables reverting all applied migrations, the baseline migration is reverted unconditionally
+// to cover schemas created before versioned migrations were introduced.
+func (s *Storage) DropAll() error {
+	s.log.Debug().Msg("calling `DropAll` method")
+	ctx, cancel := context.WithTimeout(s.syncUtils.Ctx, migrationTimeout)
+	defer cancel()
+	unlock, err := s.lock(ctx, migrationLockKey, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if err = s.rollback(ctx, migrations, 0); err != nil {
+		return err
+	}
+	if len(migrations) > 0 {
+		_, err = s.DB.ExecContext(ctx, migrations[0].down)
+		if err != nil {
+			return &storageErrors.MigrationError{Err: err, Version: migrations[0].version}
+		}
+	}
+	_, err = s.DB.ExecContext(ctx, "DROP TABLE IF EXISTS schema_migrations;")
+	if err != nil {
+		return &storageErrors.ExecutionPSQLError{Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS processing;
+DROP TABLE IF EXISTS validation;
+DROP TABLE IF EXISTS products;
+DROP TABLE IF EXISTS files;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS users (
+	id            BIGSERIAL   NOT NULL UNIQUE,
+	user_id       TEXT        NOT NULL UNIQUE,
+	created_at    TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS files (
+	id           BIGSERIAL      NOT NULL UNIQUE,
+	user_id      TEXT           NOT NULL UNIQUE,
+	file_name    TEXT           NOT NULL UNIQUE,
+	updated_at   TIMESTAMPTZ    NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS products (
+	id            BIGSERIAL  NOT NULL UNIQUE,
+	user_id       TEXT       NOT NULL UNIQUE,
+	product_code  TEXT       NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS validation (
+	id           BIGSERIAL   NOT NULL UNIQUE,
+	file_name    TEXT        NOT NULL UNIQUE,
+	status       TEXT        NOT NULL,
+	updated_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS processing (
+	id           BIGSERIAL   NOT NULL UNIQUE,
+	file_name    TEXT        NOT NULL UNIQUE,
+	barcode      TEXT,
+	status       TEXT        NOT NULL,
+	updated_at   TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS files_user_id_current_idx;
+DROP INDEX IF EXISTS files_user_id_idx;
+
+DELETE FROM validation WHERE file_name IN (SELECT file_name FROM files WHERE NOT is_current);
+DELETE FROM processing WHERE file_name IN (SELECT file_name FROM files WHERE NOT is_current);
+DELETE FROM files WHERE NOT is_current;
+ALTER TABLE files DROP COLUMN IF EXISTS created_at;
+ALTER TABLE files DROP COLUMN IF EXISTS is_current;
+ALTER TABLE files ADD CONSTRAINT files_user_id_key UNIQUE (user_id);
@@ -0,0 +1,8 @@
+ALTER TABLE files DROP CONSTRAINT IF EXISTS files_user_id_key;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS is_current BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ;
+UPDATE files SET created_at = updated_at WHERE created_at IS NULL;
+ALTER TABLE files ALTER COLUMN created_at SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS files_user_id_idx ON files (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS files_user_id_current_idx ON files (user_id) WHERE is_current;
@@ -0,0 +1,4 @@
+ALTER TABLE validation DROP COLUMN IF EXISTS passed;
+ALTER TABLE validation DROP COLUMN IF EXISTS error_message;
+ALTER TABLE validation DROP COLUMN IF EXISTS sex;
+ALTER TABLE validation DROP COLUMN IF EXISTS mode;
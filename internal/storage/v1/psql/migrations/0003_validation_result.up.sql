@@ -0,0 +1,4 @@
+ALTER TABLE validation ADD COLUMN IF NOT EXISTS mode TEXT;
+ALTER TABLE validation ADD COLUMN IF NOT EXISTS sex TEXT;
+ALTER TABLE validation ADD COLUMN IF NOT EXISTS error_message TEXT;
+ALTER TABLE validation ADD COLUMN IF NOT EXISTS passed BOOLEAN;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS processing_status_idx;
+DROP INDEX IF EXISTS validation_status_idx;
+
+ALTER TABLE processing DROP COLUMN IF EXISTS heartbeat_at;
+ALTER TABLE validation DROP COLUMN IF EXISTS heartbeat_at;
@@ -0,0 +1,5 @@
+ALTER TABLE validation ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMPTZ;
+ALTER TABLE processing ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS validation_status_idx ON validation (status);
+CREATE INDEX IF NOT EXISTS processing_status_idx ON processing (status);
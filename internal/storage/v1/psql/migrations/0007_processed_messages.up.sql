@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS processed_messages (
+    message_id TEXT PRIMARY KEY,
+    kind TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    headers JSONB NOT NULL DEFAULT '{}',
+    response BYTEA NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS processed_messages_user_id_idx ON processed_messages (user_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS deletion_audit;
+DROP TABLE IF EXISTS artifacts;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS artifacts (
+    id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    barcode TEXT NOT NULL,
+    bucket TEXT NOT NULL,
+    key TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    sha256 TEXT NOT NULL,
+    uploaded_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (bucket, key)
+);
+CREATE INDEX IF NOT EXISTS artifacts_user_id_idx ON artifacts (user_id);
+
+CREATE TABLE IF NOT EXISTS deletion_audit (
+    id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    bucket TEXT NOT NULL,
+    key TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    deleted_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS deletion_audit_user_id_idx ON deletion_audit (user_id);
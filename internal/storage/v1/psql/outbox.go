@@ -0,0 +1,192 @@
+// Package psql provides PSQL storage service.
+
+package psql
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+	storageErrors "upload-service-auto/internal/storage/errors"
+	"upload-service-auto/internal/storage/v1/models"
+)
+
+// AddOutboxMessage saves a message to be published, it is meant to be called within the transaction saving the
+// change the message reports.
+func (s *Storage) AddOutboxMessage(ctx context.Context, msg *models.OutboxMessage) error {
+	s.log.Debug().Msg("calling `AddOutboxMessage` method")
+	headers, err := json.Marshal(msg.Headers)
+	if err != nil {
+		s.log.Error().Err(err).Str("exchange", msg.Exchange).Msg("could not serialize headers")
+		return err
+	}
+
+	addMessageStmt, err := s.conn(ctx).PrepareContext(ctx, `INSERT INTO outbox (exchange, content_type, headers, payload,
+		created_at) VALUES ($1, $2, $3, $4, $5)`)
+	if err != nil {
+		s.log.Error().Err(err).Str("exchange", msg.Exchange).Msg("could not prepare statement")
+		return &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer addMessageStmt.Close()
+	chanOk := make(chan bool)
+	chanEr := make(chan error)
+	go func() {
+		_, err := addMessageStmt.ExecContext(ctx, msg.Exchange, msg.ContentType, headers, msg.Payload,
+			time.Now().Format(time.RFC3339))
+		if err != nil {
+			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		chanOk <- true
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.log.Error().Err(ctx.Err()).Str("exchange", msg.Exchange).Msg("adding outbox message failed")
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case methodErr := <-chanEr:
+		s.log.Error().Err(methodErr).Str("exchange", msg.Exchange).Msg("adding outbox message failed")
+		return methodErr
+	case <-chanOk:
+		s.log.Debug().Str("exchange", msg.Exchange).Msg("adding outbox message done")
+		return nil
+	}
+}
+
+// GetOutboxMessages retrieves up to limit oldest messages to be published. Within a transaction the messages stay
+// locked until it ends and messages locked by other transactions are skipped, so that concurrent relays never
+// publish the same message at once.
+func (s *Storage) GetOutboxMessages(ctx context.Context, limit int) ([]models.OutboxMessage, error) {
+	s.log.Debug().Msg("calling `GetOutboxMessages` method")
+	getMessagesStmt, err := s.conn(ctx).PrepareContext(ctx, `SELECT id, exchange, content_type, headers, payload,
+		attempts, last_error, created_at
+		FROM outbox
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`)
+	if err != nil {
+		s.log.Error().Err(err).Msg("could not prepare statement")
+		return nil, &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer getMessagesStmt.Close()
+
+	chanOk := make(chan []models.OutboxMessage)
+	chanEr := make(chan error)
+	go func() {
+		rows, err := getMessagesStmt.QueryContext(ctx, limit)
+		if err != nil {
+			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+
+		var queryOutput []models.OutboxMessage
+		for rows.Next() {
+			var (
+				queryOutputRow models.OutboxMessage
+				headers        []byte
+			)
+			err = rows.Scan(
+				&queryOutputRow.ID,
+				&queryOutputRow.Exchange,
+				&queryOutputRow.ContentType,
+				&headers,
+				&queryOutputRow.Payload,
+				&queryOutputRow.Attempts,
+				&queryOutputRow.LastError,
+				&queryOutputRow.CreatedAt,
+			)
+			if err == nil {
+				err = json.Unmarshal(headers, &queryOutputRow.Headers)
+			}
+			if err != nil {
+				chanEr <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			queryOutput = append(queryOutput, queryOutputRow)
+		}
+		err = rows.Err()
+		if err != nil {
+			chanEr <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		chanOk <- queryOutput
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.log.Error().Err(ctx.Err()).Msg("getting outbox messages failed")
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case methodErr := <-chanEr:
+		s.log.Error().Err(methodErr).Msg("getting outbox messages failed")
+		return nil, methodErr
+	case result := <-chanOk:
+		s.log.Debug().Int("count", len(result)).Msg("getting outbox messages done")
+		return result, nil
+	}
+}
+
+// DeleteOutboxMessage removes a published message.
+func (s *Storage) DeleteOutboxMessage(ctx context.Context, id int64) error {
+	s.log.Debug().Msg("calling `DeleteOutboxMessage` method")
+	deleteMessageStmt, err := s.conn(ctx).PrepareContext(ctx, "DELETE FROM outbox WHERE id = $1")
+	if err != nil {
+		s.log.Error().Err(err).Int64("id", id).Msg("could not prepare statement")
+		return &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer deleteMessageStmt.Close()
+	chanOk := make(chan bool)
+	chanEr := make(chan error)
+	go func() {
+		_, err := deleteMessageStmt.ExecContext(ctx, id)
+		if err != nil {
+			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		chanOk <- true
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.log.Error().Err(ctx.Err()).Int64("id", id).Msg("deleting outbox message failed")
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case methodErr := <-chanEr:
+		s.log.Error().Err(methodErr).Int64("id", id).Msg("deleting outbox message failed")
+		return methodErr
+	case <-chanOk:
+		s.log.Debug().Int64("id", id).Msg("deleting outbox message done")
+		return nil
+	}
+}
+
+// RecordOutboxFailure counts a failed attempt to publish a message keeping its error.
+func (s *Storage) RecordOutboxFailure(ctx context.Context, id int64, reason string) error {
+	s.log.Debug().Msg("calling `RecordOutboxFailure` method")
+	failureStmt, err := s.conn(ctx).PrepareContext(ctx, "UPDATE outbox SET (attempts, last_error) = (attempts + 1, $1) WHERE id = $2")
+	if err != nil {
+		s.log.Error().Err(err).Int64("id", id).Msg("could not prepare statement")
+		return &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer failureStmt.Close()
+	chanOk := make(chan bool)
+	chanEr := make(chan error)
+	go func() {
+		_, err := failureStmt.ExecContext(ctx, reason, id)
+		if err != nil {
+			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		chanOk <- true
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.log.Error().Err(ctx.Err()).Int64("id", id).Msg("recording outbox failure failed")
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case methodErr := <-chanEr:
+		s.log.Error().Err(methodErr).Int64("id", id).Msg("recording outbox failure failed")
+		return methodErr
+	case <-chanOk:
+		s.log.Debug().Int64("id", id).Msg("recording outbox failure done")
+		return nil
+	}
+}
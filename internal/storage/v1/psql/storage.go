@@ -7,11 +7,11 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"sync"
 	"time"
 	"upload-service-auto/internal/config"
 	"upload-service-auto/internal/constants"
 	storageErrors "upload-service-auto/internal/storage/errors"
+	"upload-service-auto/internal/storage/v1/models"
 	"upload-service-auto/internal/syncutils"
 
 	"github.com/jackc/pgconn"
@@ -22,7 +22,6 @@ import (
 
 // Storage defines a new object and sets its attributes.
 type Storage struct {
-	mu        sync.Mutex
 	cfg       *config.Config
 	DB        *sql.DB
 	log       *zerolog.Logger
@@ -40,96 +39,6 @@ func (s *Storage) checkInSlice(slice []string, value string) bool {
 	return false
 }
 
-// DropAll drops the DB tables.
-func (s *Storage) DropAll() error {
-	s.log.Debug().Msg("calling `DropAll` method")
-	ctx, cancel := context.WithTimeout(s.syncUtils.Ctx, 1000*time.Millisecond)
-	defer cancel()
-	defer s.syncUtils.SyncCancel()
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	var queries []string
-	query := `DROP TABLE IF  EXISTS users;`
-	queries = append(queries, query)
-
-	query = `DROP TABLE IF EXISTS files ;`
-	queries = append(queries, query)
-
-	query = `DROP TABLE IF EXISTS products;`
-	queries = append(queries, query)
-
-	query = `DROP TABLE IF EXISTS validation;`
-	queries = append(queries, query)
-
-	query = `DROP TABLE IF EXISTS processing;`
-	queries = append(queries, query)
-
-	for _, subquery := range queries {
-		_, err := s.DB.ExecContext(ctx, subquery)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-// Migrate creates the DB tables.
-func (s *Storage) Migrate() error {
-	s.log.Debug().Msg("calling `Migrate` method")
-	ctx, cancel := context.WithTimeout(s.syncUtils.Ctx, 1000*time.Millisecond)
-	defer cancel()
-	defer s.syncUtils.SyncCancel()
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	var queries []string
-	query := `CREATE TABLE IF NOT EXISTS users (
-		id            BIGSERIAL   NOT NULL UNIQUE,
-		user_id       TEXT        NOT NULL UNIQUE,
-		created_at TIMESTAMPTZ NOT NULL  
-	);`
-	queries = append(queries, query)
-
-	query = `CREATE TABLE IF NOT EXISTS files (
-		id           BIGSERIAL      NOT NULL UNIQUE,
-		user_id      TEXT           NOT NULL UNIQUE,
-		file_name    TEXT           NOT NULL UNIQUE,
-		updated_at   TIMESTAMPTZ    NOT NULL  
-	);`
-	queries = append(queries, query)
-
-	query = `CREATE TABLE IF NOT EXISTS products (
-		id            BIGSERIAL  NOT NULL UNIQUE,
-		user_id       TEXT       NOT NULL UNIQUE,
-		product_code  TEXT       NOT NULL
-	);`
-	queries = append(queries, query)
-
-	query = `CREATE TABLE IF NOT EXISTS validation (
-		id           BIGSERIAL   NOT NULL UNIQUE,
-		file_name    TEXT        NOT NULL UNIQUE,
-		status       TEXT        NOT NULL,
-		updated_at   TIMESTAMPTZ NOT NULL  
-	);`
-	queries = append(queries, query)
-
-	query = `CREATE TABLE IF NOT EXISTS processing (
-		id           BIGSERIAL   NOT NULL UNIQUE,
-		file_name    TEXT        NOT NULL UNIQUE,
-		barcode      TEXT,
-		status       TEXT        NOT NULL,
-		updated_at   TIMESTAMPTZ NOT NULL
-	);`
-	queries = append(queries, query)
-
-	for _, subquery := range queries {
-		_, err := s.DB.ExecContext(ctx, subquery)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 // NewStorage initializes a new Storage instance.
 func NewStorage(cfg *config.Config, logger *zerolog.Logger, syncUtils *syncutils.SyncUtils) *Storage {
 	logger.Debug().Msg("calling initializer of storage service")
@@ -159,46 +68,70 @@ func NewStorage(cfg *config.Config, logger *zerolog.Logger, syncUtils *syncutils
 	return &st
 }
 
-// RemoveUserData removes all data for one user.
-func (s *Storage) RemoveUserData(ctx context.Context, userID, fileName string) error {
+// RemoveUserData removes all data for one user including all of their uploads and records of their artifacts, the
+// deletion audit is kept.
+func (s *Storage) RemoveUserData(ctx context.Context, userID string) error {
 	s.log.Debug().Msg("calling `RemoveUserData` method")
-	newDeleteStmtUsers, err := s.DB.PrepareContext(ctx, "DELETE FROM users WHERE user_id = $1")
+	return s.WithinTx(ctx, func(ctx context.Context) error {
+		return s.removeUserData(ctx, userID)
+	})
+}
+
+// removeUserData removes all data for one user within an ongoing transaction.
+func (s *Storage) removeUserData(ctx context.Context, userID string) error {
+	newDeleteStmtValidation, err := s.conn(ctx).PrepareContext(ctx, "DELETE FROM validation WHERE file_name IN (SELECT file_name FROM files WHERE user_id = $1)")
 	if err != nil {
 		s.log.Error().Err(err).Str("userID", userID).Msg("could not prepare statement")
 		return &storageErrors.StatementPSQLError{Err: err}
 	}
-	defer newDeleteStmtUsers.Close()
-	newDeleteStmtFiles, err := s.DB.PrepareContext(ctx, "DELETE FROM files WHERE user_id = $1")
+	defer newDeleteStmtValidation.Close()
+	newDeleteStmtProcessing, err := s.conn(ctx).PrepareContext(ctx, "DELETE FROM processing WHERE file_name IN (SELECT file_name FROM files WHERE user_id = $1)")
+	if err != nil {
+		s.log.Error().Err(err).Str("userID", userID).Msg("could not prepare statement")
+		return &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer newDeleteStmtProcessing.Close()
+	newDeleteStmtFiles, err := s.conn(ctx).PrepareContext(ctx, "DELETE FROM files WHERE user_id = $1")
 	if err != nil {
 		s.log.Error().Err(err).Str("userID", userID).Msg("could not prepare statement")
 		return &storageErrors.StatementPSQLError{Err: err}
 	}
 	defer newDeleteStmtFiles.Close()
-	newDeleteStmtProducts, err := s.DB.PrepareContext(ctx, "DELETE FROM products WHERE user_id = $1")
+	newDeleteStmtProducts, err := s.conn(ctx).PrepareContext(ctx, "DELETE FROM products WHERE user_id = $1")
 	if err != nil {
 		s.log.Error().Err(err).Str("userID", userID).Msg("could not prepare statement")
 		return &storageErrors.StatementPSQLError{Err: err}
 	}
 	defer newDeleteStmtProducts.Close()
-	newDeleteStmtValidation, err := s.DB.PrepareContext(ctx, "DELETE FROM validation WHERE file_name = $1")
+	newDeleteStmtUsers, err := s.conn(ctx).PrepareContext(ctx, "DELETE FROM users WHERE user_id = $1")
 	if err != nil {
 		s.log.Error().Err(err).Str("userID", userID).Msg("could not prepare statement")
 		return &storageErrors.StatementPSQLError{Err: err}
 	}
-	defer newDeleteStmtValidation.Close()
-	newDeleteStmtProcessing, err := s.DB.PrepareContext(ctx, "DELETE FROM processing WHERE file_name = $1")
+	defer newDeleteStmtUsers.Close()
+	newDeleteStmtMessages, err := s.conn(ctx).PrepareContext(ctx, "DELETE FROM processed_messages WHERE user_id = $1")
 	if err != nil {
 		s.log.Error().Err(err).Str("userID", userID).Msg("could not prepare statement")
 		return &storageErrors.StatementPSQLError{Err: err}
 	}
-	defer newDeleteStmtProcessing.Close()
+	defer newDeleteStmtMessages.Close()
+	newDeleteStmtArtifacts, err := s.conn(ctx).PrepareContext(ctx, "DELETE FROM artifacts WHERE user_id = $1")
+	if err != nil {
+		s.log.Error().Err(err).Str("userID", userID).Msg("could not prepare statement")
+		return &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer newDeleteStmtArtifacts.Close()
 	chanOk := make(chan bool)
 	chanEr := make(chan error)
 
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
-		_, err := newDeleteStmtUsers.ExecContext(ctx, userID)
+		_, err := newDeleteStmtValidation.ExecContext(ctx, userID)
+		if err != nil {
+			chanEr <- err
+			return
+		}
+
+		_, err = newDeleteStmtProcessing.ExecContext(ctx, userID)
 		if err != nil {
 			chanEr <- err
 			return
@@ -216,13 +149,19 @@ func (s *Storage) RemoveUserData(ctx context.Context, userID, fileName string) e
 			return
 		}
 
-		_, err = newDeleteStmtValidation.ExecContext(ctx, fileName)
+		_, err = newDeleteStmtUsers.ExecContext(ctx, userID)
+		if err != nil {
+			chanEr <- err
+			return
+		}
+
+		_, err = newDeleteStmtMessages.ExecContext(ctx, userID)
 		if err != nil {
 			chanEr <- err
 			return
 		}
 
-		_, err = newDeleteStmtProcessing.ExecContext(ctx, fileName)
+		_, err = newDeleteStmtArtifacts.ExecContext(ctx, userID)
 		if err != nil {
 			chanEr <- err
 			return
@@ -246,7 +185,7 @@ func (s *Storage) RemoveUserData(ctx context.Context, userID, fileName string) e
 // GetAllUserIDs retrieves all user identifiers currently stored in DB.
 func (s *Storage) GetAllUserIDs(ctx context.Context) ([]string, error) {
 	s.log.Debug().Msg("calling `GetAllUserIDs` method")
-	getUsersStmt, err := s.DB.PrepareContext(ctx, "SELECT user_id from users")
+	getUsersStmt, err := s.conn(ctx).PrepareContext(ctx, "SELECT user_id from users")
 	if err != nil {
 		s.log.Error().Err(err).Msg("could not prepare statement")
 		return nil, &storageErrors.StatementPSQLError{Err: err}
@@ -256,8 +195,6 @@ func (s *Storage) GetAllUserIDs(ctx context.Context) ([]string, error) {
 	chanOk := make(chan []string)
 	chanEr := make(chan error)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
 		rows, err := getUsersStmt.QueryContext(ctx)
 		if err != nil {
 			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
@@ -297,7 +234,7 @@ func (s *Storage) GetAllUserIDs(ctx context.Context) ([]string, error) {
 // AddNewUserID adds a new user to DB.
 func (s *Storage) AddNewUserID(ctx context.Context, userID string) error {
 	s.log.Debug().Msg("calling `AddNewUserID` method")
-	newUserStmt, err := s.DB.PrepareContext(ctx, "INSERT INTO users (user_id, created_at) VALUES ($1, $2)")
+	newUserStmt, err := s.conn(ctx).PrepareContext(ctx, "INSERT INTO users (user_id, created_at) VALUES ($1, $2)")
 	if err != nil {
 		s.log.Error().Err(err).Str("userID", userID).Msg("could not prepare statement")
 		return &storageErrors.StatementPSQLError{Err: err}
@@ -306,8 +243,6 @@ func (s *Storage) AddNewUserID(ctx context.Context, userID string) error {
 	chanOk := make(chan bool)
 	chanEr := make(chan error)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
 		_, err := newUserStmt.ExecContext(ctx, userID, time.Now().Format(time.RFC3339))
 		if err != nil {
 			if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation {
@@ -336,7 +271,7 @@ func (s *Storage) AddNewUserID(ctx context.Context, userID string) error {
 // CheckUserID checks that a user is stored in DB.
 func (s *Storage) CheckUserID(ctx context.Context, userID string) error {
 	s.log.Debug().Msg("calling `CheckUserID` method")
-	checkUserStmt, err := s.DB.PrepareContext(ctx, "SELECT COUNT(1) > 0 from users where user_id = $1")
+	checkUserStmt, err := s.conn(ctx).PrepareContext(ctx, "SELECT COUNT(1) > 0 from users where user_id = $1")
 	if err != nil {
 		s.log.Error().Err(err).Str("userID", userID).Msg("could not prepare statement")
 		return &storageErrors.StatementPSQLError{Err: err}
@@ -345,8 +280,6 @@ func (s *Storage) CheckUserID(ctx context.Context, userID string) error {
 	chanOk := make(chan bool)
 	chanEr := make(chan error)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
 		var userIsPresent bool
 		err := checkUserStmt.QueryRowContext(ctx, userID).Scan(&userIsPresent)
 		if err != nil {
@@ -373,10 +306,28 @@ func (s *Storage) CheckUserID(ctx context.Context, userID string) error {
 	}
 }
 
-// AddNewUserFilePair creates a new user-file entry.
+// AddNewUserFilePair creates a new user-file entry and marks it as the current upload of the user, previous
+// uploads are kept in history. A file uploaded by the user already becomes the current upload again, a file of
+// another user is reported with AlreadyExistsError.
 func (s *Storage) AddNewUserFilePair(ctx context.Context, userID, fileName string) error {
 	s.log.Debug().Msg("calling `AddNewUserFilePair` method")
-	newFileStmt, err := s.DB.PrepareContext(ctx, "INSERT INTO files (user_id, file_name, updated_at) VALUES ($1, $2, $3)")
+	return s.WithinTx(ctx, func(ctx context.Context) error {
+		return s.addNewUserFilePair(ctx, userID, fileName)
+	})
+}
+
+// addNewUserFilePair creates or restores a current user-file entry within an ongoing transaction.
+func (s *Storage) addNewUserFilePair(ctx context.Context, userID, fileName string) error {
+	unsetCurrentStmt, err := s.conn(ctx).PrepareContext(ctx, "UPDATE files SET (is_current, updated_at) = (FALSE, $1) WHERE user_id = $2 AND is_current")
+	if err != nil {
+		s.log.Error().Err(err).Str("userID", userID).Msg("could not prepare statement")
+		return &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer unsetCurrentStmt.Close()
+	newFileStmt, err := s.conn(ctx).PrepareContext(ctx, `INSERT INTO files (user_id, file_name, is_current,
+		created_at, updated_at) VALUES ($1, $2, TRUE, $3, $3)
+		ON CONFLICT (file_name) DO UPDATE SET is_current = TRUE, updated_at = EXCLUDED.updated_at
+		WHERE files.user_id = EXCLUDED.user_id`)
 	if err != nil {
 		s.log.Error().Err(err).Str("userID", userID).Msg("could not prepare statement")
 		return &storageErrors.StatementPSQLError{Err: err}
@@ -385,17 +336,32 @@ func (s *Storage) AddNewUserFilePair(ctx context.Context, userID, fileName strin
 	chanOk := make(chan bool)
 	chanEr := make(chan error)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
-		_, err := newFileStmt.ExecContext(ctx, userID, fileName, time.Now().Format(time.RFC3339))
+		now := time.Now().Format(time.RFC3339)
+		_, err := unsetCurrentStmt.ExecContext(ctx, now, userID)
+		if err != nil {
+			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+
+		res, err := newFileStmt.ExecContext(ctx, userID, fileName, now)
 		if err != nil {
 			if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation {
-				chanEr <- &storageErrors.AlreadyExistsError{Err: err, ID: userID}
+				chanEr <- &storageErrors.AlreadyExistsError{Err: err, ID: fileName}
 				return
 			}
 			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
 			return
 		}
+		// the conflicting row is left as it is if it belongs to another user
+		affected, err := res.RowsAffected()
+		if err != nil {
+			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		if affected == 0 {
+			chanEr <- &storageErrors.AlreadyExistsError{Err: errors.New("file belongs to another user"), ID: fileName}
+			return
+		}
 		chanOk <- true
 	}()
 
@@ -412,86 +378,116 @@ func (s *Storage) AddNewUserFilePair(ctx context.Context, userID, fileName strin
 	}
 }
 
-// UpdateUserFilePair updates a user-file pair with a new file.
-func (s *Storage) UpdateUserFilePair(ctx context.Context, userID, fileName string) error {
-	s.log.Debug().Msg("calling `UpdateUserFilePair` method")
-	updateFileStmt, err := s.DB.PrepareContext(ctx, "UPDATE files SET (file_name, updated_at) = ($1, $2) WHERE user_id = $3")
+// GetFileNameForUser retrieves the current filename for a user.
+func (s *Storage) GetFileNameForUser(ctx context.Context, userID string) (string, error) {
+	s.log.Debug().Msg("calling `GetFileNameForUser` method")
+	getFileStmt, err := s.conn(ctx).PrepareContext(ctx, "SELECT file_name FROM files WHERE user_id = $1 AND is_current")
 	if err != nil {
 		s.log.Error().Err(err).Str("userID", userID).Msg("could not prepare statement")
-		return &storageErrors.StatementPSQLError{Err: err}
+		return "", &storageErrors.StatementPSQLError{Err: err}
 	}
-	defer updateFileStmt.Close()
-	chanOk := make(chan bool)
+	defer getFileStmt.Close()
+	chanOk := make(chan string)
 	chanEr := make(chan error)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
-		_, err := updateFileStmt.ExecContext(ctx, fileName, time.Now().Format(time.RFC3339), userID)
+
+		var fileName string
+		err := getFileStmt.QueryRowContext(ctx, userID).Scan(&fileName)
 		if err != nil {
-			if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation {
-				chanEr <- &storageErrors.AlreadyExistsError{Err: err, ID: userID}
+			if err == sql.ErrNoRows {
+				chanEr <- &storageErrors.NotFoundError{Err: errors.New("file was not found")}
 				return
 			}
 			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
 			return
 		}
-		chanOk <- true
+		chanOk <- fileName
 	}()
 
 	select {
 	case <-ctx.Done():
-		s.log.Error().Err(ctx.Err()).Str("userID", userID).Msg("updating new file failed")
-		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		s.log.Error().Err(ctx.Err()).Str("userID", userID).Msg("getting filename failed")
+		return "", &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
 	case methodErr := <-chanEr:
-		s.log.Error().Err(methodErr).Str("userID", userID).Msg("updating new file failed")
-		return methodErr
-	case <-chanOk:
-		s.log.Info().Str("userID", userID).Msg("updating new file done")
-		return nil
+		s.log.Error().Err(methodErr).Str("userID", userID).Msg("getting filename file failed")
+		return "", methodErr
+	case result := <-chanOk:
+		s.log.Info().Str("userID", userID).Msg("getting filename file done")
+		return result, nil
 	}
 }
 
-// GetFileNameForUser retrieves an active filename for a user.
-func (s *Storage) GetFileNameForUser(ctx context.Context, userID string) (string, error) {
-	s.log.Debug().Msg("calling `GetFileNameForUser` method")
-	getFileStmt, err := s.DB.PrepareContext(ctx, "SELECT file_name FROM files WHERE user_id = $1")
+// GetUserUploads retrieves all uploads of a user along with their validation and processing statuses in time order.
+func (s *Storage) GetUserUploads(ctx context.Context, userID string) ([]models.Upload, error) {
+	s.log.Debug().Msg("calling `GetUserUploads` method")
+	getUploadsStmt, err := s.conn(ctx).PrepareContext(ctx, `SELECT f.file_name, f.is_current, f.created_at,
+		COALESCE(v.status, $2), COALESCE(p.barcode, ''), COALESCE(p.status, $2)
+		FROM files f
+		LEFT JOIN validation v ON v.file_name = f.file_name
+		LEFT JOIN processing p ON p.file_name = f.file_name
+		WHERE f.user_id = $1
+		ORDER BY f.created_at, f.id`)
 	if err != nil {
 		s.log.Error().Err(err).Str("userID", userID).Msg("could not prepare statement")
-		return "", &storageErrors.StatementPSQLError{Err: err}
+		return nil, &storageErrors.StatementPSQLError{Err: err}
 	}
-	defer getFileStmt.Close()
-	chanOk := make(chan string)
+	defer getUploadsStmt.Close()
+
+	chanOk := make(chan []models.Upload)
 	chanEr := make(chan error)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
-
-		var fileName string
-		err := getFileStmt.QueryRowContext(ctx, userID).Scan(&fileName)
+		rows, err := getUploadsStmt.QueryContext(ctx, userID, constants.NA)
 		if err != nil {
 			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
 			return
 		}
-		chanOk <- fileName
+		defer rows.Close()
+
+		var queryOutput []models.Upload
+		for rows.Next() {
+			var queryOutputRow models.Upload
+			err = rows.Scan(
+				&queryOutputRow.FileName,
+				&queryOutputRow.IsCurrent,
+				&queryOutputRow.CreatedAt,
+				&queryOutputRow.ValidationStatus,
+				&queryOutputRow.Barcode,
+				&queryOutputRow.ProcessingStatus,
+			)
+			if err != nil {
+				chanEr <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			queryOutput = append(queryOutput, queryOutputRow)
+		}
+		err = rows.Err()
+		if err != nil {
+			chanEr <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		chanOk <- queryOutput
 	}()
 
 	select {
 	case <-ctx.Done():
-		s.log.Error().Err(ctx.Err()).Str("userID", userID).Msg("getting filename failed")
-		return "", &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+		s.log.Error().Err(ctx.Err()).Str("userID", userID).Msg("getting user uploads failed")
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
 	case methodErr := <-chanEr:
-		s.log.Error().Err(methodErr).Str("userID", userID).Msg("getting filename file failed")
-		return "", methodErr
+		s.log.Error().Err(methodErr).Str("userID", userID).Msg("getting user uploads failed")
+		return nil, methodErr
 	case result := <-chanOk:
-		s.log.Info().Str("userID", userID).Msg("getting filename file done")
+		s.log.Info().Str("userID", userID).Msg("getting user uploads done")
 		return result, nil
 	}
 }
 
-// AddNewValidationEntry adds new validation data.
+// AddNewValidationEntry adds new validation data, an existing entry of the file is reset to the new status.
 func (s *Storage) AddNewValidationEntry(ctx context.Context, fileName string) error {
 	s.log.Debug().Msg("calling `AddNewValidationEntry` method")
-	newEntryStmt, err := s.DB.PrepareContext(ctx, "INSERT INTO validation (file_name, status, updated_at) VALUES ($1, $2, $3)")
+	newEntryStmt, err := s.conn(ctx).PrepareContext(ctx, `INSERT INTO validation (file_name, status, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (file_name) DO UPDATE SET status = EXCLUDED.status, mode = NULL, sex = NULL,
+		error_message = NULL, passed = NULL, updated_at = EXCLUDED.updated_at`)
 	if err != nil {
 		s.log.Error().Err(err).Str("fileName", fileName).Msg("could not prepare statement")
 		return &storageErrors.StatementPSQLError{Err: err}
@@ -500,8 +496,6 @@ func (s *Storage) AddNewValidationEntry(ctx context.Context, fileName string) er
 	chanOk := make(chan bool)
 	chanEr := make(chan error)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
 		_, err := newEntryStmt.ExecContext(ctx, fileName, constants.ValidationStatusNew, time.Now().Format(time.RFC3339))
 		if err != nil {
 			if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation {
@@ -536,7 +530,7 @@ func (s *Storage) UpdateValidationStatus(ctx context.Context, fileName, status s
 		return err
 	}
 
-	updateValidityStmt, err := s.DB.PrepareContext(ctx, "UPDATE validation SET (status, updated_at) = ($1, $2) WHERE file_name = $3")
+	updateValidityStmt, err := s.conn(ctx).PrepareContext(ctx, "UPDATE validation SET (status, updated_at) = ($1, $2) WHERE file_name = $3")
 	if err != nil {
 		s.log.Error().Err(err).Str("fileName", fileName).Msg("could not prepare statement")
 		return &storageErrors.StatementPSQLError{Err: err}
@@ -545,8 +539,6 @@ func (s *Storage) UpdateValidationStatus(ctx context.Context, fileName, status s
 	chanOk := make(chan bool)
 	chanEr := make(chan error)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
 		_, err := updateValidityStmt.ExecContext(ctx, status, time.Now().Format(time.RFC3339), fileName)
 		if err != nil {
 			if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation {
@@ -572,10 +564,105 @@ func (s *Storage) UpdateValidationStatus(ctx context.Context, fileName, status s
 	}
 }
 
+// UpdateValidationResult updates validation status for a file along with the result reported by the validator.
+func (s *Storage) UpdateValidationResult(ctx context.Context, validation *models.Validation) error {
+	s.log.Debug().Msg("calling `UpdateValidationResult` method")
+	fileName := validation.FileName
+	if !s.checkInSlice(constants.ValidValidationStatuses, validation.Status) {
+		err := errors.New("invalid status")
+		s.log.Error().Err(err).Str("fileName", fileName).Msg(fmt.Sprintf("status %s is invalid", validation.Status))
+		return err
+	}
+
+	updateResultStmt, err := s.conn(ctx).PrepareContext(ctx, "UPDATE validation SET (status, mode, sex, error_message, passed, updated_at) = ($1, $2, $3, $4, $5, $6) WHERE file_name = $7")
+	if err != nil {
+		s.log.Error().Err(err).Str("fileName", fileName).Msg("could not prepare statement")
+		return &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer updateResultStmt.Close()
+	chanOk := make(chan bool)
+	chanEr := make(chan error)
+	go func() {
+		_, err := updateResultStmt.ExecContext(
+			ctx,
+			validation.Status,
+			validation.Mode,
+			validation.Sex,
+			validation.Err,
+			validation.Passed,
+			time.Now().Format(time.RFC3339),
+			fileName,
+		)
+		if err != nil {
+			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		chanOk <- true
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.log.Error().Err(ctx.Err()).Str("fileName", fileName).Msg("updating validation result failed")
+		return &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case methodErr := <-chanEr:
+		s.log.Error().Err(methodErr).Str("fileName", fileName).Msg("updating validation result failed")
+		return methodErr
+	case <-chanOk:
+		s.log.Info().Str("fileName", fileName).Msg("updating validation result done")
+		return nil
+	}
+}
+
+// GetValidationResult retrieves validation status and result for a file.
+func (s *Storage) GetValidationResult(ctx context.Context, fileName string) (*models.Validation, error) {
+	s.log.Debug().Msg("calling `GetValidationResult` method")
+	getResultStmt, err := s.conn(ctx).PrepareContext(ctx, `SELECT status, COALESCE(mode, ''), COALESCE(sex, ''),
+		COALESCE(error_message, ''), COALESCE(passed, FALSE), updated_at FROM validation WHERE file_name = $1`)
+	if err != nil {
+		s.log.Error().Err(err).Str("fileName", fileName).Msg("could not prepare statement")
+		return nil, &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer getResultStmt.Close()
+	chanOk := make(chan *models.Validation)
+	chanEr := make(chan error)
+	go func() {
+		validation := models.Validation{FileName: fileName}
+		err := getResultStmt.QueryRowContext(ctx, fileName).Scan(
+			&validation.Status,
+			&validation.Mode,
+			&validation.Sex,
+			&validation.Err,
+			&validation.Passed,
+			&validation.UpdatedAt,
+		)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				chanEr <- &storageErrors.NotFoundError{Err: err}
+				return
+			}
+			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		chanOk <- &validation
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.log.Error().Err(ctx.Err()).Str("fileName", fileName).Msg("getting validation result failed")
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case methodErr := <-chanEr:
+		s.log.Error().Err(methodErr).Str("fileName", fileName).Msg("getting validation result failed")
+		return nil, methodErr
+	case result := <-chanOk:
+		s.log.Info().Str("fileName", fileName).Msg("getting validation result done")
+		return result, nil
+	}
+}
+
 // CheckIsValid checks that validation is completed and the file is valid for further processing.
 func (s *Storage) CheckIsValid(ctx context.Context, fileName string) error {
 	s.log.Debug().Msg("calling `CheckIsValid` method")
-	checkValidityStmt, err := s.DB.PrepareContext(ctx, "SELECT COUNT(1) > 0 from validation where file_name = $1 AND status = $2")
+	checkValidityStmt, err := s.conn(ctx).PrepareContext(ctx, "SELECT COUNT(1) > 0 from validation where file_name = $1 AND status = $2")
 	if err != nil {
 		s.log.Error().Err(err).Str("fileName", fileName).Msg("could not prepare statement")
 		return &storageErrors.StatementPSQLError{Err: err}
@@ -584,8 +671,6 @@ func (s *Storage) CheckIsValid(ctx context.Context, fileName string) error {
 	chanOk := make(chan bool)
 	chanEr := make(chan error)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
 		var fileIsValid bool
 		err := checkValidityStmt.QueryRowContext(ctx, fileName, constants.ValidationStatusValid).Scan(&fileIsValid)
 		if err != nil {
@@ -615,7 +700,7 @@ func (s *Storage) CheckIsValid(ctx context.Context, fileName string) error {
 // AddNewProcessingEntry adds new processing entry to DB.
 func (s *Storage) AddNewProcessingEntry(ctx context.Context, fileName, barcode string) error {
 	s.log.Debug().Msg("calling `AddNewProcessingEntry` method")
-	newEntryStmt, err := s.DB.PrepareContext(ctx, "INSERT INTO processing (file_name, barcode, status, updated_at) VALUES ($1, $2, $3, $4)")
+	newEntryStmt, err := s.conn(ctx).PrepareContext(ctx, "INSERT INTO processing (file_name, barcode, status, updated_at) VALUES ($1, $2, $3, $4)")
 	if err != nil {
 		s.log.Error().Err(err).Str("fileName", fileName).Str("barcode", barcode).Msg("could not prepare statement")
 		return &storageErrors.StatementPSQLError{Err: err}
@@ -624,8 +709,6 @@ func (s *Storage) AddNewProcessingEntry(ctx context.Context, fileName, barcode s
 	chanOk := make(chan bool)
 	chanEr := make(chan error)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
 		_, err := newEntryStmt.ExecContext(ctx, fileName, barcode, constants.ProcessingStatusNew, time.Now().Format(time.RFC3339))
 		if err != nil {
 			if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation {
@@ -660,7 +743,7 @@ func (s *Storage) UpdateProcessingStatus(ctx context.Context, fileName, status s
 		return err
 	}
 
-	updateProcessingStmt, err := s.DB.PrepareContext(ctx, "UPDATE processing SET (status, updated_at) = ($1, $2) WHERE file_name = $3")
+	updateProcessingStmt, err := s.conn(ctx).PrepareContext(ctx, "UPDATE processing SET (status, updated_at) = ($1, $2) WHERE file_name = $3")
 	if err != nil {
 		s.log.Error().Err(err).Str("fileName", fileName).Msg("could not prepare statement")
 		return &storageErrors.StatementPSQLError{Err: err}
@@ -669,8 +752,6 @@ func (s *Storage) UpdateProcessingStatus(ctx context.Context, fileName, status s
 	chanOk := make(chan bool)
 	chanEr := make(chan error)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
 		_, err := updateProcessingStmt.ExecContext(ctx, status, time.Now().Format(time.RFC3339), fileName)
 		if err != nil {
 			if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation {
@@ -699,7 +780,7 @@ func (s *Storage) UpdateProcessingStatus(ctx context.Context, fileName, status s
 // GetProcessingStatus retrieves processing status for a file.
 func (s *Storage) GetProcessingStatus(ctx context.Context, fileName string) (string, error) {
 	s.log.Debug().Msg("calling `GetProcessingStatus` method")
-	checkProcessingStmt, err := s.DB.PrepareContext(ctx, "SELECT status from processing where file_name = $1")
+	checkProcessingStmt, err := s.conn(ctx).PrepareContext(ctx, "SELECT status from processing where file_name = $1")
 	if err != nil {
 		s.log.Error().Err(err).Str("fileName", fileName).Msg("could not prepare statement")
 		return "", &storageErrors.StatementPSQLError{Err: err}
@@ -708,8 +789,6 @@ func (s *Storage) GetProcessingStatus(ctx context.Context, fileName string) (str
 	chanOk := make(chan string)
 	chanEr := make(chan error)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
 		var processingStatus string
 		err := checkProcessingStmt.QueryRowContext(ctx, fileName).Scan(&processingStatus)
 		if err != nil {
@@ -736,10 +815,71 @@ func (s *Storage) GetProcessingStatus(ctx context.Context, fileName string) (str
 	}
 }
 
+// GetProcessingEntries retrieves processing records of all files along with the users who uploaded them.
+func (s *Storage) GetProcessingEntries(ctx context.Context) ([]models.Processing, error) {
+	s.log.Debug().Msg("calling `GetProcessingEntries` method")
+	getEntriesStmt, err := s.conn(ctx).PrepareContext(ctx, `SELECT p.file_name, COALESCE(f.user_id, ''),
+		COALESCE(p.barcode, ''), p.status, p.updated_at
+		FROM processing p
+		LEFT JOIN files f ON f.file_name = p.file_name
+		ORDER BY p.id`)
+	if err != nil {
+		s.log.Error().Err(err).Msg("could not prepare statement")
+		return nil, &storageErrors.StatementPSQLError{Err: err}
+	}
+	defer getEntriesStmt.Close()
+
+	chanOk := make(chan []models.Processing)
+	chanEr := make(chan error)
+	go func() {
+		rows, err := getEntriesStmt.QueryContext(ctx)
+		if err != nil {
+			chanEr <- &storageErrors.ExecutionPSQLError{Err: err}
+			return
+		}
+		defer rows.Close()
+
+		var queryOutput []models.Processing
+		for rows.Next() {
+			var queryOutputRow models.Processing
+			err = rows.Scan(
+				&queryOutputRow.FileName,
+				&queryOutputRow.UserID,
+				&queryOutputRow.Barcode,
+				&queryOutputRow.Status,
+				&queryOutputRow.UpdatedAt,
+			)
+			if err != nil {
+				chanEr <- &storageErrors.ScanningPSQLError{Err: err}
+				return
+			}
+			queryOutput = append(queryOutput, queryOutputRow)
+		}
+		err = rows.Err()
+		if err != nil {
+			chanEr <- &storageErrors.ScanningPSQLError{Err: err}
+			return
+		}
+		chanOk <- queryOutput
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.log.Error().Err(ctx.Err()).Msg("getting processing entries failed")
+		return nil, &storageErrors.ContextTimeoutExceededError{Err: ctx.Err()}
+	case methodErr := <-chanEr:
+		s.log.Error().Err(methodErr).Msg("getting processing entries failed")
+		return nil, methodErr
+	case result := <-chanOk:
+		s.log.Info().Int("count", len(result)).Msg("getting processing entries done")
+		return result, nil
+	}
+}
+
 // AddNewProductCode adds a new product code for a user to DB.
 func (s *Storage) AddNewProductCode(ctx context.Context, userID, productCode string) error {
 	s.log.Debug().Msg("calling `AddNewProductCode` method")
-	newProdCodeStmt, err := s.DB.PrepareContext(ctx, "INSERT INTO products (user_id, product_code) VALUES ($1, $2)")
+	newProdCodeStmt, err := s.conn(ctx).PrepareContext(ctx, "INSERT INTO products (user_id, product_code) VALUES ($1, $2)")
 	if err != nil {
 		s.log.Error().Err(err).Str("userID", userID).Str("productCode", productCode).Msg("could not prepare statement")
 		return &storageErrors.StatementPSQLError{Err: err}
@@ -748,8 +888,6 @@ func (s *Storage) AddNewProductCode(ctx context.Context, userID, productCode str
 	chanOk := make(chan bool)
 	chanEr := make(chan error)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
 		_, err := newProdCodeStmt.ExecContext(ctx, userID, productCode)
 		if err != nil {
 			if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation {
@@ -778,7 +916,7 @@ func (s *Storage) AddNewProductCode(ctx context.Context, userID, productCode str
 // UpdateProductCode updates a product code for a user.
 func (s *Storage) UpdateProductCode(ctx context.Context, userID, productCode string) error {
 	s.log.Debug().Msg("calling `UpdateProductCode` method")
-	updProdCodeStmt, err := s.DB.PrepareContext(ctx, "UPDATE products set product_code = $1 where user_id = $2")
+	updProdCodeStmt, err := s.conn(ctx).PrepareContext(ctx, "UPDATE products set product_code = $1 where user_id = $2")
 	if err != nil {
 		s.log.Error().Err(err).Str("userID", userID).Str("productCode", productCode).Msg("could not prepare statement")
 		return &storageErrors.StatementPSQLError{Err: err}
@@ -787,8 +925,6 @@ func (s *Storage) UpdateProductCode(ctx context.Context, userID, productCode str
 	chanOk := make(chan bool)
 	chanEr := make(chan error)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
 		_, err := updProdCodeStmt.ExecContext(ctx, productCode, userID)
 		if err != nil {
 			if err, ok := err.(*pgconn.PgError); ok && err.Code == pgerrcode.UniqueViolation {
@@ -817,7 +953,7 @@ func (s *Storage) UpdateProductCode(ctx context.Context, userID, productCode str
 // GetProductCode retrieves a product code for a user.
 func (s *Storage) GetProductCode(ctx context.Context, userID string) (string, error) {
 	s.log.Debug().Msg("calling `GetProductCode` method")
-	getProdCodeStmt, err := s.DB.PrepareContext(ctx, "SELECT product_code from products where user_id = $1")
+	getProdCodeStmt, err := s.conn(ctx).PrepareContext(ctx, "SELECT product_code from products where user_id = $1")
 	if err != nil {
 		s.log.Error().Err(err).Str("userID", userID).Msg("could not prepare statement")
 		return "", &storageErrors.StatementPSQLError{Err: err}
@@ -826,8 +962,6 @@ func (s *Storage) GetProductCode(ctx context.Context, userID string) (string, er
 	chanOk := make(chan string)
 	chanEr := make(chan error)
 	go func() {
-		s.mu.Lock()
-		defer s.mu.Unlock()
 		var productCode string
 		err := getProdCodeStmt.QueryRowContext(ctx, userID).Scan(&productCode)
 		if err != nil {
@@ -0,0 +1,57 @@
+// Package psql provides PSQL storage service.
+
+package psql
+
+import (
+	"context"
+	"database/sql"
+	storageErrors "upload-service-auto/internal/storage/errors"
+)
+
+// txKey defines a context key under which an ongoing transaction is stored.
+type txKey struct{}
+
+// querier defines methods shared by sql.DB and sql.Tx.
+type querier interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// conn returns a transaction bound to the context if any or the DB connection pool otherwise.
+func (s *Storage) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return s.DB
+}
+
+// WithinTx runs fn as a single unit of work, all storage calls made with the context passed to fn are committed
+// if fn succeeds and rolled back otherwise. Nested calls join the outer transaction.
+func (s *Storage) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	s.log.Debug().Msg("calling `WithinTx` method")
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		s.log.Error().Err(err).Msg("could not begin transaction")
+		return &storageErrors.TransactionPSQLError{Err: err}
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if err = fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		s.log.Warn().Err(err).Msg("transaction rolled back")
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		s.log.Error().Err(err).Msg("could not commit transaction")
+		return &storageErrors.TransactionPSQLError{Err: err}
+	}
+	return nil
+}
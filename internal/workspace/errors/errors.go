@@ -0,0 +1,13 @@
+// Package errors provides string codes for error instantiation.
+
+package errors
+
+const (
+	WorkspaceCreationError = "could not create a job workspace"
+	WorkspaceRemovalError  = "could not remove a job workspace"
+	WorkspaceMarkingError  = "could not mark a job workspace as failed"
+	WorkspaceListingError  = "could not list job workspaces"
+	WorkspaceReadingError  = "could not read the job of a workspace"
+	SourceImportError      = "could not move a source file into a job workspace"
+	SourceExportError      = "could not move a source file out of a job workspace"
+)
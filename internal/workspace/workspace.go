@@ -0,0 +1,222 @@
+// Package workspace provides isolated per-job directories mounted into the pipeline container.
+
+package workspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/runner"
+	"upload-service-auto/internal/workspace/errors"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// jobsDir keeps job workspaces inside the mount directory.
+	jobsDir = "jobs"
+	// failedMarker is a file marking a workspace of a failed job, it holds the time of the failure.
+	failedMarker = "FAILED"
+	// jobFile is a file describing the job a workspace is created for.
+	jobFile = "JOB"
+	// mountTarget is the directory the workspace is mounted at inside the container.
+	mountTarget = "/mnt"
+)
+
+// layout lists directories the pipeline expects inside the mount directory.
+var layout = []string{
+	"data",
+	"intermediate",
+	"source",
+	filepath.Join("raw_data", "atlas_raw_data"),
+	filepath.Join("raw_data", "external_raw_data"),
+	filepath.Join("raw_data", "binary"),
+}
+
+// Workspace defines a directory of one job.
+type Workspace struct {
+	ID  string
+	Dir string
+}
+
+// job defines the job a workspace is created for as it is recorded in the job file.
+type job struct {
+	Kind     string `json:"kind"`
+	FileName string `json:"file_name"`
+}
+
+// Path joins path elements to the workspace directory.
+func (w *Workspace) Path(elem ...string) string {
+	return filepath.Join(append([]string{w.Dir}, elem...)...)
+}
+
+// Manager defines an object and sets its attributes.
+type Manager struct {
+	log *zerolog.Logger
+	cfg *config.Config
+}
+
+// NewManager initializes a new Manager instance.
+func NewManager(cfg *config.Config, logger *zerolog.Logger) *Manager {
+	logger.Debug().Msg("calling initializer of workspace manager")
+	return &Manager{
+		log: logger,
+		cfg: cfg,
+	}
+}
+
+// root returns the directory keeping all workspaces.
+func (m *Manager) root() string {
+	return filepath.Join(m.cfg.Docker.MountDir, jobsDir)
+}
+
+// Create creates a workspace for a job of a file, its identifier is unique among concurrent jobs and can be used as
+// a container name.
+func (m *Manager) Create(kind, fileName string) (*Workspace, error) {
+	m.log.Debug().Msg("calling `Create` method")
+	// container names allow ASCII letters and digits only along with the separators
+	safe := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, fileName)
+	id := fmt.Sprintf("upload-%s-%s-%d", kind, safe, time.Now().UnixNano())
+	ws := &Workspace{ID: id, Dir: filepath.Join(m.root(), id)}
+
+	for _, dir := range layout {
+		if err := os.MkdirAll(ws.Path(dir), 0o755); err != nil {
+			m.log.Error().Err(err).Str("workspace", id).Msg(errors.WorkspaceCreationError)
+			_ = os.RemoveAll(ws.Dir)
+			return nil, err
+		}
+	}
+	// the job is recorded, so that Prune can tell a workspace of a running job from an abandoned one
+	data, err := json.Marshal(&job{Kind: kind, FileName: fileName})
+	if err == nil {
+		err = os.WriteFile(ws.Path(jobFile), data, 0o644)
+	}
+	if err != nil {
+		m.log.Error().Err(err).Str("workspace", id).Msg(errors.WorkspaceCreationError)
+		_ = os.RemoveAll(ws.Dir)
+		return nil, err
+	}
+	m.log.Info().Str("workspace", id).Msg("workspace created")
+	return ws, nil
+}
+
+// Mounts returns mounts of a workspace, reference data is shared by all jobs and mounted read-only.
+func (m *Manager) Mounts(ws *Workspace) []runner.Mount {
+	return []runner.Mount{
+		{Source: ws.Dir, Target: mountTarget},
+		{Source: filepath.Join(m.cfg.Docker.MountDir, "data"), Target: mountTarget + "/data", ReadOnly: true},
+	}
+}
+
+// source returns the path of a source file saved by a local upload.
+func (m *Manager) source(fileName string) string {
+	return filepath.Join(m.cfg.Docker.MountDir, "source", fileName)
+}
+
+// Import moves a source file saved by a local upload into a workspace, so that the file is removed along with the
+// workspace unless it is exported back for a later job.
+func (m *Manager) Import(ws *Workspace, fileName string) error {
+	m.log.Debug().Msg("calling `Import` method")
+	if err := os.Rename(m.source(fileName), ws.Path("source", fileName)); err != nil {
+		m.log.Error().Err(err).Str("workspace", ws.ID).Msg(errors.SourceImportError)
+		return err
+	}
+	return nil
+}
+
+// Export moves a source file imported into a workspace back to the directory of local uploads, it is called before
+// the workspace is released for a file which is still to be processed.
+func (m *Manager) Export(ws *Workspace, fileName string) {
+	m.log.Debug().Msg("calling `Export` method")
+	if err := os.Rename(ws.Path("source", fileName), m.source(fileName)); err != nil {
+		m.log.Error().Err(err).Str("workspace", ws.ID).Msg(errors.SourceExportError)
+	}
+}
+
+// Release removes a workspace of a successful job, a workspace of a failed job is kept for debugging and removed by
+// Prune once the retention period is over.
+func (m *Manager) Release(ws *Workspace, failed bool) {
+	m.log.Debug().Msg("calling `Release` method")
+	if failed {
+		err := os.WriteFile(ws.Path(failedMarker), []byte(time.Now().Format(time.RFC3339)), 0o644)
+		if err != nil {
+			m.log.Error().Err(err).Str("workspace", ws.ID).Msg(errors.WorkspaceMarkingError)
+			return
+		}
+		m.log.Warn().Str("workspace", ws.Dir).Msg("workspace of a failed job is kept")
+		return
+	}
+	if err := os.RemoveAll(ws.Dir); err != nil {
+		m.log.Error().Err(err).Str("workspace", ws.ID).Msg(errors.WorkspaceRemovalError)
+		return
+	}
+	m.log.Info().Str("workspace", ws.ID).Msg("workspace removed")
+}
+
+// Prune removes workspaces of failed jobs kept longer than the retention period and returns their number.
+// Workspaces without a marker belong to running jobs or to jobs of a crashed consumer, the latter are removed once
+// they have not been modified for the retention period unless alive reports their job as still running.
+func (m *Manager) Prune(alive func(kind, fileName string) bool) (int, error) {
+	m.log.Debug().Msg("calling `Prune` method")
+	entries, err := os.ReadDir(m.root())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		m.log.Error().Err(err).Msg(errors.WorkspaceListingError)
+		return 0, err
+	}
+
+	before := time.Now().Add(-m.cfg.Docker.WorkspaceRetention)
+	pruned := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		ws := &Workspace{ID: entry.Name(), Dir: filepath.Join(m.root(), entry.Name())}
+		info, err := os.Stat(ws.Path(failedMarker))
+		marked := err == nil
+		if !marked {
+			info, err = entry.Info()
+		}
+		if err != nil || !info.ModTime().Before(before) {
+			continue
+		}
+		// the directory of a long running job is not modified once its container has started
+		if !marked && m.running(ws, alive) {
+			m.log.Debug().Str("workspace", ws.ID).Msg("workspace of a running job is kept")
+			continue
+		}
+		if err = os.RemoveAll(ws.Dir); err != nil {
+			m.log.Error().Err(err).Str("workspace", ws.ID).Msg(errors.WorkspaceRemovalError)
+			continue
+		}
+		pruned++
+		m.log.Info().Str("workspace", ws.ID).Msg("expired workspace removed")
+	}
+	return pruned, nil
+}
+
+// running reports whether the job of a workspace is still running, workspaces created without a job file are taken
+// for abandoned ones.
+func (m *Manager) running(ws *Workspace, alive func(kind, fileName string) bool) bool {
+	data, err := os.ReadFile(ws.Path(jobFile))
+	if err != nil {
+		return false
+	}
+	recorded := job{}
+	if err = json.Unmarshal(data, &recorded); err != nil {
+		m.log.Warn().Err(err).Str("workspace", ws.ID).Msg(errors.WorkspaceReadingError)
+		return false
+	}
+	return alive(recorded.Kind, recorded.FileName)
+}
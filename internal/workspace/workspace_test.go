@@ -0,0 +1,111 @@
+package workspace
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"upload-service-auto/internal/config"
+	"upload-service-auto/internal/constants"
+
+	"github.com/rs/zerolog"
+)
+
+// newTestManager initializes a new Manager over a temporary mount directory.
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	logger := zerolog.Nop()
+	cfg := &config.Config{}
+	cfg.Docker.MountDir = t.TempDir()
+	cfg.Docker.WorkspaceRetention = time.Hour
+	if err := os.MkdirAll(filepath.Join(cfg.Docker.MountDir, "source"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return NewManager(cfg, &logger)
+}
+
+// age sets the modification time of a workspace and its marker past the retention period.
+func age(t *testing.T, m *Manager, ws *Workspace) {
+	t.Helper()
+	old := time.Now().Add(-2 * m.cfg.Docker.WorkspaceRetention)
+	for _, path := range []string{ws.Dir, ws.Path(failedMarker)} {
+		if err := os.Chtimes(path, old, old); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestImportMovesSource(t *testing.T) {
+	m := newTestManager(t)
+	if err := os.WriteFile(m.source("file.txt"), []byte("genotypes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := m.Create(constants.JobValidation, "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Import(ws, "file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(m.source("file.txt")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the source to be moved, got %v", err)
+	}
+	m.Export(ws, "file.txt")
+	m.Release(ws, false)
+	if _, err = os.Stat(m.source("file.txt")); err != nil {
+		t.Errorf("expected the source to be exported, got %v", err)
+	}
+
+	ws, err = m.Create(constants.JobProcessing, "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Import(ws, "file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	m.Release(ws, false)
+	if _, err = os.Stat(m.source("file.txt")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the source to be removed with the workspace, got %v", err)
+	}
+}
+
+func TestPruneKeepsWorkspacesOfLeasedJobs(t *testing.T) {
+	m := newTestManager(t)
+	workspaces := make(map[string]*Workspace)
+	for _, fileName := range []string{"running.txt", "abandoned.txt", "failed.txt", "recent.txt"} {
+		ws, err := m.Create(constants.JobProcessing, fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		workspaces[fileName] = ws
+	}
+	m.Release(workspaces["failed.txt"], true)
+	for _, fileName := range []string{"running.txt", "abandoned.txt", "failed.txt"} {
+		age(t, m, workspaces[fileName])
+	}
+
+	// the failed job is taken for a running one as well, a marked workspace is removed anyway
+	pruned, err := m.Prune(func(kind, fileName string) bool {
+		return kind == constants.JobProcessing && (fileName == "running.txt" || fileName == "failed.txt")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 2 {
+		t.Errorf("expected 2 workspaces to be pruned, got %d", pruned)
+	}
+	for fileName, kept := range map[string]bool{
+		"running.txt":   true,
+		"abandoned.txt": false,
+		"failed.txt":    false,
+		"recent.txt":    true,
+	} {
+		_, err = os.Stat(workspaces[fileName].Dir)
+		if exists := err == nil; exists != kept {
+			t.Errorf("expected the workspace of %s to be kept %v, it exists %v", fileName, kept, exists)
+		}
+	}
+}